@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// checkAccessibility is true when the generated HTML is checked for common accessibility problems
+var checkAccessibility bool
+
+// The attributes checked by the accessibility audit
+var (
+	reAltAttr       = regexp.MustCompile(`\salt\s*=\s*"([^"]*)"`)
+	reSrcAttr       = regexp.MustCompile(`\ssrc\s*=\s*"([^"]*)"`)
+	reHrefAttr      = regexp.MustCompile(`\shref\s*=\s*"([^"]*)"`)
+	reAriaLabelAttr = regexp.MustCompile(`\saria-label(?:ledby)?\s*=\s*"([^"]*)"`)
+)
+
+// The texts of links which do not describe their target, when read out of context by a screen reader
+var vagueLinkTexts = []string{"here", "click here", "this", "link", "more", "read more", "this link", "this page"}
+
+// auditAccessibility warns about the accessibility problems of the generated HTML: images without alternative
+// text, links without text and links whose text does not describe their target. The headings which skip levels
+// are errors already when the sections are processed.
+// The problems are reported in the line of the source of the element when it is known, or otherwise in the
+// first line which mentions the image or the link.
+func (doc *Document) auditAccessibility(html string) {
+	lineNum := -1
+
+	// The link being read, with its text
+	inLink := false
+	linkTag, linkText, linkLine := "", "", -1
+
+	for _, token := range reHTMLToken.FindAllString(html, -1) {
+		if !strings.HasPrefix(token, "<") {
+			if inLink {
+				linkText = linkText + token
+			}
+			continue
+		}
+		if strings.HasPrefix(token, "<!") {
+			continue
+		}
+		m := reTagName.FindStringSubmatch(token)
+		if m == nil {
+			continue
+		}
+		name := strings.ToLower(m[1])
+
+		if strings.HasPrefix(token, "</") {
+			if name == "a" && inLink {
+				doc.auditLink(linkLine, linkTag, linkText)
+				inLink = false
+			}
+			continue
+		}
+
+		if lm := reLineAttr.FindStringSubmatch(token); lm != nil {
+			riteLine, _ := strconv.Atoi(lm[1])
+			lineNum = doc.sourceLineNum(riteLine)
+		}
+
+		switch {
+		case name == "img":
+			alt := reAltAttr.FindStringSubmatch(token)
+			if alt == nil || len(strings.TrimSpace(alt[1])) == 0 {
+				src := ""
+				if sm := reSrcAttr.FindStringSubmatch(token); sm != nil {
+					src = sm[1]
+				}
+				doc.warnf(doc.auditLine(lineNum, src), "a11y", "image '%v' without alternative text, add a caption or 'alt='", src)
+			}
+			if inLink && alt != nil {
+				linkText = linkText + alt[1]
+			}
+
+		case name == "a" && reHrefAttr.MatchString(token):
+			inLink = true
+			linkTag, linkText, linkLine = token, "", lineNum
+		}
+	}
+}
+
+// auditLink warns about a link without text, or with a text which does not describe its target
+func (doc *Document) auditLink(lineNum int, tag string, text string) {
+	href := reHrefAttr.FindStringSubmatch(tag)[1]
+	lineNum = doc.auditLine(lineNum, href)
+
+	if reAriaLabelAttr.MatchString(tag) {
+		return
+	}
+
+	text = strings.TrimSpace(reSpaces.ReplaceAllString(text, " "))
+	if len(text) == 0 {
+		doc.warnf(lineNum, "a11y", "link to '%v' without text", href)
+		return
+	}
+	if contains(vagueLinkTexts, strings.ToLower(strings.TrimRight(text, ".:"))) {
+		doc.warnf(lineNum, "a11y", "the text '%v' of the link to '%v' does not describe its target", text, href)
+	}
+}
+
+// auditLine returns the line of the element if it is known, or otherwise the first line which mentions the reference
+func (doc *Document) auditLine(lineNum int, ref string) int {
+	if lineNum >= 0 || len(ref) == 0 {
+		return lineNum
+	}
+	return doc.findLine(ref)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The definition of an abbreviation in a line of an <x-abbr> block, like 'API: Application Programming Interface'
+var reAbbrDef = regexp.MustCompile(`^([^\s:]+)\s*:\s*(.+)$`)
+
+// The elements whose text is not checked for abbreviations
+var noAbbrElements = []string{"abbr", "a", "dfn", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "code", "kbd", "samp", "script", "style", "textarea"}
+
+// The key in the YAML header with the map of abbreviations and their expansions
+const abbreviationsKey = "abbreviations"
+
+// defineAbbreviation registers an abbreviation and its expansion.
+// They are defined with '<x-abbr API>Application Programming Interface' or in the lines indented
+// after an <x-abbr> tag, like 'API: Application Programming Interface'.
+func (doc *Document) defineAbbreviation(lineNum int, abbr string, expansion string) {
+	expansion = strings.TrimSpace(expansion)
+	if len(abbr) == 0 || len(expansion) == 0 {
+		doc.errorf(lineNum, "abbreviation", "invalid abbreviation, use '<x-abbr API>Application Programming Interface'")
+		return
+	}
+
+	if prev, found := doc.abbreviations[abbr]; found && prev != expansion {
+		doc.warnf(lineNum, "duplicate-abbreviation", "abbreviation '%v' redefined, it was '%v'", abbr, prev)
+	}
+	doc.abbreviations[abbr] = expansion
+}
+
+// preprocessAbbreviation registers the abbreviations defined by the <x-abbr> tag in the line, and returns
+// true if the abbreviations are defined in the following indented lines
+func (doc *Document) preprocessAbbreviation(lineNum int) bool {
+	tagFields := doc.preprocessTagSpec(lineNum)
+
+	fields := strings.Fields(tagFields["stdFields"])
+	if len(fields) == 0 {
+		return true
+	}
+
+	doc.defineAbbreviation(lineNum, fields[0], tagFields["restLine"])
+	return false
+}
+
+// preprocessAbbreviationLine registers the abbreviation defined in a line of an <x-abbr> block
+func (doc *Document) preprocessAbbreviationLine(lineNum int) {
+	m := reAbbrDef.FindStringSubmatch(doc.lines[lineNum])
+	if m == nil {
+		doc.errorf(lineNum, "abbreviation", "invalid abbreviation, use 'API: Application Programming Interface'")
+		return
+	}
+	doc.defineAbbreviation(lineNum, m[1], m[2])
+}
+
+// loadAbbreviations adds the abbreviations of the YAML header, which can be redefined in the document
+func (doc *Document) loadAbbreviations() {
+	for abbr, expansion := range doc.config.Map(abbreviationsKey) {
+		if _, found := doc.abbreviations[abbr]; !found {
+			doc.abbreviations[abbr] = fmt.Sprint(expansion)
+		}
+	}
+}
+
+// expandAbbreviations marks the first occurrence of each abbreviation in the text of the HTML
+// with an <abbr> element whose title is the expansion
+func (doc *Document) expandAbbreviations(htmlText string) string {
+	if len(doc.abbreviations) == 0 {
+		return htmlText
+	}
+
+	// Longer abbreviations are tried first, so 'VCDM' is preferred to 'VC'
+	abbrs := doc.sortedAbbreviations()
+	sort.SliceStable(abbrs, func(i, j int) bool { return len(abbrs[i]) > len(abbrs[j]) })
+
+	alternatives := []string{}
+	for _, abbr := range abbrs {
+		alternatives = append(alternatives, regexp.QuoteMeta(abbr))
+	}
+	reAbbrs := regexp.MustCompile(`\b(` + strings.Join(alternatives, "|") + `)\b`)
+
+	seen := map[string]bool{}
+
+	return mapText(htmlText, noAbbrElements, func(text string) string {
+		return reAbbrs.ReplaceAllStringFunc(text, func(abbr string) string {
+			if seen[abbr] {
+				return abbr
+			}
+			seen[abbr] = true
+			return fmt.Sprintf("<abbr title=\"%v\">%v</abbr>", html.EscapeString(doc.abbreviations[abbr]), abbr)
+		})
+	})
+}
+
+// sortedAbbreviations returns the abbreviations in alphabetical order
+func (doc *Document) sortedAbbreviations() []string {
+	abbrs := []string{}
+	for abbr := range doc.abbreviations {
+		abbrs = append(abbrs, abbr)
+	}
+	sort.Strings(abbrs)
+	return abbrs
+}
+
+// abbreviationsSection returns the list of abbreviations and their expansions, sorted alphabetically
+func (doc *Document) abbreviationsSection() string {
+	if len(doc.abbreviations) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("<dl class=\"abbreviations\">\n")
+	for _, abbr := range doc.sortedAbbreviations() {
+		sb.WriteString(fmt.Sprintf("<dt><abbr>%v</abbr></dt>\n<dd>%v</dd>\n", abbr, doc.abbreviations[abbr]))
+	}
+	sb.WriteString("</dl>\n")
+
+	return sb.String()
+}
+
+// The placeholder where the list of abbreviations is written, replaced when the whole document has been processed
+const abbreviationsPlaceholder = "{#abbreviations}"
+
+// startsWithAbbreviations returns true if the line is the <x-abbreviations> tag, which marks where
+// the list of abbreviations is written
+func (doc *Document) startsWithAbbreviations(lineNum int) bool {
+	return strings.HasPrefix(doc.lines[lineNum], "<x-abbreviations")
+}
+
+// processAbbreviations writes the placeholder of the list of abbreviations, which is generated when all of them are known
+func (doc *Document) processAbbreviations(lineNum int) int {
+	doc.sb.WriteString(doc.indentStr(lineNum) + abbreviationsPlaceholder + "\n")
+	return lineNum + 1
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Admonition is a kind of highlighted box, like a note or a warning, written with '<x-note>Text'.
+// Other kinds can be declared in the YAML header, like
+//
+//	admonitions:
+//	  tip: {label: Tip, icon: 💡}
+//	  security: {label: Security consideration, class: warning, icon: shield.svg}
+//
+// which are written with '<x-tip>Text' or '<x-security>Text'.
+type Admonition struct {
+	label string // The text before the content of the box, translated with localize for the built-in kinds
+	class string // The CSS class of the box, which by default is the name of the kind
+	icon  string // A text, like an emoji, or an image shown before the label
+}
+
+// The kinds of admonitions available in all documents
+var builtinAdmonitions = map[string]*Admonition{
+	"note":    {label: "Note", class: "note"},
+	"warning": {label: "Warning", class: "warning"},
+}
+
+// The key in the YAML header with the kinds of admonitions declared by the user
+const admonitionsKey = "admonitions"
+
+// admonition returns the kind of admonition of the tag, like "x-note", or nil if the tag is not an admonition.
+// The kinds declared in the YAML header have precedence over the built-in ones.
+func (doc *Document) admonition(tag string) *Admonition {
+	if !strings.HasPrefix(tag, "x-") {
+		return nil
+	}
+	name := strings.TrimPrefix(tag, "x-")
+
+	if _, found := doc.config.Map(admonitionsKey)[name]; found {
+		prefix := admonitionsKey + "." + name
+		return &Admonition{
+			label: doc.config.String(prefix+".label", strings.ToUpper(name[:1])+strings.ReplaceAll(name[1:], "-", " ")),
+			class: doc.config.String(prefix+".class", name),
+			icon:  doc.config.String(prefix + ".icon"),
+		}
+	}
+
+	if kind, found := builtinAdmonitions[name]; found {
+		return &Admonition{label: doc.localize(kind.label), class: kind.class}
+	}
+
+	return nil
+}
+
+// preprocessAdmonition converts the tag of an admonition into a highlighted box with its label, keeping
+// the id, class and other attributes of the tag
+func (doc *Document) preprocessAdmonition(lineNum int, tagFields map[string]string, kind *Admonition) {
+	label := kind.label
+	if len(kind.icon) > 0 {
+		switch strings.ToLower(path.Ext(kind.icon)) {
+		case ".svg", ".png", ".jpg", ".jpeg", ".gif", ".webp":
+			doc.checkAsset(lineNum, kind.icon)
+			label = fmt.Sprintf("<img class=\"admonition-icon\" src=\"%v\" alt=\"\"> %v", doc.assetPath(kind.icon), label)
+		default:
+			label = fmt.Sprintf("<span class=\"admonition-icon\">%v</span> %v", kind.icon, label)
+		}
+	}
+
+	class := "admonition " + kind.class
+	if c := tagFields["class"]; len(c) > 0 {
+		class = class + " " + c
+	}
+	box := fmt.Sprintf("<div class=\"%v\"", class)
+	if id := tagFields["id"]; len(id) > 0 {
+		box = box + " #" + id
+	}
+	if stdFields := tagFields["stdFields"]; len(stdFields) > 0 {
+		box = box + " " + stdFields
+	}
+
+	doc.lines[lineNum] = fmt.Sprintf("%v><span class=\"admonition-label\">%v</span> %v", box, label, strings.TrimSpace(tagFields["restLine"]))
+}
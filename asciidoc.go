@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// isAsciiDoc returns true if the file is written in AsciiDoc instead of rite, like 'chapter.adoc'
+func isAsciiDoc(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".adoc" || ext == ".asciidoc" || ext == ".asc"
+}
+
+// The block markup of AsciiDoc
+var (
+	reAsciiDocSection   = regexp.MustCompile(`^(={1,6})\s+(.*)$`)
+	reAsciiDocAttribute = regexp.MustCompile(`^:!?[\w-]+!?:(\s.*)?$`)
+	reAsciiDocItem      = regexp.MustCompile(`^(\*{1,5}|-|\.{1,5})\s+(.*)$`)
+	reAsciiDocBlockAttr = regexp.MustCompile(`^\[([^\]]*)\]$`)
+	reAsciiDocAnchor    = regexp.MustCompile(`^\[(?:\[([\w.-]+)(?:,[^\]]*)?\]|#([\w.-]+))\]$`)
+	reAsciiDocTitle     = regexp.MustCompile(`^\.([^.\s].*)$`)
+	reAsciiDocAdmonLine = regexp.MustCompile(`^(NOTE|TIP|IMPORTANT|WARNING|CAUTION):\s+(.*)$`)
+	reAsciiDocImage     = regexp.MustCompile(`^image::([^\[\s]+)\[([^\]]*)\]$`)
+)
+
+// The inline markup of AsciiDoc which is different in rite
+var (
+	reAsciiDocStrong     = regexp.MustCompile(`(^|[^*\w])\*([^*\s]([^*]*[^*\s])?)\*($|[^*\w])`)
+	reAsciiDocLink       = regexp.MustCompile(`(?:link:)?(https?://[^\s\[]+)\[([^\]]*)\]`)
+	reAsciiDocInlineLink = regexp.MustCompile(`link:([^\s\[]+)\[([^\]]*)\]`)
+	reAsciiDocInlineImg  = regexp.MustCompile(`image:([^\s:\[][^\s\[]*)\[([^\]]*)\]`)
+	reAsciiDocXref       = regexp.MustCompile(`<<([\w.-]+)>>`)
+	reAsciiDocXrefText   = regexp.MustCompile(`<<([\w.-]+),\s*([^>"]*)>>`)
+)
+
+// The kinds of admonitions of AsciiDoc, and the built-in kind of rite for each one
+var asciiDocAdmonitions = map[string]string{
+	"NOTE":      "x-note",
+	"TIP":       "x-note",
+	"IMPORTANT": "x-warning",
+	"WARNING":   "x-warning",
+	"CAUTION":   "x-warning",
+}
+
+// asciiDocToRite converts an AsciiDoc file to rite, so it can be included in a document or processed like a rite
+// file, like in '<x-include @chapter.adoc>'. The document title and the sections with '=' are converted to the
+// YAML header and the headings with '#', and also the lists with '*' and '.', the admonitions like 'NOTE:' or
+// '[WARNING]' blocks, the source and literal blocks, the quotes, the images, the links and the bold text.
+// The admonitions TIP are notes, and IMPORTANT and CAUTION are warnings, the built-in kinds of rite.
+// The attributes of the document and the comments are removed.
+// The lists, blocks and the YAML header need lines with their tags, so the lines after them are reported in the
+// diagnostics some lines later than in the AsciiDoc file.
+func asciiDocToRite(content []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	out := []string{}
+
+	// The depth of each list being converted, with its tag
+	lists := []markdownList{}
+
+	// The delimiters of the blocks being converted, which can be nested, with their indentation in the output
+	// and the lists where they are
+	type block struct {
+		delimiter   string
+		indentation int
+		lists       []markdownList
+	}
+	blocks := []block{}
+	verbatim := false
+
+	// The attributes, the title and the id of the next block, like '[source,go]', '.Main program' and '[[intro]]'
+	blockAttr, blockTitle, blockID := "", "", ""
+
+	insideComment := false
+	listContinuation := false
+
+	emit := func(indentation int, text string) {
+		out = append(out, strings.Repeat(" ", indentation)+text)
+	}
+
+	// startBlock writes the tag of a block, after a blank line so it is not part of the previous paragraph
+	startBlock := func(indentation int, tag string) {
+		if len(out) > 0 && len(strings.TrimSpace(out[len(out)-1])) > 0 {
+			out = append(out, "")
+		}
+		emit(indentation, tag)
+	}
+
+	// contentIndentation returns the indentation of the content of the innermost list item or block
+	contentIndentation := func() int {
+		if len(blocks) > 0 {
+			return blocks[len(blocks)-1].indentation + 4 + 8*len(lists)
+		}
+		return 8 * len(lists)
+	}
+
+	// closing returns true if the line is the delimiter of the innermost block
+	closing := func(line string) bool {
+		return len(blocks) > 0 && blocks[len(blocks)-1].delimiter == line
+	}
+
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		trimmed := strings.TrimSpace(line)
+
+		// The content of the source and literal blocks is written literally, indented under the <pre> tag
+		if verbatim {
+			if closing(trimmed) {
+				lists = blocks[len(blocks)-1].lists
+				blocks, verbatim = blocks[:len(blocks)-1], false
+				out = append(out, "")
+				continue
+			}
+			emit(blocks[len(blocks)-1].indentation+4, html.EscapeString(strings.TrimRight(line, " ")))
+			continue
+		}
+
+		// The comments are removed, keeping their lines
+		if insideComment || strings.HasPrefix(trimmed, "////") && strings.Trim(trimmed, "/") == "" {
+			if strings.HasPrefix(trimmed, "////") {
+				insideComment = !insideComment
+			}
+			out = append(out, "")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "//") {
+			out = append(out, "")
+			continue
+		}
+
+		// The document title is the title in the YAML header
+		if m := reAsciiDocSection.FindStringSubmatch(trimmed); m != nil && len(m[1]) == 1 && len(out) == i && strings.TrimSpace(strings.Join(out, "")) == "" {
+			out = append(out, "---", fmt.Sprintf("title: %q", m[2]), "---")
+			continue
+		}
+
+		// The attributes of the document are removed
+		if reAsciiDocAttribute.MatchString(trimmed) && len(blocks) == 0 && len(lists) == 0 {
+			out = append(out, "")
+			continue
+		}
+
+		if len(trimmed) == 0 {
+			out = append(out, "")
+			listContinuation = false
+			continue
+		}
+
+		// The attributes, the title and the id of the next block
+		if m := reAsciiDocAnchor.FindStringSubmatch(trimmed); m != nil {
+			blockID = m[1] + m[2]
+			out = append(out, "")
+			continue
+		}
+		if m := reAsciiDocBlockAttr.FindStringSubmatch(trimmed); m != nil {
+			blockAttr = m[1]
+			out = append(out, "")
+			continue
+		}
+		if m := reAsciiDocTitle.FindStringSubmatch(trimmed); m != nil {
+			blockTitle = m[1]
+			out = append(out, "")
+			continue
+		}
+
+		// The '+' after a list item attaches the next block to the item
+		if trimmed == "+" && len(lists) > 0 {
+			listContinuation = true
+			out = append(out, "")
+			continue
+		}
+		if len(lists) > 0 && !closing(trimmed) && !listContinuation && !reAsciiDocItem.MatchString(trimmed) {
+			previous := out[len(out)-1]
+			if len(strings.TrimSpace(previous)) > 0 {
+				// The lines which continue the text of an item are joined to it
+				out[len(out)-1] = previous + " " + asciiDocInline(trimmed)
+				out = append(out, "")
+				continue
+			}
+			lists = nil
+		}
+		continuation := listContinuation
+		listContinuation = false
+
+		// The delimited blocks: the end of the innermost block, the blocks of code, and the admonitions and quotes
+		if closing(trimmed) {
+			lists = blocks[len(blocks)-1].lists
+			blocks = blocks[:len(blocks)-1]
+			out = append(out, "")
+			continue
+		}
+		if len(trimmed) >= 4 && strings.Trim(trimmed, trimmed[:1]) == "" && strings.Contains("-.=_*", trimmed[:1]) {
+			attr, title := blockAttr, blockTitle
+			blockAttr, blockTitle = "", ""
+			if !continuation {
+				lists = nil
+			}
+			indentation := contentIndentation()
+			blocks = append(blocks, block{delimiter: trimmed, indentation: indentation, lists: lists})
+			lists = nil
+
+			switch trimmed[:1] {
+			case "-", ".":
+				verbatim = true
+				tag := "<pre>"
+				if fields := strings.Split(attr, ","); len(fields) > 1 && fields[0] == "source" {
+					tag = fmt.Sprintf("<pre><code class=\"language-%v\">", strings.TrimSpace(fields[1]))
+				}
+				startBlock(indentation, tag)
+			case "=":
+				kind, found := asciiDocAdmonitions[attr]
+				if !found {
+					kind = "div"
+				}
+				startBlock(indentation, "<"+kind+">"+asciiDocInline(title))
+			case "_":
+				startBlock(indentation, "<blockquote>")
+			default:
+				startBlock(indentation, "<aside>")
+			}
+			continue
+		}
+
+		// The sections are the headings of rite, one level less because the level 0 is the title
+		if m := reAsciiDocSection.FindStringSubmatch(trimmed); m != nil && len(m[1]) > 1 && len(blocks) == 0 {
+			lists = nil
+			if len(blockID) > 0 {
+				startBlock(0, fmt.Sprintf("<h%v #%v>%v", len(m[1])-1, blockID, asciiDocInline(m[2])))
+			} else {
+				startBlock(0, strings.Repeat("#", len(m[1])-1)+" "+asciiDocInline(m[2]))
+			}
+			blockAttr, blockTitle, blockID = "", "", ""
+			continue
+		}
+
+		// The admonitions in a paragraph, like 'NOTE: Text'
+		if m := reAsciiDocAdmonLine.FindStringSubmatch(trimmed); m != nil {
+			startBlock(contentIndentation(), "<"+asciiDocAdmonitions[m[1]]+">"+asciiDocInline(m[2]))
+			continue
+		}
+
+		// The images are figures, with the title of the block as caption
+		if m := reAsciiDocImage.FindStringSubmatch(trimmed); m != nil {
+			alt := strings.TrimSpace(strings.Split(m[2], ",")[0])
+			tag := "<x-img @" + m[1]
+			if len(alt) > 0 {
+				tag = tag + " alt=\"" + strings.ReplaceAll(alt, "\"", "'") + "\""
+			}
+			startBlock(contentIndentation(), tag+">"+asciiDocInline(blockTitle))
+			blockAttr, blockTitle = "", ""
+			continue
+		}
+
+		// The items of the lists are written in a <ul> or <ol> block, nested by the number of markers
+		if m := reAsciiDocItem.FindStringSubmatch(trimmed); m != nil {
+			tag := "<ul>"
+			if m[1][0] == '.' {
+				tag = "<ol>"
+			}
+			depth := len(m[1])
+			for len(lists) > 0 && lists[len(lists)-1].indentation > depth {
+				lists = lists[:len(lists)-1]
+			}
+			if len(lists) > 0 && lists[len(lists)-1].indentation == depth && lists[len(lists)-1].tag != tag {
+				lists = lists[:len(lists)-1]
+			}
+			if len(lists) == 0 || lists[len(lists)-1].indentation < depth {
+				if len(lists) == 0 {
+					startBlock(0, tag)
+				} else {
+					emit(contentIndentation(), tag)
+				}
+				lists = append(lists, markdownList{indentation: depth, tag: tag})
+			}
+			// The content of the previous item ends with a blank line
+			if last := out[len(out)-1]; len(strings.TrimSpace(last)) > 0 && len(last)-len(strings.TrimLeft(last, " ")) > contentIndentation()-4 {
+				out = append(out, "")
+			}
+			emit(contentIndentation()-4, "<li>"+asciiDocInline(m[2]))
+			continue
+		}
+
+		blockAttr, blockTitle, blockID = "", "", ""
+		emit(contentIndentation(), asciiDocInline(trimmed))
+	}
+
+	return []byte(strings.Join(out, "\n"))
+}
+
+// asciiDocInline converts the inline markup of AsciiDoc which is different in rite: the bold text with '*',
+// the emphasis, the links like 'https://example.com[Example]', the images and the cross references like '<<intro>>'.
+// The emphasis with '_' is '__' in rite, and the code with '`' is the same.
+func asciiDocInline(text string) string {
+	return mapOutsideCode(text, func(s string) string {
+		s = reAsciiDocInlineImg.ReplaceAllString(s, `<img src="$1" alt="$2">`)
+		s = reAsciiDocLink.ReplaceAllString(s, `<a href="$1">$2</a>`)
+		s = reAsciiDocInlineLink.ReplaceAllString(s, `<a href="$1">$2</a>`)
+		s = reAsciiDocXref.ReplaceAllString(s, `<x-ref "$1">`)
+		s = reAsciiDocXrefText.ReplaceAllString(s, `<x-ref "$1" "$2">`)
+		for i := 0; i < 2; i++ {
+			s = reMarkdownUnderEm.ReplaceAllString(s, "${1}__${2}__$4")
+		}
+		// The expression is applied twice, because the character between two bold words is used by the first one
+		for i := 0; i < 2; i++ {
+			s = reAsciiDocStrong.ReplaceAllString(s, "$1\x00$2\x00$4")
+		}
+		return reMarkdownStrongUx.ReplaceAllString(s, "**$1**")
+	})
+}
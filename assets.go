@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The directory, relative to the output file, where the local assets referenced by the document are copied
+const builtAssetsDir = "builtassets"
+
+// copyAssets is true when the local assets referenced by the document have to be copied to the output location
+var copyAssets bool
+
+// downloadImages is true when the remote images of the figures have to be downloaded and copied to the
+// assets directory, so the published document does not depend on other sites
+var downloadImages bool
+
+// fingerprintAssets is true when the names of the assets copied have a hash of their content, like 'arch.3f2a1b9c.png',
+// so the sites which cache the files for a long time serve the new version of the files which change
+var fingerprintAssets bool
+
+// fingerprint returns the name of a file with a hash of its content before the extension
+func fingerprint(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+// localAssetPath returns the path of the file referenced by a src or href attribute, or the empty
+// string if the reference is not to a local file (an URL, a fragment, an absolute path, ...)
+func localAssetPath(ref string) string {
+	if len(ref) == 0 || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "/") {
+		return ""
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil || len(u.Scheme) > 0 || len(u.Host) > 0 || len(u.Path) == 0 {
+		return ""
+	}
+
+	return u.Path
+}
+
+// localFile returns the path of a file referenced by the document, which is relative to the source file
+func (doc *Document) localFile(filePath string) string {
+	return filepath.Join(filepath.Dir(doc.fileName), filepath.FromSlash(filePath))
+}
+
+// checkAsset warns if the local file referenced in the line does not exist
+func (doc *Document) checkAsset(lineNum int, ref string) {
+	filePath := localAssetPath(ref)
+	if len(filePath) == 0 {
+		return
+	}
+
+	if _, err := os.Stat(doc.localFile(filePath)); err != nil {
+		doc.warnf(lineNum, "missing-file", "the file '%v' does not exist", ref)
+	}
+}
+
+// assetPath registers a local file referenced by the document, so it can be copied to the output location
+// when the document is written, and returns the reference to use in the generated HTML.
+// Links to other HTML documents and to files which do not exist are not considered assets.
+func (doc *Document) assetPath(ref string) string {
+
+	if !copyAssets {
+		return ref
+	}
+
+	filePath := localAssetPath(ref)
+	if len(filePath) == 0 {
+		return ref
+	}
+
+	ext := strings.ToLower(path.Ext(filePath))
+	if ext == ".html" || ext == ".htm" {
+		return ref
+	}
+
+	if _, err := os.Stat(doc.localFile(filePath)); err != nil {
+		return ref
+	}
+
+	// The assets are registered by their absolute path, so a file referenced in different ways is copied once
+	source, target, err := doc.assetTarget(filePath)
+	if err != nil {
+		return ref
+	}
+	if fingerprintAssets {
+		if content, err := os.ReadFile(source); err == nil {
+			target = fingerprint(target, content)
+		}
+	}
+
+	doc.assets[source] = target
+
+	// Keep the query and fragment of the original reference, whose path may be escaped like in 'a%20b.png'
+	u, _ := url.Parse(ref)
+	link := (&url.URL{Path: target}).EscapedPath()
+	if len(u.RawQuery) > 0 {
+		link = link + "?" + u.RawQuery
+	}
+	if len(u.Fragment) > 0 {
+		link = link + "#" + u.EscapedFragment()
+	}
+	return link
+}
+
+// assetTarget returns the absolute path of a local file referenced by the document, and the path relative to
+// the output file where it is copied, in the assets directory
+func (doc *Document) assetTarget(filePath string) (string, string, error) {
+	source, err := filepath.Abs(doc.localFile(filePath))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Keep the directory structure of the asset, but without going outside the assets directory.
+	// The files outside the directory of the document could end in the same path as the files inside,
+	// like '../img/a.png' and 'img/a.png', so their names have a prefix with a hash of their absolute path.
+	cleanPath := path.Clean(filePath)
+	outside := false
+	for strings.HasPrefix(cleanPath, "../") {
+		cleanPath = strings.TrimPrefix(cleanPath, "../")
+		outside = true
+	}
+	if outside {
+		sum := sha256.Sum256([]byte(filepath.ToSlash(source)))
+		cleanPath = path.Join(path.Dir(cleanPath), hex.EncodeToString(sum[:4])+"-"+path.Base(cleanPath))
+	}
+	return source, path.Join(builtAssetsDir, cleanPath), nil
+}
+
+// An image in the text, like '<img src="arch.png" alt="Architecture">', with the reference to its file
+var reInlineImage = regexp.MustCompile(`(?i)(<img(?:\s[^>]*?)?\ssrc\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+// replaceInlineImages checks the local files of the images anywhere in the line, and replaces their references
+// by the ones of the copies when the assets are copied. The tags at the start of a line are processed like
+// the rest of their attributes, with their 'src' given like in '<img @arch.png>'.
+// The images in code spans are written literally.
+func (doc *Document) replaceInlineImages(lineNum int, line string) string {
+	return mapOutsideCode(line, func(text string) string {
+		return reInlineImage.ReplaceAllStringFunc(text, func(img string) string {
+			m := reInlineImage.FindStringSubmatch(img)
+			ref := html.UnescapeString(m[2] + m[3])
+			doc.checkAsset(lineNum, ref)
+			if link := doc.assetPath(ref); link != ref {
+				return fmt.Sprintf("%v\"%v\"", m[1], html.EscapeString(link))
+			}
+			return img
+		})
+	})
+}
+
+// remoteAssetPath downloads a remote image referenced in the line, and registers it to be copied to the
+// remote directory of the assets when the document is written. It returns the reference to use in the generated
+// HTML, or the URL if the image can not be downloaded. The downloads are cached like the other resources.
+func (doc *Document) remoteAssetPath(lineNum int, ref string) string {
+	content, err := fetchURL(ref)
+	if err != nil {
+		doc.warnf(lineNum, "download", "error downloading '%v': %v", ref, err)
+		return ref
+	}
+
+	// The name of the file keeps the name in the URL, with a prefix to avoid conflicts between sites
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	sum := sha256.Sum256([]byte(ref))
+	target := path.Join(builtAssetsDir, "remote", hex.EncodeToString(sum[:4])+"-"+path.Base(u.Path))
+	if fingerprintAssets {
+		target = fingerprint(target, content)
+	}
+
+	doc.assets[ref] = target
+	return target
+}
+
+// CopyAssets copies the local assets referenced by the document to the assets directory next to the output file
+func (doc *Document) CopyAssets(outputFileName string) error {
+
+	sources := make([]string, 0, len(doc.assets))
+	for source := range doc.assets {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		to := filepath.Join(filepath.Dir(outputFileName), filepath.FromSlash(doc.assets[source]))
+
+		// The remote images are written from the cache of the downloads
+		if isURL(source) {
+			doc.log.Debugw("writing remote asset", "from", source, "to", to)
+			if err := writeRemoteAsset(source, to); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var err error
+		if optimizeImages {
+			doc.log.Debugw("optimizing asset", "from", source, "to", to)
+			err = optimizeImage(source, to)
+		} else {
+			doc.log.Debugw("copying asset", "from", source, "to", to)
+			err = copyFile(source, to)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The smaller copies of the images are generated from the images, even if the assets are not copied
+	targets := make([]string, 0, len(doc.imageCopies))
+	for target := range doc.imageCopies {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		to := filepath.Join(filepath.Dir(outputFileName), filepath.FromSlash(target))
+		doc.log.Debugw("writing image copy", "from", doc.imageCopies[target].source, "to", to)
+		if err := doc.imageCopies[target].write(to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRemoteAsset writes a resource downloaded from the network, creating the destination directory if needed
+func writeRemoteAsset(rawURL string, to string) error {
+	content, err := fetchURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	// The SVG images from other sites can have scripts, which would run in the site of the document
+	if isSVG(to, content) {
+		content, err = sanitizeSVG(content)
+		if err != nil {
+			return fmt.Errorf("%v: %w", rawURL, err)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(to), 0775)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(to, content, 0664)
+}
+
+// copyFile copies a file, creating the destination directory if needed
+func copyFile(from string, to string) error {
+
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(to), 0775)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
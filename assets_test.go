@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withCopyAssets enables the copy of the assets during the test
+func withCopyAssets(t *testing.T) {
+	t.Helper()
+	previous := copyAssets
+	copyAssets = true
+	t.Cleanup(func() { copyAssets = previous })
+}
+
+// newTestDocumentWithFiles returns a document in a new directory with the files, which are created empty
+func newTestDocumentWithFiles(t *testing.T, files ...string) *Document {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "doc")
+	for _, name := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := newTestDocument("")
+	doc.fileName = filepath.Join(dir, "index.rite")
+	return doc
+}
+
+// newTestDocumentInDirectory returns the document with the source, in the directory of a document
+// created with newTestDocumentWithFiles
+func newTestDocumentInDirectory(t *testing.T, dir *Document, src string) *Document {
+	t.Helper()
+	return newDocument(dir.fileName, bufio.NewScanner(strings.NewReader(src)), nil)
+}
+
+func TestAssetPath(t *testing.T) {
+	withCopyAssets(t)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"img/a.png", "builtassets/img/a.png"},
+		{"img/a.png?v=2", "builtassets/img/a.png?v=2"},
+		{"img/a.svg#icon", "builtassets/img/a.svg#icon"},
+		{"img/a.svg?v=2#icon", "builtassets/img/a.svg?v=2#icon"},
+		{"img/a%20b.png", "builtassets/img/a%20b.png"},
+		{"img/a%20b.png?v=2", "builtassets/img/a%20b.png?v=2"},
+		{"missing.png", "missing.png"},
+		{"https://example.com/a.png", "https://example.com/a.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			doc := newTestDocumentWithFiles(t, "img/a.png", "img/a.svg", "img/a b.png")
+			if got := doc.assetPath(tt.ref); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyAssets(t *testing.T) {
+	withCopyAssets(t)
+
+	doc := newTestDocumentWithFiles(t, "img/a.png", "../img/a.png")
+	inside := doc.assetPath("img/a.png")
+	outside := doc.assetPath("../img/a.png")
+	if inside == outside {
+		t.Fatalf("the files inside and outside the directory are both copied to %v", inside)
+	}
+	if again := doc.assetPath("img/../img/./a.png"); again != inside {
+		t.Errorf("the same file is copied to %v and %v", inside, again)
+	}
+
+	outputName := filepath.Join(t.TempDir(), "index.html")
+	if err := doc.CopyAssets(outputName); err != nil {
+		t.Fatal(err)
+	}
+	for ref, want := range map[string]string{inside: "img/a.png", outside: "../img/a.png"} {
+		content, err := os.ReadFile(filepath.Join(filepath.Dir(outputName), filepath.FromSlash(ref)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%v has the content of %v, want %v", ref, string(content), want)
+		}
+	}
+}
+
+func TestInlineImages(t *testing.T) {
+	withCopyAssets(t)
+
+	files := newTestDocumentWithFiles(t, "img/a.png", "img/b c.png")
+	doc := newTestDocumentInDirectory(t, files, "Click <img src=\"img/a.png\" alt=\"start\"> and <img alt='stop' src='img/b%20c.png'> to stop.\n\n"+
+		"Write `<img src=\"img/a.png\">` to show it.\n\n<x-img @img/a.png #fig>The figure\n\nSee <x-ref fig>.\n")
+	html := doc.ToHTML()
+
+	assertNoErrors(t, doc)
+	for _, d := range doc.Diagnostics() {
+		t.Errorf("unexpected diagnostic in line %v: %v (%v)", d.Line, d.Msg, d.Code)
+	}
+	for _, want := range []string{
+		`<img src="builtassets/img/a.png" alt="start">`,
+		`<img alt='stop' src="builtassets/img/b%20c.png">`,
+		`<code>&lt;img src=&#34;img/a.png&#34;&gt;</code>`,
+		`<img src="builtassets/img/a.png" alt="The figure"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q not found in:\n%v", want, html)
+		}
+	}
+	if len(doc.assets) != 2 {
+		t.Errorf("got assets %v, want two", doc.assets)
+	}
+}
+
+func TestResponsiveImageCopies(t *testing.T) {
+	doc := newTestDocumentWithFiles(t)
+	dir := filepath.Dir(doc.fileName)
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeImage(filepath.Join(dir, "img", "arch.png"), ".png", image.NewRGBA(image.Rect(0, 0, 100, 50))); err != nil {
+		t.Fatal(err)
+	}
+
+	doc = newTestDocumentInDirectory(t, doc, "---\nimageWidths: [40, 200]\n---\n\n<x-img @img/arch.png #arch>Architecture\n\nSee <x-ref arch>.\n")
+	html := doc.ToHTML()
+	assertNoErrors(t, doc)
+	if want := `srcset="builtassets/img/arch-40w.png 40w, img/arch.png 100w"`; !strings.Contains(html, want) {
+		t.Errorf("%q not found in %q", want, html)
+	}
+
+	// Nothing is written next to the image while the document is processed
+	if _, err := os.Stat(filepath.Join(dir, "img", "arch-40w.png")); err == nil {
+		t.Errorf("copy of the image written next to it")
+	}
+
+	outputName := filepath.Join(t.TempDir(), "index.html")
+	if err := doc.CopyAssets(outputName); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(filepath.Dir(outputName), "builtassets", "img", "arch-40w.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 40 || config.Height != 20 {
+		t.Errorf("got a copy of %vx%v, want 40x20", config.Width, config.Height)
+	}
+}
+
+func TestOptimizeImage(t *testing.T) {
+	dir := t.TempDir()
+	optimizeImages = true
+	t.Cleanup(func() { optimizeImages = false })
+
+	// A PNG image without compression is written again smaller
+	f, err := os.Create(filepath.Join(dir, "plain.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(f, image.NewRGBA(image.Rect(0, 0, 100, 50)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := optimizeImage(filepath.Join(dir, "plain.png"), filepath.Join(dir, "out", "plain.png")); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(filepath.Join(dir, "plain.png"))
+	after, err := os.Stat(filepath.Join(dir, "out", "plain.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("got %v bytes, want less than %v", after.Size(), before.Size())
+	}
+
+	// The JPEG images with Exif metadata and the other files are copied as they are
+	tests := map[string]string{
+		"photo.jpg": "\xff\xd8\xff\xe1\x00\x10Exif\x00\x00",
+		"notes.txt": "Some notes.",
+	}
+	for name, content := range tests {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+		if err := optimizeImage(filepath.Join(dir, name), filepath.Join(dir, "out", name)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%v: got %q, want %q", name, got, content)
+		}
+	}
+}
@@ -0,0 +1,855 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hesusruiz/vcutils/yaml"
+)
+
+// BiblioEntry is a reference of the bibliography, cited in the text like '[[RFC9068]]'
+type BiblioEntry struct {
+	key       string
+	title     string
+	authors   []string // The names of the authors, like "Sporny, Manu" or "Manu Sporny"
+	date      string
+	href      string
+	doi       string
+	isbn      string
+	editors   []string // The names of the editors, written like the authors
+	publisher string
+	version   string
+	status    string // The maturity level of a specification, like "W3C Recommendation"
+	accessed  string // The date the online resource was accessed
+}
+
+// A citation of an entry of the bibliography, like '[[RFC9068]]' or '[[!RFC9068]]' for normative references
+var reCitation = regexp.MustCompile(`\[\[(!?)([0-9a-zA-Z-_\.]+)\]\]`)
+
+// The key in the YAML header with the file or list of files of the bibliography
+const bibliographyKey = "bibliography"
+
+// loadBibliography reads the entries of the bibliography files specified in the YAML header.
+// The files are in YAML, with an entry for each key, in BibTeX if their extension is '.bib',
+// or in CSL-JSON if their extension is '.json'.
+// The problems are reported in the given line, which is the end of the YAML header.
+func (doc *Document) loadBibliography(lineNum int) {
+	files := doc.config.ListString(bibliographyKey)
+	if name := doc.config.String(bibliographyKey); len(name) > 0 {
+		files = []string{name}
+	}
+
+	for _, name := range files {
+		fileName := doc.localFile(name)
+
+		var entries []*BiblioEntry
+		var err error
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".bib":
+			entries, err = readBibTeX(fileName)
+		case ".json":
+			entries, err = readCSLJSON(fileName)
+		default:
+			entries, err = readBiblioYAML(fileName)
+		}
+		if err != nil {
+			doc.warnf(lineNum, "bibliography", "error reading the bibliography '%v': %v", name, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if prev := doc.biblio[entry.key]; prev != nil {
+				doc.warnf(lineNum, "duplicate-bibliography-entry", "'%v' in '%v' already defined, it is ignored", entry.key, name)
+				continue
+			}
+
+			// The entries with only a DOI or ISBN are completed with their metadata from CrossRef
+			if len(entry.title) == 0 && (len(entry.doi) > 0 || len(entry.isbn) > 0) {
+				doc.resolveEntry(lineNum, entry)
+			}
+			if len(entry.title) == 0 && len(entry.isbn) > 0 {
+				entry.title = "ISBN " + entry.isbn
+			}
+			if len(entry.href) == 0 && len(entry.doi) > 0 {
+				entry.href = "https://doi.org/" + entry.doi
+			}
+			if len(entry.title) == 0 {
+				entry.title = entry.href
+			}
+			doc.biblio[entry.key] = entry
+		}
+	}
+}
+
+// readBiblioYAML reads a bibliography in YAML, where each key has the fields of an entry, like:
+//
+//	RFC9068:
+//	  title: JSON Web Token (JWT) Profile for OAuth 2.0 Access Tokens
+//	  date: October 2021
+//	  href: https://www.rfc-editor.org/info/rfc9068
+func readBiblioYAML(fileName string) ([]*BiblioEntry, error) {
+	y, err := yaml.ParseYamlFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*BiblioEntry
+	for key, value := range y.Map("") {
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("the entry '%v' is not a map of fields", key)
+		}
+		entry := &BiblioEntry{key: key}
+		for name, v := range fields {
+			// The authors can be a list of names
+			if list, isList := v.([]any); isList {
+				entry.setField(name, strings.Join(yaml.ToListString(list), " and "))
+				continue
+			}
+			entry.setField(name, fmt.Sprint(v))
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// setField sets a field of the entry from its name in the bibliography files.
+// Unknown fields are ignored.
+func (entry *BiblioEntry) setField(name string, value string) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(name) {
+	case "title":
+		entry.title = value
+	case "date":
+		entry.date = value
+	case "href", "url":
+		entry.href = value
+	case "doi":
+		entry.doi = value
+	case "isbn":
+		entry.isbn = value
+	case "author", "authors":
+		entry.authors = append(entry.authors, splitNames(value)...)
+	case "editor", "editors":
+		entry.editors = append(entry.editors, splitNames(value)...)
+	case "publisher":
+		entry.publisher = value
+	case "organization", "institution":
+		// BibTeX uses them as the publisher of some types of entries
+		if len(entry.publisher) == 0 {
+			entry.publisher = value
+		}
+	case "version", "edition":
+		entry.version = value
+	case "status":
+		entry.status = value
+	case "accessed", "urldate":
+		entry.accessed = value
+	}
+}
+
+// splitNames returns the names in a list of authors or editors, which are separated by 'and' like in BibTeX
+func splitNames(value string) []string {
+	names := []string{}
+	for _, name := range strings.Split(value, " and ") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// replaceCitations replaces the citations of the bibliography in the line by links to their entries.
+// The citations in code spans are written literally.
+func (doc *Document) replaceCitations(lineNum int, line string) string {
+	return mapOutsideCode(line, func(text string) string {
+		return doc.replaceCitationsInText(lineNum, text)
+	})
+}
+
+// replaceCitationsInText replaces the citations in a text without code spans
+func (doc *Document) replaceCitationsInText(lineNum int, text string) string {
+	return reCitation.ReplaceAllStringFunc(text, func(citation string) string {
+		key := reCitation.FindStringSubmatch(citation)[2]
+
+		// The entries which are not in the bibliography can be looked up in SpecRef
+		if doc.biblio[key] == nil && doc.specrefEntry(lineNum, key) == nil {
+			doc.errorf(lineNum, "unknown-citation", "'%v' is not in the bibliography", key)
+		}
+		if !contains(doc.citations, key) {
+			doc.citations = append(doc.citations, key)
+		}
+
+		return fmt.Sprintf("<cite><a class=\"bibref\" href=\"#bib_%v\">%v</a></cite>", key, doc.citationText(key))
+	})
+}
+
+// The styles of the citations and the entries of the bibliography, selected with 'citationStyle' in the YAML header.
+// By default, the citations are the keys of the entries, like '[RFC9068]'.
+const (
+	styleIEEE    = "ieee"    // Numbered in the order they are cited, like '[1]'
+	styleAPA     = "apa"     // Author and year, like '(Sporny et al., 2021)'
+	styleChicago = "chicago" // Author and year, like '(Sporny et al. 2021)'
+)
+
+// citationStyle returns the style of the citations selected in the YAML header
+func (doc *Document) citationStyle() string {
+	return strings.ToLower(doc.config.String("citationStyle"))
+}
+
+// citationText returns the text of the citation of an entry, which depends on the citation style
+func (doc *Document) citationText(key string) string {
+	entry := doc.biblio[key]
+
+	switch doc.citationStyle() {
+	case styleIEEE:
+		if n := doc.citationNumber(key); n > 0 {
+			return fmt.Sprintf("[%v]", n)
+		}
+	case styleAPA, styleChicago:
+		if entry == nil {
+			break
+		}
+		author := entry.title
+		if len(entry.authors) > 0 {
+			author, _ = splitName(entry.authors[0])
+			if len(entry.authors) == 2 && doc.citationStyle() == styleAPA {
+				family, _ := splitName(entry.authors[1])
+				author = author + " &amp; " + family
+			} else if len(entry.authors) >= 2 {
+				author = author + " et al."
+			}
+		}
+		if doc.citationStyle() == styleAPA {
+			return fmt.Sprintf("(%v, %v)", author, entry.year())
+		}
+		return fmt.Sprintf("(%v %v)", author, entry.year())
+	}
+
+	return "[" + key + "]"
+}
+
+// citationNumber returns the number of the entry in the numbered styles, which is the order it is cited first.
+// The entries which are not cited, written with 'bibliographyAll: true', are numbered after the cited ones,
+// in the order of their keys.
+func (doc *Document) citationNumber(key string) int {
+	for i, k := range doc.orderedEntries() {
+		if k == key {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// orderedEntries returns the keys of the entries in the order they are written in the bibliography,
+// which depends on the citation style.
+// Only the cited entries are written, unless all of them are requested with 'bibliographyAll: true' in the YAML header.
+func (doc *Document) orderedEntries() []string {
+	all := doc.config.Bool("bibliographyAll")
+
+	keys := []string{}
+	for key := range doc.biblio {
+		if all || contains(doc.citations, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	switch doc.citationStyle() {
+	case styleIEEE:
+		ordered := []string{}
+		for _, key := range doc.citations {
+			if doc.biblio[key] != nil {
+				ordered = append(ordered, key)
+			}
+		}
+		for _, key := range keys {
+			if !contains(ordered, key) {
+				ordered = append(ordered, key)
+			}
+		}
+		return ordered
+	case styleAPA, styleChicago:
+		sort.SliceStable(keys, func(i, j int) bool { return doc.biblio[keys[i]].sortName() < doc.biblio[keys[j]].sortName() })
+	}
+
+	return keys
+}
+
+// bibliographySection returns the list of the entries of the bibliography, in the order of the citation style
+func (doc *Document) bibliographySection() string {
+	keys := doc.orderedEntries()
+	if len(keys) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	style := doc.citationStyle()
+	template := doc.config.String("bibliographyTemplate")
+	render := func(entry *BiblioEntry) string {
+		if len(template) > 0 {
+			return entry.renderTemplate(template, style)
+		}
+		return entry.render(style)
+	}
+	if style == styleAPA || style == styleChicago {
+		sb.WriteString("<ul class=\"bibliography\">\n")
+		for _, key := range keys {
+			if entry := doc.biblio[key]; entry != nil {
+				sb.WriteString(fmt.Sprintf("<li id=\"bib_%v\">%v</li>\n", key, render(entry)))
+			}
+		}
+		sb.WriteString("</ul>\n")
+		return sb.String()
+	}
+
+	sb.WriteString("<dl class=\"bibliography\">\n")
+	for _, key := range keys {
+		entry := doc.biblio[key]
+		if entry == nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("<dt id=\"bib_%v\">%v</dt>\n<dd>%v</dd>\n", key, doc.citationText(key), render(entry)))
+	}
+	sb.WriteString("</dl>\n")
+
+	return sb.String()
+}
+
+// render returns the text of the entry in the bibliography, in the given citation style
+func (entry *BiblioEntry) render(style string) string {
+	title := html.EscapeString(entry.title)
+	date := html.EscapeString(entry.date)
+	publisher := html.EscapeString(entry.publisher)
+	version := html.EscapeString(entry.version)
+	status := html.EscapeString(entry.status)
+	accessed := html.EscapeString(entry.accessed)
+	href := ""
+	if len(entry.href) > 0 {
+		href = fmt.Sprintf("<a href=\"%v\">%v</a>", entry.href, html.EscapeString(entry.href))
+	}
+
+	authors := formatNames(entry.authors, style)
+	editors := formatNames(entry.editors, style)
+
+	// Add the optional parts to the text, ending each one with the punctuation
+	text := ""
+	add := func(format string, value string) {
+		if len(value) > 0 {
+			text = strings.TrimSpace(text + " " + fmt.Sprintf(format, value))
+		}
+	}
+
+	switch style {
+	case styleIEEE:
+		// The editors are written instead of the authors if there are no authors
+		if len(authors) > 0 {
+			add("%v,", joinNames(authors, "and"))
+			add("\"%v,\"", title)
+			add("%v,", editorsLabel(joinNames(editors, "and"), len(editors), ", Ed.", ", Eds."))
+		} else {
+			add("%v,", editorsLabel(joinNames(editors, "and"), len(editors), ", Ed.", ", Eds."))
+			add("\"%v,\"", title)
+		}
+		add("ver. %v,", version)
+		add("%v,", status)
+		add("%v,", publisher)
+		add("%v", date)
+		text = strings.TrimSuffix(text, ",") + "."
+		add("[Online]. Available: %v", href)
+		add("(accessed %v).", accessed)
+		return text
+	case styleAPA:
+		if len(authors) > 0 {
+			add("%v", joinNames(authors, "&amp;"))
+		} else if len(editors) > 0 {
+			add("%v.", editorsLabel(joinNames(editors, "&amp;"), len(editors), " (Ed.)", " (Eds.)"))
+		}
+		add("(%v).", entry.year())
+		add("<i>%v</i>", title)
+		add("(Version %v)", version)
+		text = text + "."
+		add("%v.", status)
+		add("%v.", publisher)
+		if len(accessed) > 0 && len(href) > 0 {
+			add("Retrieved %v, from", accessed)
+		}
+		add("%v", href)
+		return text
+	case styleChicago:
+		if len(authors) > 0 {
+			add("%v.", strings.TrimSuffix(joinNames(authors, "and"), "."))
+		} else if len(editors) > 0 {
+			add("%v", editorsLabel(joinNames(editors, "and"), len(editors), ", ed.", ", eds."))
+		}
+		add("%v.", entry.year())
+		add("\"%v.\"", title)
+		if len(authors) > 0 && len(editors) > 0 {
+			add("Edited by %v.", joinNames(formatNames(entry.editors, ""), "and"))
+		}
+		add("Version %v.", version)
+		add("%v.", status)
+		add("%v.", publisher)
+		add("Accessed %v.", accessed)
+		add("%v.", href)
+		return text
+	}
+
+	parts := []string{}
+	if len(authors) > 0 {
+		parts = append(parts, fmt.Sprintf("<span class=\"refAuthor\">%v</span>", joinNames(authors, "and")))
+	}
+	if len(editors) > 0 {
+		parts = append(parts, fmt.Sprintf("<span class=\"refEditor\">%v</span> (editors)", joinNames(editors, "and")))
+	}
+	if len(title) > 0 {
+		parts = append(parts, fmt.Sprintf("<span class=\"refTitle\">\"%v\"</span>", title))
+	}
+	for _, part := range []string{version, status, publisher} {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	if len(date) > 0 {
+		parts = append(parts, fmt.Sprintf("<time>%v</time>", date))
+	}
+	if len(href) > 0 {
+		parts = append(parts, fmt.Sprintf("<span>&lt;%v&gt;</span>", href))
+	}
+	if len(accessed) > 0 {
+		parts = append(parts, "accessed "+accessed)
+	}
+	return strings.Join(parts, ", ") + "."
+}
+
+// editorsLabel returns the names of the editors followed by the abbreviation for one or several editors,
+// or the empty string if there are no editors.
+// The abbreviations include the separator from the names, like ", Eds.".
+func editorsLabel(names string, count int, one string, several string) string {
+	switch {
+	case count == 0:
+		return ""
+	case count == 1:
+		return names + one
+	}
+	return names + several
+}
+
+// formatNames returns the names of the authors or editors of an entry, written in the citation style
+func formatNames(names []string, style string) []string {
+	formatted := []string{}
+	for i, name := range names {
+		family, given := splitName(name)
+		switch {
+		case style == styleIEEE:
+			formatted = append(formatted, strings.TrimSpace(initials(given)+" "+family))
+		case style == styleAPA:
+			formatted = append(formatted, strings.TrimSuffix(family+", "+initials(given), ", "))
+		case style == styleChicago && i == 0:
+			formatted = append(formatted, strings.TrimSuffix(family+", "+given, ", "))
+		case style == styleChicago:
+			formatted = append(formatted, strings.TrimSpace(given+" "+family))
+		default:
+			formatted = append(formatted, name)
+		}
+	}
+	for i := range formatted {
+		formatted[i] = html.EscapeString(formatted[i])
+	}
+	return formatted
+}
+
+// A field in the template of the entries of the bibliography, like '{title}'
+var reTemplateField = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// An optional part of the template of the entries, like '[, {publisher}]', which is written only
+// if all the fields in it have a value
+var reTemplateOptional = regexp.MustCompile(`\[([^\[\]]*)\]`)
+
+// renderTemplate returns the text of the entry using the template specified with 'bibliographyTemplate' in
+// the YAML header, like '{authors}. <i>{title}</i>[, {publisher}], {date}.[ {href}]'.
+// The fields are the ones of the entries and also {key} and {year}, and the names are written in the citation style.
+func (entry *BiblioEntry) renderTemplate(template string, style string) string {
+	fields := map[string]string{
+		"key":       html.EscapeString(entry.key),
+		"title":     html.EscapeString(entry.title),
+		"authors":   joinNames(formatNames(entry.authors, style), "and"),
+		"editors":   joinNames(formatNames(entry.editors, style), "and"),
+		"publisher": html.EscapeString(entry.publisher),
+		"version":   html.EscapeString(entry.version),
+		"status":    html.EscapeString(entry.status),
+		"date":      html.EscapeString(entry.date),
+		"year":      entry.year(),
+		"accessed":  html.EscapeString(entry.accessed),
+		"href":      "",
+	}
+	if len(entry.href) > 0 {
+		fields["href"] = fmt.Sprintf("<a href=\"%v\">%v</a>", entry.href, html.EscapeString(entry.href))
+	}
+
+	replace := func(text string) string {
+		return reTemplateField.ReplaceAllStringFunc(text, func(field string) string {
+			return fields[field[1:len(field)-1]]
+		})
+	}
+
+	text := reTemplateOptional.ReplaceAllStringFunc(template, func(optional string) string {
+		for _, m := range reTemplateField.FindAllStringSubmatch(optional, -1) {
+			if len(fields[m[1]]) == 0 {
+				return ""
+			}
+		}
+		return replace(optional[1 : len(optional)-1])
+	})
+
+	return replace(text)
+}
+
+// A year in a date
+var reYear = regexp.MustCompile(`\b[0-9]{4}\b`)
+
+// year returns the year of the entry, or "n.d." if it has no date
+func (entry *BiblioEntry) year() string {
+	if y := reYear.FindString(entry.date); len(y) > 0 {
+		return y
+	}
+	return "n.d."
+}
+
+// sortName returns the text used to sort the entries by author, which is the family name of the first author
+// or the title
+func (entry *BiblioEntry) sortName() string {
+	if entry == nil {
+		return ""
+	}
+	if len(entry.authors) > 0 {
+		family, given := splitName(entry.authors[0])
+		return strings.ToLower(family + " " + given + " " + entry.year())
+	}
+	return strings.ToLower(entry.title)
+}
+
+// splitName returns the family and given names of a person, written like "Sporny, Manu" or "Manu Sporny"
+func splitName(name string) (family string, given string) {
+	if before, after, found := strings.Cut(name, ","); found {
+		return strings.TrimSpace(before), strings.TrimSpace(after)
+	}
+	fields := strings.Fields(name)
+	if len(fields) <= 1 {
+		return name, ""
+	}
+	return fields[len(fields)-1], strings.Join(fields[:len(fields)-1], " ")
+}
+
+// initials returns the initials of the given names, like "M. A." for "Manu Alex"
+func initials(given string) string {
+	parts := []string{}
+	for _, name := range strings.Fields(given) {
+		r := []rune(name)
+		parts = append(parts, string(r[0])+".")
+	}
+	return strings.Join(parts, " ")
+}
+
+// joinNames joins a list of names with commas and the conjunction before the last one
+func joinNames(names []string, conjunction string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " " + conjunction + " " + names[1]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", " + conjunction + " " + names[len(names)-1]
+}
+
+// The placeholder where the bibliography is written, replaced when the whole document has been processed
+const bibliographyPlaceholder = "{#bibliography}"
+
+// startsWithBibliography returns true if the line is the <x-bibliography> tag, which marks where the bibliography is written
+func (doc *Document) startsWithBibliography(lineNum int) bool {
+	return strings.HasPrefix(doc.lines[lineNum], "<x-bibliography")
+}
+
+// processBibliography writes the placeholder of the bibliography, which is generated when all the citations are known
+func (doc *Document) processBibliography(lineNum int) int {
+	doc.sb.WriteString(doc.indentStr(lineNum) + bibliographyPlaceholder + "\n")
+	return lineNum + 1
+}
+
+// readBibTeX reads a bibliography in BibTeX format
+func readBibTeX(fileName string) ([]*BiblioEntry, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return parseBibTeX(string(src))
+}
+
+// The months in BibTeX, which are usually written with their abbreviations
+var bibtexMonths = map[string]string{
+	"jan": "January", "feb": "February", "mar": "March", "apr": "April", "may": "May", "jun": "June",
+	"jul": "July", "aug": "August", "sep": "September", "oct": "October", "nov": "November", "dec": "December",
+}
+
+// parseBibTeX returns the entries of a bibliography in BibTeX format, like:
+//
+//	@misc{RFC9068,
+//	  title = {{JSON Web Token (JWT) Profile for OAuth 2.0 Access Tokens}},
+//	  year = 2021, month = oct,
+//	  url = {https://www.rfc-editor.org/info/rfc9068}
+//	}
+//
+// The text outside the entries is ignored, like in BibTeX, and so are the @comment and @preamble entries.
+// The strings defined with @string can be used in the values of the fields.
+func parseBibTeX(src string) ([]*BiblioEntry, error) {
+	p := &bibtexParser{src: src, strings: map[string]string{}}
+	for k, v := range bibtexMonths {
+		p.strings[k] = v
+	}
+
+	var entries []*BiblioEntry
+
+	for {
+		at := strings.IndexByte(p.src[p.pos:], '@')
+		if at < 0 {
+			return entries, nil
+		}
+		p.pos += at + 1
+
+		typ := strings.ToLower(p.ident())
+		p.skipSpace()
+		if p.pos >= len(p.src) || (p.src[p.pos] != '{' && p.src[p.pos] != '(') {
+			return nil, p.errorf("expected '{' after '@%v'", typ)
+		}
+		closing := byte('}')
+		if p.src[p.pos] == '(' {
+			closing = ')'
+		}
+		p.pos++
+
+		switch typ {
+		case "comment", "preamble":
+			p.pos--
+			if _, err := p.braced(); err != nil {
+				return nil, err
+			}
+			continue
+		case "string":
+			fields, err := p.fields(closing)
+			if err != nil {
+				return nil, err
+			}
+			for name, value := range fields {
+				p.strings[name] = value
+			}
+			continue
+		}
+
+		p.skipSpace()
+		end := strings.IndexAny(p.src[p.pos:], ",}")
+		if end < 0 {
+			return nil, p.errorf("no key for the entry '@%v'", typ)
+		}
+		key := strings.TrimSpace(p.src[p.pos : p.pos+end])
+		p.pos += end
+		if p.src[p.pos] == ',' {
+			p.pos++
+		}
+
+		fields, err := p.fields(closing)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, bibtexEntry(key, fields))
+	}
+}
+
+// bibtexEntry builds an entry of the bibliography with the fields of a BibTeX entry
+func bibtexEntry(key string, fields map[string]string) *BiblioEntry {
+	entry := &BiblioEntry{key: key}
+	for name, value := range fields {
+		entry.setField(name, value)
+	}
+
+	if len(entry.date) == 0 && len(fields["year"]) > 0 {
+		entry.date = strings.TrimSpace(fields["month"] + " " + fields["year"])
+	}
+
+	return entry
+}
+
+// bibtexParser reads the entries of a BibTeX file
+type bibtexParser struct {
+	src     string
+	pos     int
+	strings map[string]string // The values of the strings defined with @string, and the months
+}
+
+func (p *bibtexParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("line %v: %v", line, fmt.Sprintf(format, args...))
+}
+
+func (p *bibtexParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// ident reads a name, like the type of an entry or the name of a field
+func (p *bibtexParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n{}(),=#\"", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// fields reads the fields of an entry until the closing character, like 'title = {The title}, year = 2021'
+func (p *bibtexParser) fields(closing byte) (map[string]string, error) {
+	fields := map[string]string{}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("entry not closed")
+		}
+		if p.src[p.pos] == closing {
+			p.pos++
+			return fields, nil
+		}
+		if p.src[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+
+		name := strings.ToLower(p.ident())
+		p.skipSpace()
+		if len(name) == 0 || p.pos >= len(p.src) || p.src[p.pos] != '=' {
+			return nil, p.errorf("expected 'name = value' in the entry")
+		}
+		p.pos++
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+}
+
+// value reads the value of a field, which can be concatenated parts with '#'
+func (p *bibtexParser) value() (string, error) {
+	var sb strings.Builder
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return "", p.errorf("no value for the field")
+		}
+
+		switch p.src[p.pos] {
+		case '{':
+			part, err := p.braced()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(part)
+		case '"':
+			p.pos++
+			start := p.pos
+			depth := 0
+			for ; p.pos < len(p.src) && (p.src[p.pos] != '"' || depth > 0); p.pos++ {
+				switch p.src[p.pos] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unclosed quote in value")
+			}
+			sb.WriteString(p.src[start:p.pos])
+			p.pos++
+		default:
+			// A number or the name of a string
+			name := p.ident()
+			if value, found := p.strings[strings.ToLower(name)]; found {
+				sb.WriteString(value)
+			} else {
+				sb.WriteString(name)
+			}
+		}
+
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '#' {
+			p.pos++
+			continue
+		}
+
+		return cleanBibTeX(sb.String()), nil
+	}
+}
+
+// braced reads a value between braces, which may have nested braces, and returns it without the outer braces
+func (p *bibtexParser) braced() (string, error) {
+	start := p.pos + 1
+	depth := 0
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.src[start : p.pos-1], nil
+			}
+		}
+	}
+	return "", p.errorf("unclosed brace in value")
+}
+
+// The LaTeX commands for the special characters most used in BibTeX files
+var bibtexReplacer = strings.NewReplacer(
+	`\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#", `--`, "–", `~`, " ",
+	"{", "", "}", "",
+)
+
+// The letters with the LaTeX accents, by the command of the accent and the letter
+var bibtexAccents = map[string]string{
+	"'a": "á", "'e": "é", "'i": "í", "'o": "ó", "'u": "ú", "'y": "ý", "'A": "Á", "'E": "É", "'I": "Í", "'O": "Ó", "'U": "Ú",
+	"`a": "à", "`e": "è", "`i": "ì", "`o": "ò", "`u": "ù", "`A": "À", "`E": "È", "`I": "Ì", "`O": "Ò", "`U": "Ù",
+	"^a": "â", "^e": "ê", "^i": "î", "^o": "ô", "^u": "û", "^A": "Â", "^E": "Ê", "^I": "Î", "^O": "Ô", "^U": "Û",
+	`"a`: "ä", `"e`: "ë", `"i`: "ï", `"o`: "ö", `"u`: "ü", `"y`: "ÿ", `"A`: "Ä", `"E`: "Ë", `"I`: "Ï", `"O`: "Ö", `"U`: "Ü",
+	"~n": "ñ", "~a": "ã", "~o": "õ", "~N": "Ñ", "~A": "Ã", "~O": "Õ",
+	"cc": "ç", "cC": "Ç",
+}
+
+// The accents of LaTeX, like '\'e', '\'{e}', '\'{\i}' or '\c{c}'
+var reBibTeXAccent = regexp.MustCompile(`\\(['` + "`" + `^"~]|c\b)\s*(?:\{\s*(\\i|[A-Za-z])\s*\}|([A-Za-z]))`)
+
+// cleanBibTeX removes the braces and the most common LaTeX commands from a value, and collapses the blank space
+func cleanBibTeX(value string) string {
+	value = reBibTeXAccent.ReplaceAllStringFunc(value, func(accent string) string {
+		m := reBibTeXAccent.FindStringSubmatch(accent)
+		letter := strings.TrimPrefix(m[2]+m[3], "\\")
+		if char, found := bibtexAccents[m[1]+letter]; found {
+			return char
+		}
+		return letter
+	})
+	return strings.Join(strings.Fields(bibtexReplacer.Replace(value)), " ")
+}
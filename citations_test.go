@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDocumentWithBibliography returns the document with the source, whose YAML header can refer to
+// the bibliography 'biblio.yaml' in the same directory
+func newTestDocumentWithBibliography(t *testing.T, src string) *Document {
+	t.Helper()
+	dir := t.TempDir()
+	bibliography := "RFC9068:\n  title: JWT Profile for OAuth 2.0 Access Tokens\n  authors: [Vittorio Bertocci]\n  date: October 2021\n" +
+		"VC:\n  title: Verifiable Credentials Data Model\n  authors: [Manu Sporny, Dave Longley, David Chadwick]\n  date: 2022-03-03\n"
+	if err := os.WriteFile(filepath.Join(dir, "biblio.yaml"), []byte(bibliography), 0664); err != nil {
+		t.Fatal(err)
+	}
+	return newDocument(filepath.Join(dir, "doc.rite"), bufio.NewScanner(strings.NewReader(src)), nil)
+}
+
+func TestCitations(t *testing.T) {
+	header := "---\nbibliography: biblio.yaml\n"
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"key",
+			header + "---\n\nAs in [[RFC9068]].\n",
+			[]string{`<cite><a class="bibref" href="#bib_RFC9068">[RFC9068]</a></cite>`, `id="bib_RFC9068"`},
+		},
+		{
+			"normative",
+			header + "---\n\nAs in [[!RFC9068]].\n",
+			[]string{`<cite><a class="bibref" href="#bib_RFC9068">[RFC9068]</a></cite>`},
+		},
+		{
+			"in a list item and a note",
+			header + "---\n\n- As in [[RFC9068]].\n- And in [[VC]].\n\n<note>\n    See [[VC]].\n",
+			[]string{`href="#bib_RFC9068">[RFC9068]</a></cite>`, `href="#bib_VC">[VC]</a></cite>`},
+		},
+		{
+			"in a code span",
+			header + "---\n\nWrite `[[RFC9068]]` to cite it.\n",
+			[]string{"<code>[[RFC9068]]</code>"},
+		},
+		{
+			"numbered",
+			header + "citationStyle: ieee\n---\n\nAs in [[VC]] and [[RFC9068]], and again [[VC]].\n",
+			[]string{`href="#bib_VC">[1]</a></cite>`, `href="#bib_RFC9068">[2]</a></cite>`},
+		},
+		{
+			"author and year",
+			header + "citationStyle: apa\n---\n\nAs in [[VC]] and [[RFC9068]].\n",
+			[]string{`href="#bib_VC">(Sporny et al., 2022)</a></cite>`, `href="#bib_RFC9068">(Bertocci, 2021)</a></cite>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocumentWithBibliography(t, tt.src)
+			html := doc.ToHTML()
+
+			assertNoErrors(t, doc)
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("%q not found in:\n%v", want, html)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownCitation(t *testing.T) {
+	doc := newTestDocumentWithBibliography(t, "---\nbibliography: biblio.yaml\n---\n\nAs in [[RFC0000]].\n")
+	html := doc.ToHTML()
+
+	if !hasDiagnostic(doc, "unknown-citation", SeverityError) {
+		t.Errorf("no error for the unknown citation, diagnostics: %v", doc.diagnostics)
+	}
+	if want := `<cite><a class="bibref" href="#bib_RFC0000">[RFC0000]</a></cite>`; !strings.Contains(html, want) {
+		t.Errorf("%q not found in:\n%v", want, html)
+	}
+}
+
+func TestParseBibTeX(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		key     string
+		title   string
+		authors []string
+		date    string
+		pub     string
+	}{
+		{
+			name:  "nested braces",
+			src:   "@misc{RFC9068,\n  title = {{JSON Web Token ({JWT}) Profile}},\n  year = 2021, month = oct\n}",
+			key:   "RFC9068",
+			title: "JSON Web Token (JWT) Profile",
+			date:  "October 2021",
+		},
+		{
+			name:  "quoted value with braces",
+			src:   `@book{Knuth, title = "The {\TeX}book", year = "1984"}`,
+			key:   "Knuth",
+			title: `The \TeXbook`,
+			date:  "1984",
+		},
+		{
+			name:  "string definitions",
+			src:   "@string{ietf = {Internet Engineering Task Force}}\n@techreport(RFC2119, title = {Key words}, institution = ietf # { (IETF)})",
+			key:   "RFC2119",
+			title: "Key words",
+			pub:   "Internet Engineering Task Force (IETF)",
+		},
+		{
+			name:    "authors separated by and",
+			src:     "@article{VC, title = {VC}, author = {Sporny, Manu and Dave Longley and\n    David Chadwick}}",
+			key:     "VC",
+			title:   "VC",
+			authors: []string{"Sporny, Manu", "Dave Longley", "David Chadwick"},
+		},
+		{
+			name:    "accents",
+			src:     `@misc{ES, title = {Espa\~nol y {\'e}l}, author = {Jes\'{u}s Ru\'iz and Fran\c{c}ois M\"{u}ller and Mar\'{\i}a}}`,
+			key:     "ES",
+			title:   "Español y él",
+			authors: []string{"Jesús Ruíz", "François Müller", "María"},
+		},
+		{
+			name:  "comments and text outside the entries",
+			src:   "Some text.\n@comment{ @misc{Ignored, title = {No}} }\n@misc{Kept, title = {Yes}}",
+			key:   "Kept",
+			title: "Yes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseBibTeX(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %v entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry.key != tt.key || entry.title != tt.title || entry.date != tt.date || entry.publisher != tt.pub {
+				t.Errorf("got key %q, title %q, date %q and publisher %q, want %q, %q, %q and %q",
+					entry.key, entry.title, entry.date, entry.publisher, tt.key, tt.title, tt.date, tt.pub)
+			}
+			if strings.Join(entry.authors, "|") != strings.Join(tt.authors, "|") {
+				t.Errorf("got authors %q, want %q", entry.authors, tt.authors)
+			}
+		})
+	}
+}
+
+func TestParseBibTeXErrors(t *testing.T) {
+	tests := []string{
+		"@misc{A, title = {Not closed}",
+		"@misc{A, title {No equal sign}}",
+		"@misc A, title = {No brace}}",
+	}
+	for _, src := range tests {
+		if _, err := parseBibTeX(src); err == nil {
+			t.Errorf("no error parsing %q", src)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// assetFiles returns the files in the assets directory which the document uses when it is written to the
+// output file: the copies of the local and remote assets, and the smaller copies of the images
+func (doc *Document) assetFiles(outputFileName string) []string {
+	files := []string{}
+	for _, target := range doc.assets {
+		files = append(files, filepath.Join(filepath.Dir(outputFileName), filepath.FromSlash(target)))
+	}
+	for target := range doc.imageCopies {
+		files = append(files, filepath.Join(filepath.Dir(outputFileName), filepath.FromSlash(target)))
+	}
+	return files
+}
+
+// referencedAssets processes a document, or all the documents in a directory, without writing them, and adds to
+// used the files in the assets directories which they use. It returns the assets directories of their output files.
+func referencedAssets(inputName string, used map[string]bool, logger Logger) ([]string, error) {
+
+	info, err := os.Stat(inputName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		var b *Document
+		if aborted := catchFatal(func() {
+			b = NewDocumentFromFile(inputName, logger)
+			b.ToHTML()
+		}); aborted != nil {
+			b = aborted
+		}
+		b.ReportDiagnostics()
+		if len(b.Errors()) > 0 {
+			return nil, fmt.Errorf("errors processing %v", inputName)
+		}
+		outputFileName := defaultOutputName(inputName, ".html")
+		for _, file := range b.assetFiles(outputFileName) {
+			used[file] = true
+		}
+		return []string{filepath.Join(filepath.Dir(outputFileName), builtAssetsDir)}, nil
+	}
+
+	site, err := NewSiteFromDirectory(inputName, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := site.Generate(true); err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, page := range site.pages {
+		outputFileName := filepath.Join(site.dir, page.outputName)
+		for _, file := range page.doc.assetFiles(outputFileName) {
+			used[file] = true
+		}
+		dirs = append(dirs, filepath.Join(filepath.Dir(outputFileName), builtAssetsDir))
+	}
+	return dirs, nil
+}
+
+// pruneAssets removes the files in the assets directories which are not used, and then the directories which
+// are left empty. It returns the files removed, or the files which would be removed if dryrun is true.
+func pruneAssets(dirs []string, used map[string]bool, dryrun bool) ([]string, error) {
+	removed := []string{}
+	seen := map[string]bool{}
+
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		subdirs := []string{}
+		err := filepath.WalkDir(dir, func(fileName string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && fileName == dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				subdirs = append(subdirs, fileName)
+				return nil
+			}
+			if used[fileName] {
+				return nil
+			}
+			removed = append(removed, fileName)
+			if dryrun {
+				return nil
+			}
+			return os.Remove(fileName)
+		})
+		if err != nil {
+			return removed, err
+		}
+
+		// The directories are removed from the deepest ones, and only if they are empty
+		if !dryrun {
+			sort.Sort(sort.Reverse(sort.StringSlice(subdirs)))
+			for _, subdir := range subdirs {
+				os.Remove(subdir)
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// processClean removes the files in the assets directories which are not used any more by the documents,
+// like the old copies of the assets with a hash of their content in the name. The documents are processed with
+// the assets copied, and must be processed with the same options as when they are generated.
+func processClean(c *cli.Context) error {
+	dryrun := c.Bool("dryrun")
+	copyAssets = true
+	downloadImages = c.Bool("download-images")
+	fingerprintAssets = c.Bool("fingerprint-assets")
+	noNetwork = c.Bool("no-network")
+	httpTimeout = c.Duration("http-timeout")
+	httpRetries = c.Int("http-retries")
+	if err := setupTLS(c.String("ca-cert"), c.Bool("insecure")); err != nil {
+		return fmt.Errorf("invalid --ca-cert: %w", err)
+	}
+	diagFormat = c.String("diag-format")
+
+	inputNames := c.Args().Slice()
+	if len(inputNames) == 0 {
+		inputNames = []string{"index.txt"}
+	}
+
+	config := zap.NewDevelopmentConfig()
+	config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	config.DisableCaller = true
+	config.DisableStacktrace = true
+	z, err := config.Build()
+	if err != nil {
+		return err
+	}
+	sugar := z.Sugar()
+	defer sugar.Sync()
+
+	// All the documents are processed before removing anything, because they can share the assets directories
+	used := map[string]bool{}
+	dirs := []string{}
+	for _, inputName := range inputNames {
+		inputDirs, err := referencedAssets(inputName, used, sugar)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, inputDirs...)
+	}
+
+	removed, err := pruneAssets(dirs, used, dryrun)
+	for _, fileName := range removed {
+		if dryrun {
+			fmt.Println("would remove", filepath.ToSlash(fileName))
+		} else {
+			fmt.Println("removed", filepath.ToSlash(fileName))
+		}
+	}
+	return err
+}
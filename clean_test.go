@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPruneAssets(t *testing.T) {
+	withCopyAssets(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"doc.rite":                    "<img src=\"img/a.png\" alt=\"A\">\n",
+		"img/a.png":                   "a",
+		"builtassets/img/a.png":       "a",
+		"builtassets/img/old.png":     "old",
+		"builtassets/diagrams/b.svg":  "b",
+		"other/builtassets/other.png": "other",
+	}
+	for name, content := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	used := map[string]bool{}
+	dirs, err := referencedAssets(filepath.Join(dir, "doc.rite"), used, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is removed in a dry run
+	removed, err := pruneAssets(dirs, used, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("got %v files to remove in a dry run, want 2", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "builtassets", "img", "old.png")); err != nil {
+		t.Errorf("file removed in a dry run: %v", err)
+	}
+
+	removed, err = pruneAssets(dirs, used, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	want := []string{filepath.Join(dir, "builtassets", "diagrams", "b.svg"), filepath.Join(dir, "builtassets", "img", "old.png")}
+	if len(removed) != len(want) || removed[0] != want[0] || removed[1] != want[1] {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+
+	for _, name := range []string{"builtassets/img/a.png", "img/a.png", "other/builtassets/other.png"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%v removed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "builtassets", "diagrams")); err == nil {
+		t.Errorf("empty directory not removed")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// The attribute of a <pre> block to number its lines, like '<pre linenos><code class="language-go">'
+var reLineNumbersAttr = regexp.MustCompile(`(^|\s)linenos(\s|$)`)
+
+// preprocessLineNumbers returns true if the lines of the code block must be numbered, because the tag has the
+// 'linenos' attribute or the YAML header has 'codeLineNumbers: true'. The attribute is removed from the tag,
+// which gets the 'linenos' class instead.
+func (doc *Document) preprocessLineNumbers(tagFields map[string]string) bool {
+	numbered := doc.config.Bool("codeLineNumbers")
+	if reLineNumbersAttr.MatchString(tagFields["stdFields"]) {
+		tagFields["stdFields"] = strings.TrimSpace(reLineNumbersAttr.ReplaceAllString(tagFields["stdFields"], " "))
+		if len(tagFields["stdFields"]) == 0 {
+			delete(tagFields, "stdFields")
+		}
+		numbered = true
+	}
+	if numbered {
+		tagFields["class"] = strings.TrimSpace(tagFields["class"] + " linenos")
+	}
+	return numbered
+}
+
+// lineNumbers returns the column with the numbers of the lines of a code block, which is written before
+// the code so the highlighting of the code does not remove it
+func lineNumbers(count int) string {
+	numbers := make([]string, count)
+	for i := range numbers {
+		numbers[i] = fmt.Sprint(i + 1)
+	}
+	return fmt.Sprintf("<span class=\"linenos\" aria-hidden=\"true\">%v</span>", strings.Join(numbers, "\n"))
+}
+
+// The attribute of a <pre> block with the lines to highlight, like '<pre hl=3,7-9>'
+var reHighlightAttr = regexp.MustCompile(`(^|\s)hl="?([^"\s]*)"?(\s|$)`)
+
+// preprocessHighlightLines returns the numbers of the lines of the code block which must be highlighted,
+// specified with the 'hl' attribute as a list of lines and ranges of lines, like '<pre hl=3,7-9>'.
+// The attribute is removed from the tag, which gets the 'hl' class instead.
+func (doc *Document) preprocessHighlightLines(lineNum int, tagFields map[string]string) map[int]bool {
+	m := reHighlightAttr.FindStringSubmatch(tagFields["stdFields"])
+	if m == nil {
+		return nil
+	}
+	tagFields["stdFields"] = strings.TrimSpace(reHighlightAttr.ReplaceAllString(tagFields["stdFields"], " "))
+	if len(tagFields["stdFields"]) == 0 {
+		delete(tagFields, "stdFields")
+	}
+
+	lines := map[int]bool{}
+	for _, r := range strings.Split(m[2], ",") {
+		var first, last int
+		if _, err := fmt.Sscanf(r, "%d-%d", &first, &last); err != nil {
+			if _, err := fmt.Sscanf(r, "%d", &first); err != nil {
+				doc.warnf(lineNum, "code", "invalid lines to highlight '%v', use a list like '3,7-9'", m[2])
+				continue
+			}
+			last = first
+		}
+		for i := first; i <= last; i++ {
+			lines[i] = true
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	tagFields["class"] = strings.TrimSpace(tagFields["class"] + " hl")
+	return lines
+}
+
+// highlightedLines returns the marks of the highlighted lines of a code block, which are shown over the code
+// with the same lines so the highlighting of the code does not remove them
+func highlightedLines(count int, lines map[int]bool) string {
+	marks := make([]string, count)
+	for i := range marks {
+		if lines[i+1] {
+			marks[i] = "<span> </span>"
+		}
+	}
+	return fmt.Sprintf("<span class=\"hl-lines\" aria-hidden=\"true\">%v</span>", strings.Join(marks, "\n"))
+}
+
+// The script which adds a button to copy the content of the code blocks, included in the template if requested
+// with 'copyCode: true' in the YAML header. The blocks with the 'no-copy' class, and the diagrams, do not get the button.
+// The labels of the button are the arguments of the format.
+const copyCodeScript = `<script>
+document.querySelectorAll("pre:not(.no-copy):not(.mermaid)").forEach(function (pre) {
+  var label = %q, copied = %q;
+  var button = document.createElement("button");
+  button.type = "button";
+  button.className = "copy-code";
+  button.textContent = label;
+  button.addEventListener("click", function () {
+    var code = pre.cloneNode(true);
+    code.querySelectorAll(".linenos, .hl-lines").forEach(function (el) { el.remove(); });
+    navigator.clipboard.writeText(code.textContent).then(function () {
+      button.textContent = copied;
+      setTimeout(function () { button.textContent = label; }, 2000);
+    });
+  });
+  var container = document.createElement("div");
+  container.className = "code-block";
+  pre.parentNode.insertBefore(container, pre);
+  container.appendChild(pre);
+  container.appendChild(button);
+});
+</script>
+`
+
+// The markers of the regions of a source file, like '// #region auth' and '// #endregion', in any kind of comment
+var (
+	reRegionStart = regexp.MustCompile(`#region\s+([0-9a-zA-Z-_\.]+)`)
+	reRegionEnd   = regexp.MustCompile(`#endregion\b`)
+)
+
+// diffLine returns the line of a block with the 'diff' class marked as added, removed or the start of a hunk
+func diffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return "<span class=\"diff-add\">" + line + "</span>"
+	case strings.HasPrefix(line, "-"):
+		return "<span class=\"diff-del\">" + line + "</span>"
+	case strings.HasPrefix(line, "@@"):
+		return "<span class=\"diff-hunk\">" + line + "</span>"
+	}
+	return line
+}
+
+// preprocessCodeInclude inserts the content of a source file in the <pre> block started in the line, like in
+// '<pre @../examples/client.go>', so the examples in the document are the real code. Only a part of the file
+// can be included: a region marked in the file, like in '<pre @client.go region=auth>', or a range of lines,
+// like in '<pre @client.go lines=10-25>'. With 'from=file', the block has the differences between both files.
+// It returns true if the content of a file was inserted.
+func (doc *Document) preprocessCodeInclude(lineNum int) bool {
+	tagFields := doc.preprocessTagSpec(lineNum)
+	ref := tagFields["src"]
+	if len(ref) == 0 {
+		return false
+	}
+	region := stdAttribute(tagFields["stdFields"], "region")
+	lines := stdAttribute(tagFields["stdFields"], "lines")
+	from := stdAttribute(tagFields["stdFields"], "from")
+
+	// The attributes are for rite, and they are not written in the <pre> tag
+	doc.lines[lineNum] = removeTagFields(doc.lines[lineNum], "@", "region=", "lines=", "from=")
+
+	current := doc.sources[len(doc.sources)-1]
+	name, err := resolveInclude(current.fileName, ref)
+	if err != nil {
+		doc.errorf(lineNum, "include", "error including '%v': %v", ref, err)
+		return false
+	}
+
+	content, err := readInclude(name)
+	if err != nil {
+		doc.errorf(lineNum, "include", "error including '%v': %v", name, err)
+		return false
+	}
+
+	code, firstLine, err := selectCode(string(content), region, lines)
+	if err != nil {
+		doc.errorf(lineNum, "include", "error including '%v': %v", name, err)
+		return false
+	}
+
+	// The block can show the differences with a previous version of the file, like in '<pre .diff @new.json from=old.json>'
+	if len(from) > 0 {
+		oldName, err := resolveInclude(current.fileName, from)
+		if err != nil {
+			doc.errorf(lineNum, "include", "error including '%v': %v", from, err)
+			return false
+		}
+		oldContent, err := readInclude(oldName)
+		if err != nil {
+			doc.errorf(lineNum, "include", "error including '%v': %v", oldName, err)
+			return false
+		}
+		oldCode, _, err := selectCode(string(oldContent), region, lines)
+		if err != nil {
+			doc.errorf(lineNum, "include", "error including '%v': %v", oldName, err)
+			return false
+		}
+		code = strings.Join(unifiedDiff(strings.Split(oldCode, "\n"), strings.Split(code, "\n"), 3), "\n")
+		firstLine = 0
+
+		if len(tagFields["class"]) == 0 && !strings.Contains(tagFields["stdFields"], "class=") {
+			line := doc.lines[lineNum]
+			doc.lines[lineNum] = line[:1+len(tagFields["tag"])] + " .diff" + line[1+len(tagFields["tag"]):]
+		}
+	}
+
+	// The code is indented under the tag, so it is the content of the block
+	doc.pushSource(&lineSource{
+		scanner:     bufio.NewScanner(strings.NewReader(code)),
+		fileName:    name,
+		indentation: strings.Repeat(" ", doc.indentations[lineNum]+4),
+		lineNum:     firstLine,
+	})
+
+	return true
+}
+
+// removeTagFields returns the line without the fields of the tag which start with any of the prefixes
+func removeTagFields(line string, prefixes ...string) string {
+	spec, rest := line, ""
+	if end := strings.IndexRune(line, endTagFor[rune(line[0])]); end >= 0 {
+		spec, rest = line[:end], line[end:]
+	}
+
+	fields := []string{}
+	for _, f := range strings.Fields(spec) {
+		keep := true
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(f, prefix) {
+				keep = false
+			}
+		}
+		if keep {
+			fields = append(fields, f)
+		}
+	}
+
+	return strings.Join(fields, " ") + rest
+}
+
+// selectCode returns the lines of the source code in the region or the range of lines, or all of them if both
+// are empty, and the number of lines before the first one. The markers of the regions are removed, the common
+// indentation of the lines too, and the code is escaped to be written in HTML.
+func selectCode(content string, region string, lines string) (string, int, error) {
+	all := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(all) > 0 && len(all[len(all)-1]) == 0 {
+		all = all[:len(all)-1]
+	}
+
+	first, last := 1, len(all)
+	if len(lines) > 0 {
+		if _, err := fmt.Sscanf(lines, "%d-%d", &first, &last); err != nil {
+			if _, err := fmt.Sscanf(lines, "%d", &first); err != nil {
+				return "", 0, fmt.Errorf("invalid lines '%v', use a range like '10-25'", lines)
+			}
+			last = first
+		}
+		if first < 1 || last > len(all) || first > last {
+			return "", 0, fmt.Errorf("invalid lines '%v', the file has %v lines", lines, len(all))
+		}
+	}
+
+	if len(region) > 0 {
+		first, last = 0, 0
+		depth := 0
+		for i, line := range all {
+			if m := reRegionStart.FindStringSubmatch(line); m != nil {
+				if first == 0 && m[1] == region {
+					first = i + 2
+				} else if first > 0 {
+					depth++
+				}
+				continue
+			}
+			if first > 0 && reRegionEnd.MatchString(line) {
+				if depth == 0 {
+					last = i
+					break
+				}
+				depth--
+			}
+		}
+		if first == 0 {
+			return "", 0, fmt.Errorf("region '%v' not found", region)
+		}
+		if last == 0 {
+			return "", 0, fmt.Errorf("region '%v' has no '#endregion'", region)
+		}
+	}
+
+	// The tabs of the indentation are expanded, because the indentation of the lines is counted in spaces
+	selected := []string{}
+	indentation := -1
+	for _, line := range all[first-1 : last] {
+		if reRegionStart.MatchString(line) || reRegionEnd.MatchString(line) {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		prefix := strings.ReplaceAll(line[:len(line)-len(trimmed)], "\t", "    ")
+		line = strings.TrimRight(prefix+trimmed, " \t")
+		if len(trimmed) > 0 && (indentation < 0 || len(prefix) < indentation) {
+			indentation = len(prefix)
+		}
+		selected = append(selected, line)
+	}
+
+	for i, line := range selected {
+		if len(line) >= indentation && indentation > 0 {
+			line = line[indentation:]
+		}
+		selected[i] = html.EscapeString(line)
+	}
+
+	return strings.Join(selected, "\n"), first - 1, nil
+}
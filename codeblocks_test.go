@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeIncludeAtEndOfDocument(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "client.go")
+	source := "package client\n\n// #region auth\nfunc Login() {}\n// #endregion\n"
+	if err := os.WriteFile(name, []byte(source), 0664); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(filepath.Dir(name), "empty.go")
+	if err := os.WriteFile(empty, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"whole file", "Some text.\n\n<pre @" + name + ">", "package client"},
+		{"region", "Some text.\n\n<pre .go @" + name + " region=auth>", "func Login() {}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			html := doc.ToHTML()
+
+			assertNoErrors(t, doc)
+			if !strings.Contains(html, tt.want) {
+				t.Errorf("%q not found in:\n%v", tt.want, html)
+			}
+		})
+	}
+
+	// The block is empty when there is nothing to include
+	t.Run("empty file", func(t *testing.T) {
+		doc := newTestDocument("Some text.\n\n<pre @" + empty + ">")
+		html := doc.ToHTML()
+
+		assertNoErrors(t, doc)
+		if !strings.Contains(html, "<pre></pre>") {
+			t.Errorf("empty block not found in:\n%v", html)
+		}
+	})
+	t.Run("missing file", func(t *testing.T) {
+		doc := newTestDocument("Some text.\n\n<pre @" + filepath.Join(filepath.Dir(name), "missing.go") + ">")
+		doc.ToHTML()
+
+		if !hasDiagnostic(doc, "include", SeverityError) {
+			t.Errorf("missing file not reported")
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The API of CrossRef, with the metadata of the works registered with a DOI, including many books with their ISBN
+const crossrefAPI = "https://api.crossref.org/works"
+
+// crossrefWork is the metadata of a work in CrossRef, which is similar to CSL-JSON
+type crossrefWork struct {
+	Title     []string       `json:"title"`
+	URL       string         `json:"URL"`
+	DOI       string         `json:"DOI"`
+	Publisher string         `json:"publisher"`
+	Author    []crossrefName `json:"author"`
+	Editor    []crossrefName `json:"editor"`
+	Issued    cslDateVar     `json:"issued"`
+}
+
+// crossrefName is the name of a person or, if only the name is given, of an organization
+type crossrefName struct {
+	Family string `json:"family"`
+	Given  string `json:"given"`
+	Name   string `json:"name"`
+}
+
+// String returns the name, like "Sporny, Manu"
+func (n crossrefName) String() string {
+	if len(n.Name) > 0 {
+		return n.Name
+	}
+	return strings.TrimSuffix(n.Family+", "+n.Given, ", ")
+}
+
+// lookupCrossref returns the metadata of the work with the DOI or, if there is no DOI, with the ISBN.
+// It returns nil if the work is not registered in CrossRef.
+// The responses are cached like the other resources downloaded from the network.
+func lookupCrossref(doi string, isbn string) (*crossrefWork, error) {
+	if len(doi) > 0 {
+		content, err := fetchURL(crossrefAPI + "/" + url.PathEscape(doi))
+		if err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Message *crossrefWork `json:"message"`
+		}
+		if err := json.Unmarshal(content, &response); err != nil {
+			return nil, fmt.Errorf("invalid response from CrossRef: %w", err)
+		}
+		return response.Message, nil
+	}
+
+	isbn = strings.ReplaceAll(isbn, "-", "")
+	content, err := fetchURL(crossrefAPI + "?rows=1&filter=isbn:" + url.QueryEscape(isbn))
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Message struct {
+			Items []*crossrefWork `json:"items"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("invalid response from CrossRef: %w", err)
+	}
+	if len(response.Message.Items) == 0 {
+		return nil, nil
+	}
+	return response.Message.Items[0], nil
+}
+
+// resolveEntry completes the entry of the bibliography, which only has a DOI or an ISBN,
+// with the title, authors and date of the work in CrossRef
+func (doc *Document) resolveEntry(lineNum int, entry *BiblioEntry) {
+	work, err := lookupCrossref(entry.doi, entry.isbn)
+	if err != nil {
+		doc.warnf(lineNum, "crossref", "error looking up '%v' in CrossRef: %v", entry.key, err)
+		return
+	}
+	if work == nil {
+		doc.warnf(lineNum, "crossref", "'%v' not found in CrossRef", entry.key)
+		return
+	}
+
+	if len(work.Title) > 0 {
+		entry.title = work.Title[0]
+	}
+	if len(entry.authors) == 0 {
+		for _, a := range work.Author {
+			entry.authors = append(entry.authors, a.String())
+		}
+	}
+	if len(entry.editors) == 0 {
+		for _, e := range work.Editor {
+			entry.editors = append(entry.editors, e.String())
+		}
+	}
+	if len(entry.date) == 0 {
+		entry.date = work.Issued.String()
+	}
+	if len(entry.publisher) == 0 {
+		entry.publisher = work.Publisher
+	}
+	if len(entry.doi) == 0 {
+		entry.doi = work.DOI
+	}
+	if len(entry.href) == 0 && len(entry.doi) == 0 {
+		entry.href = work.URL
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cslItem is an item of a bibliography in CSL-JSON, the format of citeproc and reference managers like Zotero
+type cslItem struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	URL       string     `json:"URL"`
+	DOI       string     `json:"DOI"`
+	Publisher string     `json:"publisher"`
+	Version   string     `json:"version"`
+	Status    string     `json:"status"`
+	Author    []cslName  `json:"author"`
+	Editor    []cslName  `json:"editor"`
+	Issued    cslDateVar `json:"issued"`
+	Accessed  cslDateVar `json:"accessed"`
+}
+
+// cslName is the name of a person in CSL-JSON
+type cslName struct {
+	Family  string `json:"family"`
+	Given   string `json:"given"`
+	Literal string `json:"literal"`
+}
+
+// String returns the name, like "Sporny, Manu"
+func (n cslName) String() string {
+	if len(n.Literal) > 0 {
+		return n.Literal
+	}
+	return strings.TrimSuffix(n.Family+", "+n.Given, ", ")
+}
+
+// cslDateVar is a date in CSL-JSON, with its parts or as a string
+type cslDateVar struct {
+	DateParts [][]any `json:"date-parts"`
+	Literal   string  `json:"literal"`
+}
+
+// String returns the date, like "3 August 2021"
+func (d cslDateVar) String() string {
+	if len(d.DateParts) > 0 {
+		return cslDate(d.DateParts[0])
+	}
+	return d.Literal
+}
+
+// readCSLJSON reads a bibliography in CSL-JSON, which is a list of items with their ids as keys
+func readCSLJSON(fileName string) ([]*BiblioEntry, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []cslItem
+	if err := json.Unmarshal(src, &items); err != nil {
+		return nil, err
+	}
+
+	var entries []*BiblioEntry
+	for _, item := range items {
+		if len(item.ID) == 0 {
+			return nil, fmt.Errorf("an item has no id")
+		}
+
+		entry := &BiblioEntry{key: item.ID, title: item.Title, href: item.URL, doi: item.DOI,
+			publisher: item.Publisher, version: item.Version, status: item.Status,
+			date: item.Issued.String(), accessed: item.Accessed.String()}
+
+		for _, a := range item.Author {
+			entry.authors = append(entry.authors, a.String())
+		}
+		for _, e := range item.Editor {
+			entry.editors = append(entry.editors, e.String())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// cslDate returns a date in CSL-JSON, which are the year, month and day, like "3 August 2021"
+func cslDate(parts []any) string {
+	var year, month, day int
+	for i, p := range parts {
+		// The parts are numbers, but some tools write them as strings
+		n, _ := strconv.Atoi(fmt.Sprint(p))
+		switch i {
+		case 0:
+			year = n
+		case 1:
+			month = n
+		case 2:
+			day = n
+		}
+	}
+
+	date := fmt.Sprint(year)
+	if month >= 1 && month <= 12 {
+		date = fmt.Sprintf("%v %v", monthNames[month-1], date)
+		if day > 0 {
+			date = fmt.Sprintf("%v %v", day, date)
+		}
+	}
+	return date
+}
+
+// The names of the months in the dates of the bibliography
+var monthNames = []string{"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
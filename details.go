@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// preprocessDetails converts an <x-details> tag into a <details> element which can be collapsed, taking
+// the summary from the rest of the line, like in '<x-details>Full example'. The content is the indented
+// block after the tag, and it is shown by default if the tag has the 'open' attribute.
+func (doc *Document) preprocessDetails(lineNum int, tagFields map[string]string) {
+	line := doc.lines[lineNum]
+	restLine := tagFields["restLine"]
+
+	// Replace the name of the tag, keeping its attributes and making sure the tag is closed
+	tagSpec := strings.TrimSuffix(line, restLine)
+	tagSpec = tagSpec[:1] + "details" + strings.TrimPrefix(tagSpec[1:], "x-details")
+	closing := string(endTagFor[rune(tagSpec[0])])
+	if !strings.HasSuffix(tagSpec, closing) {
+		tagSpec = tagSpec + closing
+	}
+
+	summary := strings.TrimSpace(restLine)
+	if len(summary) == 0 {
+		summary = doc.localize("Details")
+	}
+
+	doc.lines[lineNum] = fmt.Sprintf("%v<summary>%v</summary>", tagSpec, summary)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Definition is a term defined with '<dfn>term</dfn>' in the text, which is linked from the uses
+// of the term written as '<a>term</a>'. Other names of the term can be given with 'data-lt="name|other name"'.
+// The definitions can be used by other documents if they have the 'data-export' attribute.
+type Definition struct {
+	terms   []string // The names of the term
+	id      string
+	href    string // The link to the definition, for the definitions imported from other documents
+	export  bool
+	lineNum int
+}
+
+// A definition of a term, like '<dfn>verifiable credential</dfn>' or '<dfn data-lt="VC" data-export>verifiable credential</dfn>'
+var reDfn = regexp.MustCompile(`<dfn(\s[^>]*)?>(.*?)</dfn>`)
+
+// A use of a defined term, which is a link without destination, like '<a>verifiable credential</a>'
+var reDfnUse = regexp.MustCompile(`<a>(.*?)</a>`)
+
+// The other names of a term, like 'data-lt="VC|credential"'
+var reDfnNames = regexp.MustCompile(`\sdata-lt="([^"]*)"`)
+
+// The file with the definitions exported by a document, written next to the output
+const dfnExportExtension = ".dfns.json"
+
+// dfnKey returns the text used to find the definition of a term, which ignores case, spaces and markup
+func dfnKey(term string) string {
+	return strings.ToLower(plainText(term))
+}
+
+// preprocessDefinitions registers the definitions of terms in the line, adding an id to the ones without it
+func (doc *Document) preprocessDefinitions(lineNum int, line string) string {
+	return reDfn.ReplaceAllStringFunc(line, func(dfn string) string {
+		m := reDfn.FindStringSubmatch(dfn)
+		attrs, term := m[1], m[2]
+
+		def := &Definition{terms: []string{term}, export: strings.Contains(attrs, "data-export"), lineNum: lineNum}
+		if names := reDfnNames.FindStringSubmatch(attrs); names != nil {
+			for _, name := range strings.Split(names[1], "|") {
+				if name = strings.TrimSpace(name); len(name) > 0 {
+					def.terms = append(def.terms, name)
+				}
+			}
+		}
+
+		for _, t := range def.terms {
+			if prev := doc.definition(t); prev != nil && len(prev.href) == 0 {
+				doc.warnf(lineNum, "duplicate-dfn", "'%v' is already defined in line %v", plainText(t), prev.lineNum+1)
+			}
+		}
+
+		def.id = stdAttribute(attrs, "id")
+		if len(def.id) == 0 {
+			def.id = doc.uniqueSlug("dfn " + plainText(term))
+			attrs = fmt.Sprintf(" id=\"%v\"", def.id) + attrs
+			doc.autoIDs[def.id] = true
+		}
+		if doc.ids[def.id] > 0 {
+			doc.errorf(lineNum, "duplicate-id", "id '%v' already used", def.id)
+		} else {
+			doc.figs["dfn"] = doc.figs["dfn"] + 1
+			doc.ids[def.id] = doc.figs["dfn"]
+			doc.idLines[def.id] = lineNum
+		}
+
+		doc.definitions = append(doc.definitions, def)
+
+		return fmt.Sprintf("<dfn%v>%v</dfn>", attrs, term)
+	})
+}
+
+// definition returns the definition of the term, defined in the document or imported from other documents,
+// or nil if the term is not defined
+func (doc *Document) definition(term string) *Definition {
+	key := dfnKey(term)
+
+	// The definitions of the document have precedence over the imported ones
+	var imported *Definition
+	for _, def := range doc.definitions {
+		for _, t := range def.terms {
+			if dfnKey(t) != key {
+				continue
+			}
+			if len(def.href) == 0 {
+				return def
+			}
+			if imported == nil {
+				imported = def
+			}
+		}
+	}
+	return imported
+}
+
+// definitionLink returns the link to the definition of the term, which can be in the document, in the glossary
+// or imported from other documents, and the class of the link, or empty strings if the term is not defined
+func (doc *Document) definitionLink(term string) (href string, class string) {
+	if def := doc.definition(term); def != nil {
+		if len(def.href) > 0 {
+			return def.href, "externalDFN"
+		}
+		return "#" + def.id, "internalDFN"
+	}
+
+	for _, t := range doc.terms {
+		if dfnKey(t.term) == dfnKey(term) {
+			return "#" + t.id, "internalDFN"
+		}
+	}
+
+	return "", ""
+}
+
+// linkDefinitions converts the uses of the terms, written like '<a>term</a>', into links to their definitions
+func (doc *Document) linkDefinitions(content string) string {
+	return reDfnUse.ReplaceAllStringFunc(content, func(use string) string {
+		term := reDfnUse.FindStringSubmatch(use)[1]
+		if href, class := doc.definitionLink(term); len(href) > 0 {
+			return fmt.Sprintf("<a href=\"%v\" class=\"%v\">%v</a>", href, class, term)
+		}
+		return use
+	})
+}
+
+// preprocessDefinitionUses registers the uses of the terms in the line, to check that they are defined
+func (doc *Document) preprocessDefinitionUses(lineNum int, line string) {
+	for _, m := range reDfnUse.FindAllStringSubmatch(line, -1) {
+		doc.dfnUses = append(doc.dfnUses, &DocRef{lineNum: lineNum, id: m[1]})
+	}
+}
+
+// checkDefinitions warns about the uses of terms which are not defined
+func (doc *Document) checkDefinitions() {
+	for _, use := range doc.dfnUses {
+		if href, _ := doc.definitionLink(use.id); len(href) == 0 {
+			doc.warnf(use.lineNum, "unknown-dfn", "'%v' is used but not defined", plainText(use.id))
+		}
+	}
+}
+
+// exportedDefinitions is the file with the definitions exported by a document, in the format of the
+// definitions extracted from the specifications by tools like Bikeshed and ReSpec
+type exportedDefinitions struct {
+	Dfns []exportedDefinition `json:"dfns"`
+}
+
+type exportedDefinition struct {
+	ID          string   `json:"id"`
+	Href        string   `json:"href"`
+	LinkingText []string `json:"linkingText"`
+	Type        string   `json:"type"`
+	Access      string   `json:"access"`
+}
+
+// importDefinitions reads the definitions exported by other documents, in the files or URLs specified with
+// 'importDefinitions' in the YAML header. The links to the definitions are relative to the document.
+func (doc *Document) importDefinitions(lineNum int) {
+	for _, name := range doc.config.ListString("importDefinitions") {
+		source, err := resolveInclude(doc.fileName, name)
+		if err != nil {
+			doc.warnf(lineNum, "import-dfn", "error reading the definitions in '%v': %v", name, err)
+			continue
+		}
+
+		content, err := readInclude(source)
+		if err != nil {
+			doc.warnf(lineNum, "import-dfn", "error reading the definitions in '%v': %v", name, err)
+			continue
+		}
+
+		var exported exportedDefinitions
+		if err := json.Unmarshal(content, &exported); err != nil {
+			doc.warnf(lineNum, "import-dfn", "invalid definitions in '%v': %v", name, err)
+			continue
+		}
+
+		for _, d := range exported.Dfns {
+			href, err := resolveInclude(source, d.Href)
+			if err != nil {
+				doc.warnf(lineNum, "import-dfn", "invalid link of the definition '%v' in '%v': %v", d.ID, name, err)
+				continue
+			}
+			if !isURL(href) {
+				if rel, err := filepath.Rel(filepath.Dir(doc.fileName), href); err == nil {
+					href = filepath.ToSlash(rel)
+				}
+			}
+			doc.definitions = append(doc.definitions, &Definition{terms: d.LinkingText, id: d.ID, href: href, lineNum: lineNum})
+		}
+	}
+}
+
+// ExportDefinitions writes the definitions of the document with the 'data-export' attribute in a file
+// next to the output, with the same name and the extension '.dfns.json'
+func (doc *Document) ExportDefinitions(outputFileName string) error {
+	exported := exportedDefinitions{Dfns: []exportedDefinition{}}
+	for _, def := range doc.definitions {
+		if !def.export || len(def.href) > 0 {
+			continue
+		}
+		names := []string{}
+		for _, t := range def.terms {
+			names = append(names, plainText(t))
+		}
+		exported.Dfns = append(exported.Dfns, exportedDefinition{
+			ID:          def.id,
+			Href:        filepath.Base(outputFileName) + "#" + def.id,
+			LinkingText: names,
+			Type:        "dfn",
+			Access:      "public",
+		})
+	}
+	if len(exported.Dfns) == 0 {
+		return nil
+	}
+
+	sort.Slice(exported.Dfns, func(i, j int) bool { return exported.Dfns[i].ID < exported.Dfns[j].ID })
+
+	out, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(outputFileName, filepath.Ext(outputFileName)) + dfnExportExtension
+	return os.WriteFile(name, out, 0664)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefinitionIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		id   string
+	}{
+		{"start of line", "<dfn>widget</dfn> is a thing.\n", "dfn-widget"},
+		{"middle of line", "A <dfn>widget</dfn> is a thing.\n", "dfn-widget"},
+		{"given id at start of line", "<dfn id=\"w\">widget</dfn> is a thing.\n", "w"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			html := doc.ToHTML()
+
+			assertNoErrors(t, doc)
+			if doc.ids[tt.id] != 1 {
+				t.Errorf("id %q registered with number %v, want 1", tt.id, doc.ids[tt.id])
+			}
+			if !strings.Contains(html, `<dfn id="`+tt.id+`">widget</dfn>`) {
+				t.Errorf("definition with id %q not found in:\n%v", tt.id, html)
+			}
+		})
+	}
+}
+
+func TestDefinitionUses(t *testing.T) {
+	doc := newTestDocument("<dfn>widget</dfn> is a thing.\n\nEach <a>widget</a> is small.\n")
+	html := doc.ToHTML()
+
+	assertNoErrors(t, doc)
+	if !strings.Contains(html, `href="#dfn-widget"`) {
+		t.Errorf("use of the term not linked to its definition in:\n%v", html)
+	}
+}
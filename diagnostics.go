@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The exit status when a document has errors or can not be processed
+const exitStatusError = 1
+
+// strict is true when the warnings are treated as errors, so documents with any problem are not generated
+var strict bool
+
+// fatalSyntaxError aborts the processing of a document, keeping the problems found until then.
+// fatalf panics with it, and the callers recover it with catchFatal.
+type fatalSyntaxError struct {
+	doc *Document
+}
+
+func (e *fatalSyntaxError) Error() string {
+	return "unrecoverable syntax error"
+}
+
+// catchFatal runs the processing of a document, and returns the document if the processing was aborted by
+// an unrecoverable syntax error, or nil otherwise. The error is in the diagnostics of the document with the
+// problems found until then, so the caller reports them like the ones of any document with errors.
+func catchFatal(process func()) (aborted *Document) {
+	defer func() {
+		if r := recover(); r != nil {
+			fatal, ok := r.(*fatalSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			aborted = fatal.doc
+		}
+	}()
+
+	process()
+	return nil
+}
+
+// diagFormat is the format used to report the diagnostics: "text" or "json"
+var diagFormat = "text"
+
+// The severity of a diagnostic
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in the source of a document.
+// Errors prevent generating the document, while warnings are just reported.
+type Diagnostic struct {
+	File     string `json:"file"`             // The name of the source file, if known
+	Line     int    `json:"line,omitempty"`   // The line number in the source file, starting at 1, or 0 if not known
+	Column   int    `json:"column,omitempty"` // The column in the line, starting at 1, or 0 if not known
+	Severity string `json:"severity"`         // SeverityError or SeverityWarning
+	Msg      string `json:"message"`
+	Code     string `json:"code"` // A short identifier of the kind of problem, like "duplicate-id"
+}
+
+func (d *Diagnostic) Error() string {
+	switch {
+	case d.Line == 0 && len(d.File) == 0:
+		return d.Msg
+	case d.Line == 0:
+		return fmt.Sprintf("%v: %v", d.File, d.Msg)
+	case len(d.File) == 0:
+		return fmt.Sprintf("line %v: %v", d.Line, d.Msg)
+	}
+	return fmt.Sprintf("%v:%v: %v", d.File, d.Line, d.Msg)
+}
+
+// addDiagnostic records a problem in the line (starting at 0), or in the whole document if the line is negative.
+// The column is where the text of the line starts in its file, and the file and line are the ones where the line
+// comes from, which may be an included file.
+// The same problem may be found more than once because some lines are processed several times,
+// so we record it only the first time.
+func (doc *Document) addDiagnostic(severity string, lineNum int, code string, format string, args ...any) {
+	origin := doc.origin(lineNum)
+	d := &Diagnostic{
+		File:     origin.fileName,
+		Line:     origin.lineNum,
+		Column:   1,
+		Severity: severity,
+		Msg:      fmt.Sprintf(format, args...),
+		Code:     code,
+	}
+	if lineNum < 0 {
+		d.Line, d.Column = 0, 0
+	} else if lineNum < len(doc.indentations) {
+		// The lines of the included files are indented like the <x-include> tag, which is not in their file
+		d.Column = doc.indentations[lineNum] - origin.indentation + 1
+	}
+
+	for _, e := range doc.diagnostics {
+		if *e == *d {
+			return
+		}
+	}
+
+	doc.log.Debugw("diagnostic", "severity", d.Severity, "line", d.Line, "code", d.Code, "message", d.Msg)
+	doc.diagnostics = append(doc.diagnostics, d)
+}
+
+// errorf records a syntax error in the line (starting at 0) and continues processing the document
+func (doc *Document) errorf(lineNum int, code string, format string, args ...any) {
+	doc.addDiagnostic(SeverityError, lineNum, code, format, args...)
+}
+
+// warnf records a problem in the line (starting at 0) which does not prevent generating the document,
+// like a reference to a file which does not exist. In strict mode, it is recorded as an error.
+func (doc *Document) warnf(lineNum int, code string, format string, args ...any) {
+	if strict {
+		doc.addDiagnostic(SeverityError, lineNum, code, format, args...)
+		return
+	}
+	doc.addDiagnostic(SeverityWarning, lineNum, code, format, args...)
+}
+
+// fatalf records a syntax error in the line (starting at 0) when the document can not be processed any further.
+// The processing is aborted by panicking with a *fatalSyntaxError, which the callers recover with catchFatal.
+func (doc *Document) fatalf(lineNum int, code string, format string, args ...any) {
+	doc.errorf(lineNum, code, format, args...)
+	doc.aborted = true
+	panic(&fatalSyntaxError{doc})
+}
+
+// Diagnostics returns all the problems found while processing the document, in the order they were found
+func (doc *Document) Diagnostics() []*Diagnostic {
+	return doc.diagnostics
+}
+
+// Errors returns the syntax errors found while processing the document
+func (doc *Document) Errors() []*Diagnostic {
+	var errs []*Diagnostic
+	for _, d := range doc.diagnostics {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// ReportDiagnostics writes the problems found in the document in the format selected by the user:
+// as text to stderr, or as JSON to stdout, one diagnostic per line.
+// Warnings are not reported in quiet mode.
+func (doc *Document) ReportDiagnostics() {
+	if diagFormat == "json" {
+		doc.PrintDiagnosticsJSON(os.Stdout)
+	} else {
+		doc.PrintDiagnostics(os.Stderr)
+	}
+}
+
+// PrintDiagnostics writes the problems found in the document as text, with a summary of the errors
+func (doc *Document) PrintDiagnostics(w io.Writer) {
+	for _, d := range doc.diagnostics {
+		if d.Severity == SeverityWarning && !quiet {
+			fmt.Fprintf(w, "warning: %v\n", d)
+		}
+	}
+
+	errs := doc.Errors()
+	for _, d := range errs {
+		fmt.Fprintln(w, d)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(w, "%v errors found\n", len(errs))
+	}
+}
+
+// PrintDiagnosticsJSON writes the problems found in the document as JSON, one diagnostic per line
+func (doc *Document) PrintDiagnosticsJSON(w io.Writer) {
+	enc := json.NewEncoder(w)
+	for _, d := range doc.diagnostics {
+		if d.Severity == SeverityWarning && quiet {
+			continue
+		}
+		enc.Encode(d)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCatchFatal(t *testing.T) {
+	var doc *Document
+	aborted := catchFatal(func() {
+		doc = newTestDocument("# Title\n\n<ul>\n    Not an item.\n")
+		doc.ToHTML()
+	})
+	if aborted == nil {
+		t.Fatal("the processing of the document was not aborted")
+	}
+	if !aborted.aborted || !hasDiagnostic(aborted, "list-element", SeverityError) {
+		t.Errorf("no list-element error, diagnostics: %v", aborted.diagnostics)
+	}
+
+	aborted = catchFatal(func() { NewDocumentFromFile(filepath.Join(t.TempDir(), "missing.rite"), nil) })
+	if aborted == nil || !hasDiagnostic(aborted, "read", SeverityError) {
+		t.Errorf("no read error for a file which does not exist")
+	}
+
+	if aborted := catchFatal(func() { newTestDocument("# Title\n\nText.\n").ToHTML() }); aborted != nil {
+		t.Errorf("document without errors aborted, diagnostics: %v", aborted.diagnostics)
+	}
+}
+
+func TestDiagnosticColumnInInclude(t *testing.T) {
+	dir := t.TempDir()
+	part := "Text.\n\n  <p #intro>One\n\n  <p #intro>Two\n"
+	if err := os.WriteFile(filepath.Join(dir, "part.rite"), []byte(part), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	src := "# Title\n\n<div>\n    <x-include @part.rite>\n"
+	doc := newDocument(filepath.Join(dir, "doc.rite"), bufio.NewScanner(strings.NewReader(src)), nil)
+	doc.ToHTML()
+
+	for _, d := range doc.diagnostics {
+		if d.Code != "duplicate-id" {
+			continue
+		}
+		if d.File != filepath.Join(dir, "part.rite") || d.Line != 5 || d.Column != 3 {
+			t.Errorf("got %v:%v:%v, want part.rite:5:3", d.File, d.Line, d.Column)
+		}
+		return
+	}
+	t.Errorf("no duplicate-id error, diagnostics: %v", doc.diagnostics)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The script to render the Mermaid diagrams in the browser, included in the template only if the document has them.
+// The diagrams use the dark theme when the reader prefers a dark color scheme, and they are rendered again
+// when the preference changes, from the source kept in the element.
+const mermaidIncludes = `<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+var dark = window.matchMedia("(prefers-color-scheme: dark)");
+var diagrams = document.querySelectorAll("pre.mermaid");
+diagrams.forEach(function (el) { el.dataset.source = el.textContent; });
+function render() {
+  mermaid.initialize({startOnLoad: false, theme: dark.matches ? "dark" : "default"});
+  diagrams.forEach(function (el) {
+    el.removeAttribute("data-processed");
+    el.textContent = el.dataset.source;
+  });
+  mermaid.run({nodes: diagrams});
+}
+dark.addEventListener("change", render);
+render();
+</script>
+`
+
+// startsWithDiagram returns true if the line starts a diagram, whose source is written verbatim
+func startsWithDiagram(line string) bool {
+	return strings.HasPrefix(line, "<x-diagram")
+}
+
+// preprocessDiagram converts an <x-diagram> tag into a <pre> block with the source of the diagram, which is
+// rendered in the browser, like in '<x-diagram .mermaid>'. The source is the indented block after the tag.
+func (doc *Document) preprocessDiagram(lineNum int, tagFields map[string]string) {
+	if tagFields["class"] == "mermaid" {
+		doc.hasMermaid = true
+	} else {
+		doc.errorf(lineNum, "diagram", "unsupported type of diagram '%v', use '<x-diagram .mermaid>'", tagFields["class"])
+	}
+
+	// The size and alignment of the diagram are written as its style, like in '<x-diagram .mermaid max-width=600>'
+	style := []string{}
+	align, size := doc.preprocessSize(lineNum, tagFields)
+	for _, declarations := range []string{align, size} {
+		if len(declarations) > 0 {
+			style = append(style, declarations)
+		}
+	}
+	line := doc.lines[lineNum]
+	if len(style) > 0 {
+		line = removeTagFields(line, "width=", "height=", "max-width=", "align=")
+		line = line[:len("<x-diagram")] + fmt.Sprintf(" style=\"%v\"", strings.Join(style, ";")) + line[len("<x-diagram"):]
+	}
+
+	// Replace the name of the tag, keeping its attributes
+	doc.lines[lineNum] = line[:1] + "pre" + strings.TrimPrefix(line[1:], "x-diagram")
+}
+
+// diagramSource returns the source of a diagram to be written after it, as specified with 'diagramSource' in the
+// YAML header: as an HTML comment, or as a <details> block which the readers can open to see and copy the source.
+// The lines of the source are already escaped, and in the comment they are unescaped except for the end of the comment.
+func (doc *Document) diagramSource(indentStr string, lines []string) string {
+	source := strings.Join(lines, "\n")
+
+	switch strings.ToLower(doc.config.String("diagramSource", "none")) {
+	case "comment":
+		source = strings.ReplaceAll(html.UnescapeString(source), "-->", "--&gt;")
+		return fmt.Sprintf("%v<!--\n%v\n-->\n\n", indentStr, source)
+	case "details":
+		return fmt.Sprintf("%v<details class=\"diagram-source\"><summary>%v</summary><pre>%v</pre></details>\n\n",
+			indentStr, doc.localize("Source"), source)
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMermaidDiagrams(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"with source",
+			"Some text.\n\n<x-diagram .mermaid>\n    graph TD\n    A --> B\n",
+			[]string{`<pre class="mermaid"`, "A --&gt; B", "mermaid.esm.min.mjs"},
+		},
+		{
+			"at the end of the document",
+			"Some text.\n\n<x-diagram .mermaid>",
+			[]string{`<pre class="mermaid"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			html := doc.ToHTML()
+
+			assertNoErrors(t, doc)
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("%q not found in:\n%v", want, html)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The tokens compared when marking the changes in a line: tags, words, punctuation and the spaces between them
+var reDiffToken = regexp.MustCompile(`<[^>]*>|[\p{L}\p{N}_]+|\s+|[^\s<\p{L}\p{N}_]`)
+
+// diffOp is an operation to convert a list of tokens into another
+type diffOp struct {
+	kind  byte // '=' for tokens in both lists, '-' for tokens removed and '+' for tokens added
+	token string
+}
+
+// diffTokens returns the operations to convert the list of tokens a into b, using the algorithm of Myers
+// to find the shortest list of insertions and deletions
+func diffTokens(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+	total := n + m
+	offset := total + 1
+
+	// For each number of edits d, the furthest position reached in each diagonal k = x - y
+	v := make([]int, 2*total+2)
+	trace := [][]int{}
+
+	for d := 0; d <= total; d++ {
+		trace = append(trace, append([]int{}, v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, d, offset)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrackDiff returns the operations of the path found by diffTokens, going back from the end of both lists
+func backtrackDiff(a []string, b []string, trace [][]int, d int, offset int) []diffOp {
+	ops := []diffOp{}
+	x, y := len(a), len(b)
+
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{'=', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, diffOp{'+', b[y]})
+			} else {
+				x--
+				ops = append(ops, diffOp{'-', a[x]})
+			}
+		}
+	}
+
+	// The operations were found from the end
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// bodyOf returns the part of the HTML before the content of the body, the content and the part after it.
+// If there is no body element, all the HTML is the content.
+func bodyOf(htmlText string) (before string, body string, after string) {
+	start := strings.Index(htmlText, "<body")
+	end := strings.LastIndex(htmlText, "</body>")
+	if start < 0 || end < start {
+		return "", htmlText, ""
+	}
+	start += strings.IndexByte(htmlText[start:], '>') + 1
+	return htmlText[:start], htmlText[start:end], htmlText[end:]
+}
+
+// redline returns the new HTML with the changes from the old HTML marked with <ins> and <del> elements.
+// The lines are compared first, and the tokens of the lines which changed are compared later,
+// so only the words which changed are marked. Only the text is marked, and the removed tags are not written
+// to keep the structure of the new document.
+func redline(oldHTML string, newHTML string) string {
+	_, oldBody, _ := bodyOf(oldHTML)
+	before, newBody, after := bodyOf(newHTML)
+
+	var sb strings.Builder
+	sb.WriteString(before)
+
+	removed, added := []string{}, []string{}
+	flush := func() {
+		if len(removed) > 0 || len(added) > 0 {
+			sb.WriteString(redlineTokens(strings.Join(removed, ""), strings.Join(added, "")))
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	for _, op := range diffTokens(strings.SplitAfter(oldBody, "\n"), strings.SplitAfter(newBody, "\n")) {
+		switch op.kind {
+		case '=':
+			flush()
+			sb.WriteString(op.token)
+		case '-':
+			removed = append(removed, op.token)
+		case '+':
+			added = append(added, op.token)
+		}
+	}
+	flush()
+
+	sb.WriteString(after)
+	return sb.String()
+}
+
+// redlineTokens returns the new text with the changes from the old text marked
+func redlineTokens(oldText string, newText string) string {
+	var sb strings.Builder
+
+	// The consecutive words removed or added are marked together
+	marking := byte(0)
+	mark := func(kind byte) {
+		if marking == kind {
+			return
+		}
+		switch marking {
+		case '-':
+			sb.WriteString("</del>")
+		case '+':
+			sb.WriteString("</ins>")
+		}
+		switch kind {
+		case '-':
+			sb.WriteString("<del>")
+		case '+':
+			sb.WriteString("<ins>")
+		}
+		marking = kind
+	}
+
+	for _, op := range diffTokens(reDiffToken.FindAllString(oldText, -1), reDiffToken.FindAllString(newText, -1)) {
+		isTag := strings.HasPrefix(op.token, "<")
+		isSpace := strings.TrimSpace(op.token) == ""
+
+		switch {
+		case op.kind == '=' || (isTag && op.kind == '+'):
+			// The spaces between changed words are inside the mark
+			if !(isSpace && marking != 0) {
+				mark(0)
+			}
+			sb.WriteString(op.token)
+		case isTag:
+			// The removed tags are not written
+		case isSpace && op.kind == '-':
+			// Nor the removed spaces, which would change the spacing of the new text
+		default:
+			mark(op.kind)
+			sb.WriteString(op.token)
+		}
+	}
+	mark(0)
+
+	return sb.String()
+}
+
+// redlineFile returns the HTML of the document with the changes from the previous version in the file marked
+func redlineFile(oldFileName string, newHTML string) (string, error) {
+	old, err := os.ReadFile(oldFileName)
+	if err != nil {
+		return "", fmt.Errorf("reading the previous version: %w", err)
+	}
+	return redline(string(old), newHTML), nil
+}
+
+// unifiedDiff returns the lines of the differences between the lines a and b in the unified format, like the
+// output of 'diff -u' without the names of the files. The changes are grouped in hunks with the lines of context.
+func unifiedDiff(a []string, b []string, context int) []string {
+	ops := diffTokens(a, b)
+
+	// The position in each list of lines before each operation
+	oldPos, newPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if op.kind != '+' {
+			oldPos[i+1]++
+		}
+		if op.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+
+	out := []string{}
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == '=' {
+			continue
+		}
+
+		// The hunk includes the next changes until there are more equal lines than the context of both
+		end := i + 1
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != '=' {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end = end + context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		out = append(out, fmt.Sprintf("@@ -%v,%v +%v,%v @@", oldPos[start]+1, oldPos[end]-oldPos[start], newPos[start]+1, newPos[end]-newPos[start]))
+		for _, op := range ops[start:end] {
+			prefix := string(op.kind)
+			if op.kind == '=' {
+				prefix = " "
+			}
+			out = append(out, prefix+op.token)
+		}
+
+		i = end - 1
+	}
+
+	return out
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A reference to an element of another document, like '<x-ref "otherdoc.rite#requirement-12">',
+// which can have the text of the link or just show the number of the element, like the references in the document
+var reDocXref = regexp.MustCompile(`<x-ref +"?([0-9a-zA-Z-_\./]+\.rite)#([0-9a-zA-Z-_\.]+)"?(?: +(?:"([^"]*)"|(num)))? *>`)
+
+// The placeholders of the link and text of a reference to another document, replaced when the document is
+// generated, because the other documents may not have been parsed yet
+var reDocXrefPlaceholder = regexp.MustCompile(`\{#docref-([0-9]+)\.(href|text)\}`)
+
+// DocRef is a reference to an element of this or another document
+type DocRef struct {
+	lineNum  int
+	fileName string // The name of the other document, as written in the reference, or empty for this one
+	id       string
+	text     string // The text of the link given in the reference, if any
+	num      bool   // True if the text of the link is the number of the element
+}
+
+// replaceXrefs replaces the <x-ref> tags in the line by links to the elements, in this or other documents
+func (doc *Document) replaceXrefs(lineNum int, line string) string {
+	line = reDocXref.ReplaceAllStringFunc(line, func(ref string) string {
+		m := reDocXref.FindStringSubmatch(ref)
+		doc.docRefs = append(doc.docRefs, &DocRef{lineNum: lineNum, fileName: m[1], id: m[2], text: m[3], num: len(m[4]) > 0})
+		n := len(doc.docRefs) - 1
+		return fmt.Sprintf("<a href=\"{#docref-%v.href}\" class=\"xref\">{#docref-%v.text}</a>", n, n)
+	})
+
+	for _, m := range reXref.FindAllStringSubmatch(line, -1) {
+		doc.xrefs = append(doc.xrefs, &DocRef{lineNum: lineNum, id: m[1]})
+	}
+
+	return reXref.ReplaceAllStringFunc(line, func(ref string) string {
+		m := reXref.FindStringSubmatch(ref)
+		switch {
+		case len(m[2]) > 0:
+			return fmt.Sprintf("<a href=\"#%v\" class=\"xref\">%v</a>", m[1], m[2])
+		case len(m[3]) > 0:
+			return fmt.Sprintf("<a href=\"#%v\" class=\"xref\">{#%v.num}</a>", m[1], m[1])
+		}
+		return reXref.ReplaceAllString(ref, xrefReplacement)
+	})
+}
+
+// checkXrefs warns about the references to elements which do not exist in the document,
+// including the references in the footnotes
+func (doc *Document) checkXrefs() {
+	xrefs := doc.xrefs
+	for _, fn := range doc.footnoteList {
+		for _, m := range reXref.FindAllStringSubmatch(fn.text, -1) {
+			xrefs = append(xrefs, &DocRef{lineNum: fn.lineNum, id: m[1]})
+		}
+	}
+
+	for _, ref := range xrefs {
+		if doc.ids[ref.id] == 0 {
+			doc.warnf(ref.lineNum, "dangling-xref", "reference to '%v', which does not exist", ref.id)
+		}
+	}
+}
+
+// resolveDocRefs replaces the placeholders of the references to other documents by their links and text.
+// When processing a directory the referenced elements must exist, and the text of the reference is their label.
+// Otherwise, the link is built from the name of the document without checking it.
+func (doc *Document) resolveDocRefs(content string) string {
+	return reDocXrefPlaceholder.ReplaceAllStringFunc(content, func(placeholder string) string {
+		m := reDocXrefPlaceholder.FindStringSubmatch(placeholder)
+		n, _ := strconv.Atoi(m[1])
+		ref := doc.docRefs[n]
+
+		href := strings.TrimSuffix(ref.fileName, riteExtension) + ".html#" + ref.id
+		text := "[" + ref.fileName + "#" + ref.id + "]"
+
+		if doc.site != nil {
+			from, to := doc.site.refPages(doc, doc.origin(ref.lineNum).fileName, ref.fileName)
+			switch {
+			case to == nil:
+				if m[2] == "href" {
+					doc.warnf(ref.lineNum, "dangling-xref", "reference to document '%v', which does not exist", ref.fileName)
+				}
+			case to.doc.ids[ref.id] == 0:
+				if m[2] == "href" {
+					doc.warnf(ref.lineNum, "dangling-xref", "reference to '%v' in '%v', which does not exist", ref.id, ref.fileName)
+				}
+			default:
+				href = relativeLink(from.outputName, to.outputName) + "#" + ref.id
+				if label, found := to.doc.refLabels[ref.id]; found {
+					text = label
+				}
+				if ref.num {
+					text = to.doc.idNumber(ref.id)
+				}
+			}
+		}
+		if len(ref.text) > 0 {
+			text = ref.text
+		}
+
+		if m[2] == "href" {
+			return href
+		}
+		return text
+	})
+}
+
+// refPages returns the page of the document and the page of the document referenced from the given source file,
+// or nil if the referenced document is not part of the site
+func (site *Site) refPages(doc *Document, sourceName string, ref string) (from *SitePage, to *SitePage) {
+	target := sameFileKey(filepath.Join(filepath.Dir(sourceName), filepath.FromSlash(ref)))
+
+	for _, page := range site.pages {
+		if page.doc == doc {
+			from = page
+		}
+		if sameFileKey(page.inputName) == target {
+			to = page
+		}
+	}
+	if from == nil {
+		return nil, nil
+	}
+
+	return from, to
+}
+
+// checkUnusedIds warns about the numbered elements, like figures, tables and equations, whose ids are not
+// referenced anywhere, and also about any other id if requested with 'checkUnusedIds: true' in the YAML header.
+// The references are the links in the generated content and, when processing a directory, the references
+// from the other documents.
+func (doc *Document) checkUnusedIds(content string) {
+	used := map[string]bool{}
+	for _, m := range reLocalHref.FindAllStringSubmatch(content, -1) {
+		used[m[1]] = true
+	}
+	for _, m := range reNumPlaceholder.FindAllStringSubmatch(content, -1) {
+		used[m[1]] = true
+	}
+	if doc.site != nil {
+		for _, page := range doc.site.pages {
+			for _, ref := range page.doc.docRefs {
+				if _, to := doc.site.refPages(page.doc, page.doc.origin(ref.lineNum).fileName, ref.fileName); to != nil && to.doc == doc {
+					used[ref.id] = true
+				}
+			}
+		}
+	}
+
+	// The terms of the glossary are linked automatically
+	for _, t := range doc.terms {
+		used[t.id] = true
+	}
+
+	// The headings have a label with their text, but they are not numbered elements
+	headings := map[string]bool{}
+	for _, h := range doc.headings {
+		headings[h.id] = true
+	}
+
+	all := doc.config.Bool("checkUnusedIds")
+
+	unused := []string{}
+	for id := range doc.ids {
+		if !used[id] && !doc.autoIDs[id] {
+			unused = append(unused, id)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return doc.idLines[unused[i]] < doc.idLines[unused[j]] })
+
+	for _, id := range unused {
+		if label, numbered := doc.refLabels[id]; numbered && !headings[id] {
+			doc.warnf(doc.idLines[id], "unreferenced-figure", "%v ('%v') is not referenced", label, id)
+		} else if all {
+			doc.warnf(doc.idLines[id], "unused-id", "id '%v' is not referenced", id)
+		}
+	}
+}
+
+// A link to an element of the document, like 'href="#intro"'
+var reLocalHref = regexp.MustCompile(`href="#([^"]+)"`)
+
+// The placeholder of the number of an element, like '{#intro.num}'
+var reNumPlaceholder = regexp.MustCompile(`\{#([0-9a-zA-Z-_\.]+)\.num\}`)
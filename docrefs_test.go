@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeadingReferences(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite":     "---\ntitle: A\n---\n\n# Alpha\n\nSee <x-ref \"details\">.\n\n<h1 #details>More details\n\nText.\n",
+		"sub/b.rite": "---\ntitle: B\n---\n\nSee <x-ref \"../a.rite#alpha\">, section <x-ref \"../a.rite#details\" num>.\n",
+	})
+	pages := map[string]*SitePage{}
+	for _, page := range site.pages {
+		pages[page.outputName] = page
+	}
+	if err := site.Generate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page string
+		want string
+	}{
+		{"a.html", `<a href="#details" class="xref">More details</a>`},
+		{"sub/b.html", `<a href="../a.html#alpha" class="xref">Alpha</a>`},
+		{"sub/b.html", `<a href="../a.html#details" class="xref">2</a>`},
+	}
+	for _, tt := range tests {
+		if !strings.Contains(pages[tt.page].html, tt.want) {
+			t.Errorf("%q not found in %v:\n%v", tt.want, tt.page, pages[tt.page].html)
+		}
+	}
+
+	for _, page := range site.pages {
+		for _, d := range page.doc.Diagnostics() {
+			t.Errorf("unexpected diagnostic in %v line %v: %v (%v)", page.outputName, d.Line, d.Msg, d.Code)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The word used in the captions of the examples and in the references to them, translated with localize
+const exampleLabel = "Example"
+
+// Example is a numbered block of code with a caption, written like '<x-example #login>Login request'.
+// The code is the indented block after the tag, which is written literally, so HTML or XML can be pasted
+// without escaping it. With the 'raw' attribute, the block is written verbatim like a <pre> block.
+type Example struct {
+	id      string
+	class   string
+	caption string // The label with the number and the text of the caption, like "Example 3: Login request"
+}
+
+// The attribute of an example whose content is written as HTML instead of literally, like '<x-example raw>'
+var reRawAttr = regexp.MustCompile(`(^|\s)raw(\s|$)`)
+
+// rawExample returns true if the example started in the line has the 'raw' attribute
+func (doc *Document) rawExample(lineNum int) bool {
+	return reRawAttr.MatchString(doc.preprocessTagSpec(lineNum)["stdFields"])
+}
+
+// preprocessExample numbers the example started by an <x-example> tag, which is written as a <pre> block
+// with the other attributes of the tag, like 'linenos' or '@file', inside a box with the caption
+func (doc *Document) preprocessExample(lineNum int, tagFields map[string]string) {
+	text := strings.TrimSpace(tagFields["restLine"])
+
+	label := fmt.Sprintf("%v %v", doc.localize(exampleLabel), doc.elementNumber(lineNum, tagFields))
+	if id := tagFields["id"]; len(id) > 0 && doc.idLines[id] == lineNum {
+		doc.refLabels[id] = label
+	}
+	doc.addCaption(lineNum, exampleLabel, label, text, tagFields)
+
+	example := &Example{id: tagFields["id"], class: tagFields["class"], caption: label}
+	if len(text) > 0 {
+		example.caption = fmt.Sprintf("%v: %v", label, text)
+	}
+	doc.examples[lineNum] = example
+
+	pre := "<pre"
+	if stdFields := strings.TrimSpace(reRawAttr.ReplaceAllString(tagFields["stdFields"], " ")); len(stdFields) > 0 {
+		pre = pre + " " + stdFields
+	}
+	doc.lines[lineNum] = pre + ">"
+}
+
+// processExample writes the box of the example with its caption, and the code inside it
+func (doc *Document) processExample(lineNum int) int {
+	example := doc.examples[lineNum]
+	indentStr := doc.indentStr(lineNum)
+
+	class := "example"
+	if len(example.class) > 0 {
+		class = class + " " + example.class
+	}
+	box := fmt.Sprintf("<div class=\"%v\"", class)
+	if len(example.id) > 0 {
+		box = box + fmt.Sprintf(" id=\"%v\"", example.id)
+	}
+	box = box + doc.lineAttr(lineNum) + ">"
+
+	doc.sb.WriteString(fmt.Sprintf("%v%v<div class=\"example-title\">%v</div>", indentStr, box, example.caption))
+	next := doc.processVerbatim(lineNum)
+	doc.sb.WriteString(indentStr + "</div>\n\n")
+
+	return next
+}
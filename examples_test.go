@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExamples(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"numbered and referenced",
+			"See <x-ref \"login\">.\n\n<x-example #login>Login request\n    GET /login\n",
+			[]string{"Example 1: Login request", `<a href="#login" class="xref">Example 1</a>`, "GET /login"},
+		},
+		{
+			"at the end of the document",
+			"Some text.\n\n<x-example #empty>Empty",
+			[]string{"Example 1: Empty"},
+		},
+		{
+			"without caption at the end of the document",
+			"Some text.\n\n<x-example>",
+			[]string{`class="example"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			html := doc.ToHTML()
+
+			assertNoErrors(t, doc)
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("%q not found in:\n%v", want, html)
+				}
+			}
+		})
+	}
+}
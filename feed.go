@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The name of the feed generated in directory mode, and the maximum number of documents in it
+const feedName = "feed.xml"
+const feedEntries = 20
+
+// The formats of the dates in the YAML header, the last one being the way the YAML parser writes the timestamps
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04", "2006-01-02 15:04:05 -0700 MST"}
+
+// parseDate returns the time of a date in the YAML header, like '2024-05-31' or '2024-05-31T10:00:00Z'
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%v'", value)
+}
+
+// date returns the date of the document in the YAML header with the given key, like 'date' or 'updated'
+func (doc *Document) date(key string) (time.Time, bool) {
+	v, err := doc.config.Get(key)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, err := parseDate(fmt.Sprint(v.Data()))
+	return t, err == nil
+}
+
+// AtomLink is a link of an Atom feed or entry
+type AtomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// AtomPerson is an author of an Atom feed or entry
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+// AtomEntry is a document of the site in the feed
+type AtomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Link      AtomLink     `xml:"link"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Authors   []AtomPerson `xml:"author"`
+	Summary   string       `xml:"summary,omitempty"`
+}
+
+// AtomFeed is the feed of the documents of the site, in the format defined in RFC 4287
+type AtomFeed struct {
+	XMLName xml.Name     `xml:"feed"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Authors []AtomPerson `xml:"author"`
+	Links   []AtomLink   `xml:"link"`
+	Entries []AtomEntry  `xml:"entry"`
+}
+
+// feed builds the Atom feed with the documents which have a date in the YAML header, the last updated first.
+// The date of the last update is 'updated', or 'date' if the document was not updated after published.
+// The author of the feed is the one of the site or, if not specified, the editors of the documents.
+func (site *Site) feed() *AtomFeed {
+	baseURL := strings.TrimSuffix(site.baseURL, "/")
+
+	f := &AtomFeed{
+		Xmlns: "http://www.w3.org/2005/Atom",
+		Title: site.title(),
+		ID:    baseURL + "/",
+		Links: []AtomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: baseURL + "/" + feedName},
+			{Rel: "alternate", Type: "text/html", Href: baseURL + "/"},
+		},
+	}
+
+	type dated struct {
+		page      *SitePage
+		published time.Time
+		updated   time.Time
+	}
+	pages := []dated{}
+	for _, page := range site.pages {
+		published, hasDate := page.doc.date("date")
+		updated, hasUpdated := page.doc.date("updated")
+		if !hasDate && !hasUpdated {
+			continue
+		}
+		if !hasUpdated {
+			updated = published
+		}
+		pages = append(pages, dated{page: page, published: published, updated: updated})
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].updated.After(pages[j].updated) })
+	if len(pages) > feedEntries {
+		pages = pages[:feedEntries]
+	}
+
+	for _, p := range pages {
+		link := baseURL + "/" + filepath.ToSlash(p.page.outputName)
+		entry := AtomEntry{
+			Title:   p.page.doc.Title(),
+			ID:      link,
+			Link:    AtomLink{Rel: "alternate", Type: "text/html", Href: link},
+			Updated: p.updated.Format(time.RFC3339),
+			Summary: p.page.doc.Description(),
+		}
+		if !p.published.IsZero() {
+			entry.Published = p.published.Format(time.RFC3339)
+		}
+		for _, author := range p.page.doc.authors() {
+			entry.Authors = append(entry.Authors, AtomPerson{Name: author})
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+
+	// The feed must have an author unless all its entries have one (RFC 4287, section 4.1.1).
+	// The name of the site is used when nobody else is known.
+	authors := []string{}
+	if len(site.author) > 0 {
+		authors = append(authors, site.author)
+	} else {
+		seen := map[string]bool{}
+		for _, p := range pages {
+			for _, name := range p.page.doc.editors() {
+				if !seen[name] {
+					seen[name] = true
+					authors = append(authors, name)
+				}
+			}
+		}
+	}
+	if len(authors) == 0 {
+		for _, entry := range f.Entries {
+			if len(entry.Authors) == 0 {
+				authors = append(authors, f.Title)
+				break
+			}
+		}
+	}
+	for _, name := range authors {
+		f.Authors = append(f.Authors, AtomPerson{Name: name})
+	}
+
+	// The feed is updated when its last updated document is
+	if len(pages) > 0 {
+		f.Updated = pages[0].updated.Format(time.RFC3339)
+	} else {
+		f.Updated = time.Now().Format(time.RFC3339)
+	}
+
+	return f
+}
+
+// generateFeed writes the Atom feed of the documents of the site, if the base URL of the site is known,
+// because the ids and links of the feed must be absolute, and some document has a date
+func (site *Site) generateFeed(dryrun bool) error {
+
+	if len(site.baseURL) == 0 {
+		site.log.Debugw("no base URL specified, not generating the feed")
+		return nil
+	}
+
+	f := site.feed()
+	if len(f.Entries) == 0 {
+		site.log.Debugw("no documents with a date, not generating the feed")
+		return nil
+	}
+
+	site.log.Infof("generating %v with %v documents", feedName, len(f.Entries))
+
+	out, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+
+	if dryrun {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(site.dir, feedName), out, 0664)
+}
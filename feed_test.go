@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFeedAuthors(t *testing.T) {
+	files := map[string]string{
+		"a.rite": "---\ntitle: A\ndate: 2024-05-01\neditors:\n  - name: Jane Doe\n    company: ACME\n  - John Roe\n---\n\nText.\n",
+		"b.rite": "---\ntitle: B\ndate: 2024-06-01\neditors: [Jane Doe]\n---\n\nText.\n",
+		"c.rite": "---\ntitle: C\n---\n\nNot in the feed.\n",
+	}
+
+	tests := []struct {
+		name   string
+		author string
+		files  map[string]string
+		want   []string
+	}{
+		{"author of the site", "ACME Standards", files, []string{"ACME Standards"}},
+		{"editors of the documents", "", files, []string{"Jane Doe", "John Roe"}},
+		{"no editors", "", map[string]string{"a.rite": "---\ntitle: A\ndate: 2024-05-01\n---\n\nText.\n"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := newTestSite(t, tt.files)
+			site.baseURL = "https://example.com"
+			site.author = tt.author
+
+			f := site.feed()
+			want := tt.want
+			if want == nil {
+				want = []string{site.title()}
+			}
+			got := []string{}
+			for _, author := range f.Authors {
+				got = append(got, author.Name)
+			}
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("got authors %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// noNetwork is true when the documents can not use resources from the network, for reproducible builds.
+// Resources which were downloaded before are still used from the cache.
+var noNetwork bool
+
+// httpTimeout is the maximum time to download a resource from the network. Each request has its own
+// deadline, because the client is shared by the downloads made at the same time.
+var httpTimeout = 30 * time.Second
+
+// httpRetries is the number of times a download is retried after a temporary failure
+var httpRetries = 2
+
+// httpClient is the client used for all the downloads. By default it uses the proxy in the environment
+// variables HTTP_PROXY and HTTPS_PROXY, and it is configured with setupTLS.
+var httpClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+
+// The time the resources downloaded are used from the cache before downloading them again
+const cacheTTL = 24 * time.Hour
+
+// cacheFile returns the name of the file where a resource downloaded from the URL is cached,
+// or the empty string if there is no cache directory
+func cacheFile(rawURL string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, "rite", hex.EncodeToString(sum[:]))
+}
+
+// fetchURL returns the content of a resource in the network, using the cache when possible
+func fetchURL(rawURL string) ([]byte, error) {
+	cached := cacheFile(rawURL)
+
+	if len(cached) > 0 {
+		if info, err := os.Stat(cached); err == nil && (noNetwork || time.Since(info.ModTime()) < cacheTTL) {
+			return os.ReadFile(cached)
+		}
+	}
+
+	if noNetwork {
+		return nil, fmt.Errorf("network access is disabled and '%v' is not in the cache", rawURL)
+	}
+
+	// Temporary failures, like a timeout or an overloaded server, are retried after waiting a bit more each time
+	content, err := download(rawURL)
+	for retry := 1; retry <= httpRetries && err != nil && isTemporary(err); retry++ {
+		time.Sleep(time.Duration(retry*retry) * time.Second)
+		content, err = download(rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A failure to write the cache only means the resource will be downloaded again
+	if len(cached) > 0 {
+		if err := os.MkdirAll(filepath.Dir(cached), 0775); err == nil {
+			os.WriteFile(cached, content, 0664)
+		}
+	}
+
+	return content, nil
+}
+
+// temporaryError is a failure to download a resource which may succeed if it is tried again
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+
+// isTemporary returns true if the download failed because of a temporary problem
+func isTemporary(err error) bool {
+	_, ok := err.(*temporaryError)
+	return ok
+}
+
+// download returns the content of a resource in the network. The failures of the connection, and the
+// responses of a server which is unavailable or overloaded, are temporary errors.
+func download(rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &temporaryError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("downloading '%v': %v", rawURL, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, &temporaryError{err}
+		}
+		return nil, err
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &temporaryError{err}
+	}
+	return content, nil
+}
+
+// setupTLS configures the verification of the certificates of the servers, trusting also the certificates of
+// the authorities in caFile, like the ones of a corporate proxy, or not verifying them at all if insecure is true
+func setupTLS(caFile string, insecure bool) error {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+
+	if len(caFile) > 0 {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in '%v'", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	httpClient.Transport.(*http.Transport).TLSClientConfig = config
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// The word used in the captions of the figures and in the references to them, translated with localize
+const figureLabel = "Figure"
+
+// Caption is the caption of a numbered figure or table, used to generate the lists of figures and tables
+type Caption struct {
+	kind  string // The word used in the label, like "Figure" or "Table"
+	id    string // The id of the element, if it has one, to link to it
+	label string // The label with the number, like "Figure 3"
+	text  string
+}
+
+// The key in the YAML header with the prefixes of the numbers of the elements in each bucket,
+// like 'numberPrefixes: {architecture: A}' to number the figures in the bucket as "Figure A-1"
+const numberPrefixesKey = "numberPrefixes"
+
+// elementNumber returns the number of the element started by the tag in the line, which is the counter of
+// its bucket. If the user specified the bucket with the "type" attribute, like in '<x-img :architecture>',
+// the number has the prefix of the bucket, like "A-1".
+// Elements with an id have been counted already, and the others are counted now in the same bucket.
+func (doc *Document) elementNumber(lineNum int, tagFields map[string]string) string {
+	id := tagFields["id"]
+	typ := tagBucket(tagFields)
+
+	counter := doc.ids[id]
+	if len(id) == 0 || doc.idLines[id] != lineNum {
+		doc.figs[typ] = doc.figs[typ] + 1
+		counter = doc.figs[typ]
+	}
+
+	number := fmt.Sprint(counter)
+	if prefix := doc.bucketPrefix(tagFields["type"]); len(prefix) > 0 {
+		number = prefix + "-" + number
+	}
+
+	if len(id) > 0 && doc.idLines[id] == lineNum {
+		doc.idNumbers[id] = number
+	}
+
+	return number
+}
+
+// bucketPrefix returns the prefix of the numbers of the elements in a bucket specified by the user.
+// The prefix is the one in the YAML header or otherwise a letter assigned in the order the buckets appear: A, B, C, ...
+func (doc *Document) bucketPrefix(typ string) string {
+	if len(typ) == 0 {
+		return ""
+	}
+
+	if prefix, found := doc.bucketPrefixes[typ]; found {
+		return prefix
+	}
+
+	prefix := doc.config.String(numberPrefixesKey+"."+typ, "")
+	if len(prefix) == 0 {
+		prefix = string(rune('A' + len(doc.bucketPrefixes)%26))
+	}
+	doc.bucketPrefixes[typ] = prefix
+
+	return prefix
+}
+
+// Figure is a figure being preprocessed, whose caption can continue in the following lines indented
+// more than the tag, which are added later with addCaptionLine
+type Figure struct {
+	lineNum int
+	tag     string // The start of the <figure> tag, with its id, class and other attributes
+	src     string
+	alt     string // The alternative text of the image, if specified with 'alt=', or the text of the caption
+	attrs   string // The other attributes of the image, like its dimensions, its smaller copies or its size
+	caption *Caption
+}
+
+// preprocessFigure converts an <x-img> tag into a <figure> with the image and a numbered caption,
+// taking the text of the caption from the rest of the line, like in '<x-img @arch.png #arch>The architecture'.
+// The figures are numbered in their bucket, which can be specified like in '<x-img @arch.png :architecture>'.
+// The alternative text of the image is the caption, unless specified like in '<x-img @arch.png alt="Three boxes">'.
+// The size and alignment of the image are specified like in '<x-img @arch.png max-width=80% align=center>'.
+func (doc *Document) preprocessFigure(lineNum int, tagFields map[string]string) *Figure {
+	text := strings.TrimSpace(tagFields["restLine"])
+
+	label := fmt.Sprintf("%v %v", doc.localize(figureLabel), doc.elementNumber(lineNum, tagFields))
+	if id := tagFields["id"]; len(id) > 0 && doc.idLines[id] == lineNum {
+		doc.refLabels[id] = label
+	}
+	doc.addCaption(lineNum, figureLabel, label, text, tagFields)
+
+	src := tagFields["src"]
+	if len(src) == 0 {
+		doc.errorf(lineNum, "figure", "no image in the figure, use '<x-img @file>'")
+	}
+	doc.checkAsset(lineNum, src)
+
+	// The figure keeps the id, class and other attributes of the tag, and the image gets the source and the alt text
+	figure := "<figure"
+	if id := tagFields["id"]; len(id) > 0 {
+		figure = figure + " #" + id
+	}
+	if class := tagFields["class"]; len(class) > 0 {
+		figure = figure + " ." + class
+	}
+	alt := stdAttribute(tagFields["stdFields"], "alt")
+	tagFields["stdFields"] = removeStdAttribute(tagFields["stdFields"], "alt")
+	align, size := doc.preprocessSize(lineNum, tagFields)
+	if len(align) > 0 {
+		figure = figure + fmt.Sprintf(" style=\"%v\"", align)
+	}
+	if stdFields := tagFields["stdFields"]; len(stdFields) > 0 {
+		figure = figure + " " + stdFields
+	}
+
+	image := doc.assetPath(src)
+	if downloadImages && isURL(src) {
+		image = doc.remoteAssetPath(lineNum, src)
+	}
+
+	fig := &Figure{lineNum: lineNum, tag: figure, src: image, alt: alt, caption: doc.captions[len(doc.captions)-1]}
+	fig.attrs = doc.imageDimensions(src) + doc.responsiveImage(lineNum, src)
+	if len(size) > 0 {
+		fig.attrs = fig.attrs + fmt.Sprintf(" style=\"%v\"", size)
+	}
+	doc.writeFigure(fig)
+	return fig
+}
+
+// The attributes with the size of figures and diagrams, written as CSS properties
+var sizeAttributes = []string{"width", "height", "max-width"}
+
+// A size of a figure or diagram, in pixels if it has no unit, like '640', '80%' or '30em'
+var reSize = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?)(px|em|rem|%|vw|vh|ch)?$`)
+
+// preprocessSize removes the attributes with the size and alignment of a figure or diagram from the tag,
+// like in '<x-img @arch.png width=640 align=center>', and returns them as CSS declarations: the alignment
+// of the element, like "text-align:center", and the size of the image, like "width:640px".
+func (doc *Document) preprocessSize(lineNum int, tagFields map[string]string) (string, string) {
+	stdFields := tagFields["stdFields"]
+	defer func() {
+		tagFields["stdFields"] = stdFields
+		if len(stdFields) == 0 {
+			delete(tagFields, "stdFields")
+		}
+	}()
+
+	align := ""
+	if value := stdAttribute(stdFields, "align"); len(value) > 0 {
+		stdFields = removeStdAttribute(stdFields, "align")
+		if contains([]string{"left", "center", "right"}, value) {
+			align = "text-align:" + value
+		} else {
+			doc.warnf(lineNum, "figure", "invalid alignment '%v', use left, center or right", value)
+		}
+	}
+
+	size := []string{}
+	for _, name := range sizeAttributes {
+		value := stdAttribute(stdFields, name)
+		if len(value) == 0 {
+			continue
+		}
+		stdFields = removeStdAttribute(stdFields, name)
+		m := reSize.FindStringSubmatch(value)
+		if m == nil {
+			doc.warnf(lineNum, "figure", "invalid %v '%v', use a number of pixels or a CSS length like '80%%'", name, value)
+			continue
+		}
+		if len(m[3]) == 0 {
+			value = value + "px"
+		}
+		size = append(size, name+":"+value)
+	}
+	// The image keeps its proportions when only the width is given
+	if len(size) > 0 && len(stdAttribute(tagFields["stdFields"], "height")) == 0 {
+		size = append(size, "height:auto")
+	}
+
+	return align, strings.Join(size, ";")
+}
+
+// addCaptionLine adds a line to the caption of the figure, and writes the figure again with the new caption
+func (doc *Document) addCaptionLine(fig *Figure, line string) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	if len(fig.caption.text) > 0 {
+		fig.caption.text = fig.caption.text + " "
+	}
+	fig.caption.text = fig.caption.text + line
+	doc.writeFigure(fig)
+}
+
+// writeFigure writes the line of the figure with the image and its caption
+func (doc *Document) writeFigure(fig *Figure) {
+	text := fig.caption.text
+
+	caption := fig.caption.label
+	if len(text) > 0 {
+		caption = fmt.Sprintf("%v. %v", fig.caption.label, text)
+	}
+
+	alt := html.EscapeString(fig.alt)
+	if len(alt) == 0 {
+		alt = html.EscapeString(plainText(text))
+	}
+
+	doc.lines[fig.lineNum] = fmt.Sprintf("%v><img src=\"%v\" alt=\"%v\"%v><figcaption>%v</figcaption>",
+		fig.tag, fig.src, alt, fig.attrs, caption)
+}
+
+// addCaption registers the caption of a numbered element, to be included in the lists of figures and tables
+func (doc *Document) addCaption(lineNum int, kind string, label string, text string, tagFields map[string]string) {
+	caption := &Caption{kind: kind, label: label, text: text}
+	if id := tagFields["id"]; len(id) > 0 && doc.idLines[id] == lineNum {
+		caption.id = id
+	}
+	doc.captions = append(doc.captions, caption)
+}
+
+// listOfCaptions returns the list of the figures or tables in the document, depending on the kind,
+// with links to the elements which have an id
+func (doc *Document) listOfCaptions(kind string, title string) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("<nav class=\"list-of-%vs\">\n", strings.ToLower(kind)))
+	sb.WriteString(fmt.Sprintf("<h2 class=\"no-num\">%v</h2>\n<ul>\n", title))
+	for _, c := range doc.captions {
+		if c.kind != kind {
+			continue
+		}
+		entry := c.label
+		if len(c.text) > 0 {
+			entry = fmt.Sprintf("%v. %v", c.label, c.text)
+		}
+		if len(c.id) > 0 {
+			entry = fmt.Sprintf("<a href=\"#%v\">%v</a>", c.id, entry)
+		}
+		sb.WriteString(fmt.Sprintf("<li>%v</li>\n", entry))
+	}
+	sb.WriteString("</ul>\n</nav>\n")
+
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A reference to a footnote, like '[^label]'
+var reFootnoteRef = regexp.MustCompile(`\[\^([0-9a-zA-Z-_\.]+)\]`)
+
+// The definition of a footnote, at the beginning of a line: '[^label]: the text of the footnote'.
+// The text may continue in the following lines if they are indented more than the definition.
+var reFootnoteDef = regexp.MustCompile(`^\[\^([0-9a-zA-Z-_\.]+)\]:\s*(.*)$`)
+
+// Footnote is a note rendered at the end of the document, numbered in the order they are referenced
+type Footnote struct {
+	label   string
+	text    string
+	lineNum int // The line of the definition, or -1 if the footnote is referenced but not defined
+	refLine int // The line of the first reference
+	number  int // The number of the footnote, or 0 if it is not referenced
+	refs    int // The number of references to the footnote
+}
+
+// footnote returns the footnote with the label, creating it if needed
+func (doc *Document) footnote(label string) *Footnote {
+	fn := doc.footnotes[label]
+	if fn == nil {
+		fn = &Footnote{label: label, lineNum: -1}
+		doc.footnotes[label] = fn
+	}
+	return fn
+}
+
+// defineFootnote registers the definition of a footnote in the line
+func (doc *Document) defineFootnote(lineNum int, label string, text string) *Footnote {
+	fn := doc.footnote(label)
+	if fn.lineNum >= 0 {
+		doc.errorf(lineNum, "duplicate-footnote", "footnote '%v' already defined in line %v", label, fn.lineNum+1)
+		return &Footnote{label: label, lineNum: lineNum}
+	}
+	fn.lineNum = lineNum
+	fn.text = text
+	return fn
+}
+
+// footnoteText processes a line of the text of a footnote with the same inline passes as the lines of the document:
+// the references to footnotes and other elements, the citations, the images, the inline markup and the bare URLs
+func (doc *Document) footnoteText(lineNum int, line string) string {
+	line = doc.replaceFootnoteRefs(lineNum, line)
+	line = doc.replaceCitations(lineNum, line)
+	line = doc.replaceXrefs(lineNum, line)
+	line = doc.replaceInlineImages(lineNum, line)
+	line = doc.inlineMarkup(line)
+	if doc.config.Bool("linkify", true) {
+		line = linkify(line)
+	}
+	return line
+}
+
+// replaceFootnoteRefs replaces the references to footnotes in the line by links to the footnotes.
+// Footnotes are numbered when they are referenced for the first time.
+func (doc *Document) replaceFootnoteRefs(lineNum int, line string) string {
+	return reFootnoteRef.ReplaceAllStringFunc(line, func(ref string) string {
+		fn := doc.footnote(reFootnoteRef.FindStringSubmatch(ref)[1])
+
+		if fn.number == 0 {
+			doc.footnoteList = append(doc.footnoteList, fn)
+			fn.number = len(doc.footnoteList)
+			fn.refLine = lineNum
+		}
+		fn.refs++
+
+		return fmt.Sprintf("<sup class=\"footnote-ref\"><a href=\"#fn-%v\" id=\"%v\">%v</a></sup>", fn.label, fn.refID(fn.refs), fn.number)
+	})
+}
+
+// refID returns the id of the reference to the footnote, where n starts at 1
+func (fn *Footnote) refID(n int) string {
+	if n == 1 {
+		return "fnref-" + fn.label
+	}
+	return fmt.Sprintf("fnref-%v-%v", fn.label, n)
+}
+
+// checkFootnotes warns about footnotes which are referenced but not defined, or defined but not referenced
+func (doc *Document) checkFootnotes() {
+	for _, fn := range doc.footnoteList {
+		if fn.lineNum < 0 {
+			doc.warnf(fn.refLine, "undefined-footnote", "footnote '%v' is not defined", fn.label)
+		}
+	}
+
+	unused := []*Footnote{}
+	for _, fn := range doc.footnotes {
+		if fn.lineNum >= 0 && fn.number == 0 {
+			unused = append(unused, fn)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].lineNum < unused[j].lineNum })
+	for _, fn := range unused {
+		doc.warnf(fn.lineNum, "unused-footnote", "footnote '%v' is not referenced", fn.label)
+	}
+}
+
+// footnotesSection returns the section with the footnotes, in the order they are referenced in the document,
+// and with links back to the references
+func (doc *Document) footnotesSection() string {
+	if len(doc.footnoteList) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("<section class=\"footnotes\">\n<ol>\n")
+	for _, fn := range doc.footnoteList {
+		if fn.lineNum < 0 {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("<li id=\"fn-%v\" value=\"%v\">%v", fn.label, fn.number, fn.text))
+		for i := 1; i <= fn.refs; i++ {
+			sb.WriteString(fmt.Sprintf(" <a href=\"#%v\" class=\"footnote-backref\">&#8617;</a>", fn.refID(i)))
+		}
+		sb.WriteString("</li>\n")
+	}
+	sb.WriteString("</ol>\n</section>\n")
+
+	return sb.String()
+}
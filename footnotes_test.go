@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFootnoteMarkup(t *testing.T) {
+	doc := newTestDocument("Text with a note[^a].\n\n# Details #details\n\n[^a]: See **this** and `code`,\n    at https://example.com or in <x-ref \"details\">.\n")
+	html := doc.ToHTML()
+	assertNoErrors(t, doc)
+
+	notes := html[strings.Index(html, `<section class="footnotes">`):]
+	for _, want := range []string{
+		"<b>this</b>",
+		"<code>code</code>",
+		`<a href="https://example.com">https://example.com</a>`,
+		`<a href="#details"`,
+	} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("%q not found in the footnotes %q", want, notes)
+		}
+	}
+}
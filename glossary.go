@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Term is an entry of the glossary, defined with '<x-term>Verifiable Credential' followed by the indented definition
+type Term struct {
+	term    string
+	id      string
+	text    string // The definition of the term
+	lineNum int
+}
+
+// The elements whose text is not linked to the definitions of the terms
+var noTermLinkElements = []string{"a", "dfn", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "code", "kbd", "samp", "script", "style", "textarea"}
+
+// defineTerm registers the term defined by the <x-term> tag in the line. The id of the term is the one
+// specified in the tag or is derived from the term. The definition is the text in the following lines
+// which are indented more than the tag, which are added later with addLine.
+func (doc *Document) defineTerm(lineNum int) *Term {
+	tagFields := doc.preprocessTagSpec(lineNum)
+
+	name := strings.TrimSpace(tagFields["restLine"])
+	if len(name) == 0 {
+		doc.errorf(lineNum, "term", "no term defined, use '<x-term>Term' followed by its definition")
+		return nil
+	}
+
+	id := tagFields["id"]
+	if len(id) == 0 {
+		id = "term-" + slugify(name)
+	}
+
+	for _, t := range doc.terms {
+		if strings.EqualFold(t.term, name) {
+			doc.errorf(lineNum, "duplicate-term", "term '%v' already defined in line %v", name, t.lineNum+1)
+			return &Term{term: name, id: id, lineNum: lineNum}
+		}
+	}
+
+	// The terms can be referenced like other elements, with their name as the text of the reference
+	if doc.ids[id] > 0 {
+		doc.errorf(lineNum, "duplicate-id", "id '%v' already used", id)
+	} else {
+		doc.figs["x-term"] = doc.figs["x-term"] + 1
+		doc.ids[id] = doc.figs["x-term"]
+		doc.idLines[id] = lineNum
+		doc.refLabels[id] = name
+	}
+
+	term := &Term{term: name, id: id, lineNum: lineNum}
+	doc.terms = append(doc.terms, term)
+
+	return term
+}
+
+// addLine adds a line to the definition of the term
+func (term *Term) addLine(line string) {
+	if len(term.text) > 0 {
+		term.text = term.text + "\n"
+	}
+	term.text = term.text + line
+}
+
+// glossarySection returns the list of terms and their definitions, sorted alphabetically
+func (doc *Document) glossarySection() string {
+	if len(doc.terms) == 0 {
+		return ""
+	}
+
+	terms := append([]*Term{}, doc.terms...)
+	sort.SliceStable(terms, func(i, j int) bool { return strings.ToLower(terms[i].term) < strings.ToLower(terms[j].term) })
+
+	var sb strings.Builder
+
+	sb.WriteString("<dl class=\"glossary\">\n")
+	for _, t := range terms {
+		sb.WriteString(fmt.Sprintf("<dt id=\"%v\"><dfn>%v</dfn></dt>\n<dd>%v</dd>\n", t.id, t.term, t.text))
+	}
+	sb.WriteString("</dl>\n")
+
+	return sb.String()
+}
+
+// linkTerms links the occurrences of the terms of the glossary in the text of the HTML to their definitions.
+// The terms are not linked inside other links, headings, code or the definitions of the terms.
+func (doc *Document) linkTerms(htmlText string) string {
+	if len(doc.terms) == 0 {
+		return htmlText
+	}
+
+	// Longer terms are tried first, so 'Verifiable Credential' is preferred to 'Credential'
+	terms := append([]*Term{}, doc.terms...)
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i].term) > len(terms[j].term) })
+
+	ids := map[string]string{}
+	alternatives := []string{}
+	for _, t := range terms {
+		ids[t.term] = t.id
+		alternatives = append(alternatives, regexp.QuoteMeta(t.term))
+	}
+	reTerms := regexp.MustCompile(`\b(` + strings.Join(alternatives, "|") + `)\b`)
+
+	return mapText(htmlText, noTermLinkElements, func(text string) string {
+		return reTerms.ReplaceAllStringFunc(text, func(term string) string {
+			return fmt.Sprintf("<a href=\"#%v\" class=\"term\">%v</a>", ids[term], term)
+		})
+	})
+}
+
+// The placeholder where the glossary is written, replaced when the whole document has been processed
+const glossaryPlaceholder = "{#glossary}"
+
+// startsWithGlossary returns true if the line is the <x-glossary> tag, which marks where the glossary is written
+func (doc *Document) startsWithGlossary(lineNum int) bool {
+	return strings.HasPrefix(doc.lines[lineNum], "<x-glossary")
+}
+
+// processGlossary writes the placeholder of the glossary, which is generated when all the terms are known
+func (doc *Document) processGlossary(lineNum int) int {
+	doc.sb.WriteString(doc.indentStr(lineNum) + glossaryPlaceholder + "\n")
+	return lineNum + 1
+}
@@ -2,19 +2,22 @@ module github.com/hesusruiz/rite
 
 go 1.19
 
+require (
+	github.com/hesusruiz/vcutils v0.0.0-20221011172906-f573373bbe40
+	github.com/urfave/cli/v2 v2.23.7
+	go.uber.org/zap v1.23.0
+)
+
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/fatih/color v1.10.0 // indirect
 	github.com/goccy/go-yaml v1.9.5 // indirect
-	github.com/hesusruiz/vcutils v0.0.0-20221011172906-f573373bbe40 // indirect
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/urfave/cli/v2 v2.23.7 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
-	go.uber.org/zap v1.23.0 // indirect
 	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
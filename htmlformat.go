@@ -0,0 +1,163 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// minifyHTML is true when the generated HTML is minified, to reduce the size of big documents
+var minifyHTML bool
+
+// prettyHTML is true when the generated HTML is formatted with one block element per line, indented
+// by its depth, so the changes of the HTML in a repository are easy to review
+var prettyHTML bool
+
+// The elements whose content must be written as it is, because the spaces are significant or it is not HTML
+var reVerbatimElement = regexp.MustCompile(`(?i)<(pre|textarea|script|style)\b`)
+
+var (
+	reHTMLComment = regexp.MustCompile(`<!--[\s\S]*?-->`)
+	reSpaces      = regexp.MustCompile(`\s+`)
+)
+
+// minify returns the HTML with the comments removed and the spaces collapsed, except inside the elements
+// where they are significant, like <pre>. The conditional comments, like '<!--[if IE]>', are kept.
+func minify(html string) string {
+	var sb strings.Builder
+
+	for len(html) > 0 {
+		start, end := len(html), len(html)
+		if loc := reVerbatimElement.FindStringSubmatchIndex(html); loc != nil {
+			start = loc[0]
+			closing := "</" + strings.ToLower(html[loc[2]:loc[3]])
+			if i := strings.Index(strings.ToLower(html[start:]), closing); i >= 0 {
+				end = start + i + len(closing)
+			}
+		}
+
+		text := reHTMLComment.ReplaceAllStringFunc(html[:start], func(comment string) string {
+			if strings.HasPrefix(comment, "<!--[if") {
+				return comment
+			}
+			return ""
+		})
+		sb.WriteString(reSpaces.ReplaceAllString(text, " "))
+		sb.WriteString(html[start:end])
+		html = html[end:]
+	}
+
+	return strings.TrimSpace(sb.String()) + "\n"
+}
+
+// The block elements, which are written in their own lines by pretty, and the ones which have no end tag
+var (
+	blockElements = []string{
+		"html", "head", "body", "meta", "link", "article", "section", "nav", "header", "footer", "main", "aside",
+		"div", "p", "h1", "h2", "h3", "h4", "h5", "h6", "ul", "ol", "li", "dl", "dt", "dd", "blockquote", "hr",
+		"table", "caption", "thead", "tbody", "tfoot", "tr", "th", "td", "figure", "figcaption", "details", "summary",
+	}
+	voidBlockElements = []string{"meta", "link", "hr"}
+)
+
+// A tag, a comment or a text in the HTML
+var reHTMLToken = regexp.MustCompile(`<!--[\s\S]*?-->|<[^>]*>|[^<]+`)
+
+// The name of an element in a start or end tag
+var reTagName = regexp.MustCompile(`^</?([a-zA-Z0-9]+)`)
+
+// pretty returns the HTML with each block element in its own line, indented by its depth, and the spaces of
+// the text collapsed. The elements where the spaces are significant, like <pre>, are written as they are.
+// The result only depends on the elements of the document, and not on the way they were written.
+func pretty(html string) string {
+	var sb strings.Builder
+	depth := 0
+	atLineStart := true
+	space := false
+
+	newLine := func() {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.Repeat("  ", depth))
+		atLineStart = false
+		space = false
+	}
+
+	for len(html) > 0 {
+		// The elements written as they are start in their own line
+		if loc := reVerbatimElement.FindStringSubmatchIndex(html); loc != nil && loc[0] == 0 {
+			end := len(html)
+			closing := "</" + strings.ToLower(html[loc[2]:loc[3]])
+			if i := strings.Index(strings.ToLower(html), closing); i >= 0 {
+				end = i + len(closing)
+				if j := strings.IndexByte(html[end:], '>'); j >= 0 {
+					end = end + j + 1
+				}
+			}
+			newLine()
+			sb.WriteString(html[:end])
+			atLineStart = true
+			html = html[end:]
+			continue
+		}
+
+		token := reHTMLToken.FindString(html)
+		next := len(token)
+		if verbatim := reVerbatimElement.FindStringIndex(token); verbatim != nil && verbatim[0] > 0 {
+			token = token[:verbatim[0]]
+			next = len(token)
+		}
+		html = html[next:]
+
+		name := ""
+		if m := reTagName.FindStringSubmatch(token); m != nil {
+			name = strings.ToLower(m[1])
+		}
+
+		switch {
+		case !strings.HasPrefix(token, "<"):
+			// The text is written in the current line, with the spaces collapsed
+			text := reSpaces.ReplaceAllString(token, " ")
+			if strings.TrimSpace(text) == "" {
+				space = space || len(text) > 0
+				continue
+			}
+			if atLineStart {
+				newLine()
+				text = strings.TrimLeft(text, " ")
+			} else if space {
+				sb.WriteString(" ")
+			}
+			space = strings.HasSuffix(text, " ")
+			sb.WriteString(strings.TrimRight(text, " "))
+
+		case contains(blockElements, name) && strings.HasPrefix(token, "</"):
+			if depth > 0 {
+				depth--
+			}
+			newLine()
+			sb.WriteString(token)
+			atLineStart = true
+
+		case contains(blockElements, name):
+			newLine()
+			sb.WriteString(token)
+			if !contains(voidBlockElements, name) {
+				depth++
+			}
+			atLineStart = true
+
+		default:
+			// The inline elements and the comments are written in the current line
+			if atLineStart {
+				newLine()
+			} else if space {
+				sb.WriteString(" ")
+			}
+			space = false
+			sb.WriteString(token)
+		}
+	}
+
+	return sb.String() + "\n"
+}
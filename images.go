@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The key in the YAML header with the widths of the smaller copies of the images of the figures, like
+// 'imageWidths: [480, 960]', so the browsers of small screens can download a smaller image
+const imageWidthsKey = "imageWidths"
+
+// The quality of the JPEG images encoded, the smaller copies and the images optimized
+const jpegQuality = 85
+
+// optimizeImages is true when the PNG and JPEG images copied to the assets directory are compressed again,
+// keeping the smaller file. The images are not converted to WebP or AVIF, which Go can not encode.
+var optimizeImages bool
+
+// imageWidths returns the widths of the copies of the images, in increasing order, warning in the line
+// of the figure about the invalid ones
+func (doc *Document) imageWidths(lineNum int) []int {
+	widths := []int{}
+	for _, value := range doc.config.List(imageWidthsKey) {
+		width, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil || width <= 0 {
+			doc.warnf(lineNum, "invalid-option", "'%v' must be a list of widths in pixels, not '%v'", imageWidthsKey, value)
+			continue
+		}
+		widths = append(widths, width)
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// ImageCopy is a smaller copy of a local image, which is generated in the assets directory when the document is written
+type ImageCopy struct {
+	source string // The absolute path of the image
+	width  int
+}
+
+// responsiveImage returns the srcset and sizes attributes of the image of a figure, with the smaller copies of
+// the image in the widths of 'imageWidths'. The copies are registered to be generated in the assets directory
+// when the document is written, like 'builtassets/arch-480w.png' for 'arch.png', and nothing is written while
+// the document is processed. Only the local PNG and JPEG images wider than some of the widths get copies.
+func (doc *Document) responsiveImage(lineNum int, ref string) string {
+	widths := doc.imageWidths(lineNum)
+	filePath := localAssetPath(ref)
+	ext := strings.ToLower(path.Ext(filePath))
+	if len(widths) == 0 || len(filePath) == 0 || (ext != ".png" && ext != ".jpg" && ext != ".jpeg") {
+		return ""
+	}
+
+	content, err := os.ReadFile(doc.localFile(filePath))
+	if err != nil {
+		return ""
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		doc.warnf(lineNum, "figure", "error reading the image '%v': %v", ref, err)
+		return ""
+	}
+	original := config.Width
+
+	source, target, err := doc.assetTarget(filePath)
+	if err != nil {
+		return ""
+	}
+
+	srcset := []string{}
+	for _, width := range widths {
+		if width >= original {
+			break
+		}
+		copyTarget := strings.TrimSuffix(target, path.Ext(target)) + fmt.Sprintf("-%vw", width) + path.Ext(target)
+		if fingerprintAssets {
+			copyTarget = fingerprint(copyTarget, content)
+		}
+		doc.imageCopies[copyTarget] = &ImageCopy{source: source, width: width}
+		srcset = append(srcset, fmt.Sprintf("%v %vw", (&url.URL{Path: copyTarget}).EscapedPath(), width))
+	}
+	if len(srcset) == 0 {
+		return ""
+	}
+	srcset = append(srcset, fmt.Sprintf("%v %vw", doc.assetPath(ref), original))
+
+	return fmt.Sprintf(" srcset=\"%v\" sizes=\"(max-width: %vpx) 100vw, %vpx\"", strings.Join(srcset, ", "), original, original)
+}
+
+// write generates the copy of the image in the file, when it does not exist or is older than the image
+func (c *ImageCopy) write(fileName string) error {
+	info, err := os.Stat(c.source)
+	if err != nil {
+		return err
+	}
+	if copyInfo, err := os.Stat(fileName); err == nil && !copyInfo.ModTime().Before(info.ModTime()) {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(c.source))
+	img, err := readImage(c.source, ext)
+	if err != nil {
+		return fmt.Errorf("error reading the image '%v': %w", c.source, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), 0775)
+	if err != nil {
+		return err
+	}
+	return writeImage(fileName, ext, scaleImage(img, c.width))
+}
+
+// imageDimensions returns the width and height attributes of a local PNG, JPEG or GIF image, so the browser
+// reserves its space before downloading it and the page does not move when the image appears
+func (doc *Document) imageDimensions(ref string) string {
+	filePath := localAssetPath(ref)
+	if len(filePath) == 0 {
+		return ""
+	}
+
+	f, err := os.Open(doc.localFile(filePath))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" width=\"%v\" height=\"%v\"", config.Width, config.Height)
+}
+
+// readImage decodes a PNG or JPEG image
+func readImage(fileName string, ext string) (image.Image, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if ext == ".png" {
+		return png.Decode(f)
+	}
+	return jpeg.Decode(f)
+}
+
+// writeImage encodes a PNG or JPEG image
+func writeImage(fileName string, ext string, img image.Image) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	err = encodeImage(f, ext, img)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// encodeImage encodes a PNG or JPEG image, with the best compression of PNG when the images are optimized
+func encodeImage(w io.Writer, ext string, img image.Image) error {
+	if ext != ".png" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if optimizeImages {
+		return (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(w, img)
+	}
+	return png.Encode(w, img)
+}
+
+// optimizeImage copies a PNG or JPEG image recompressed, or as it is if the recompressed image is not smaller.
+// The other files are copied as they are. The JPEG images with Exif metadata are copied as they are, because the orientation of the photo is lost
+// when they are encoded again.
+func optimizeImage(from string, to string) error {
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(from))
+	isJPEG := ext == ".jpg" || ext == ".jpeg"
+	if ext == ".png" || (isJPEG && !bytes.Contains(content, []byte("Exif\x00"))) {
+		img, _, err := image.Decode(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("%v: %w", from, err)
+		}
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, ext, img); err != nil {
+			return fmt.Errorf("%v: %w", from, err)
+		}
+		if buf.Len() < len(content) {
+			content = buf.Bytes()
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(to), 0775)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to, content, 0664)
+}
+
+// scaleImage returns a copy of the image reduced to the width, keeping its proportions. Each pixel of the copy
+// is the average of the pixels of the image in the same area, which keeps the thin lines of the diagrams.
+func scaleImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, (y+1)*bounds.Dy()/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, (x+1)*bounds.Dx()/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[i+c])
+					}
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The maximum nesting of included files
+const maxIncludeDepth = 20
+
+// lineSource is a file being read while parsing the document: the document itself or an included file
+type lineSource struct {
+	scanner     *bufio.Scanner
+	fileName    string // The name or URL of the file, which may be empty for the document
+	lineNum     int    // The number of lines read from the file
+	indentation string // The indentation added to the lines, which is the one of the <x-include> tag
+	included    bool   // True for included files, whose YAML header is ignored
+	offset      int    // The number of levels added to the headings of the file
+	inHeader    bool   // True while reading the YAML header of an included file
+	snippet     string // The name of the snippet, for the lines inserted with <x-use>
+}
+
+// lineOrigin is the file and line where a line of the document comes from
+type lineOrigin struct {
+	fileName    string
+	lineNum     int // The line number in the file, starting at 1
+	indentation int // The indentation added to the line, which is the one of the <x-include> tag
+}
+
+// pushSource starts reading the lines from a new file, until all its lines have been read
+func (doc *Document) pushSource(src *lineSource) {
+	// Accept the line endings of any platform
+	src.scanner.Split(scanLines)
+	doc.sources = append(doc.sources, src)
+}
+
+// nextLine returns the next line of the document, reading it from the file being included, if any,
+// and records where it comes from. It returns false when all the lines have been read.
+func (doc *Document) nextLine() (string, bool) {
+	for len(doc.sources) > 0 {
+		src := doc.sources[len(doc.sources)-1]
+
+		if src.scanner.Scan() {
+			src.lineNum++
+
+			// Remove the UTF-8 byte order mark that some editors write at the beginning
+			line := src.scanner.Text()
+			if src.lineNum == 1 {
+				line = strings.TrimPrefix(line, "\uFEFF")
+			}
+
+			// The YAML header of included files is ignored
+			if src.included {
+				if src.lineNum == 1 && strings.HasPrefix(strings.TrimSpace(line), "---") {
+					src.inHeader = true
+					continue
+				}
+				if src.inHeader {
+					src.inHeader = !strings.HasPrefix(strings.TrimSpace(line), "---")
+					continue
+				}
+			}
+
+			if src.offset > 0 {
+				line = shiftHeading(line, src.offset)
+			}
+
+			doc.origins = append(doc.origins, lineOrigin{fileName: src.fileName, lineNum: src.lineNum, indentation: len(src.indentation)})
+			return src.indentation + line, true
+		}
+
+		// Check if there was any error
+		if err := src.scanner.Err(); err != nil {
+			doc.errorf(len(doc.lines), "read", "error scanning the input file %v: %v", src.fileName, err)
+		}
+
+		doc.sources = doc.sources[:len(doc.sources)-1]
+
+		// A blank line separates the end of an included file from what comes next
+		if src.included {
+			doc.origins = append(doc.origins, lineOrigin{fileName: src.fileName, lineNum: src.lineNum})
+			return "", true
+		}
+	}
+
+	return "", false
+}
+
+// preprocessInclude starts reading the file referenced by the <x-include> tag in the line, like '<x-include @intro.rite>'.
+// The lines of the file are inserted in the document after the tag, with the same indentation as the tag.
+// The name of the file is relative to the file where the tag is, and can also be an http or https URL.
+func (doc *Document) preprocessInclude(lineNum int) {
+	tagFields := doc.preprocessTagSpec(lineNum)
+
+	ref := tagFields["src"]
+	if len(ref) == 0 {
+		doc.errorf(lineNum, "include", "no file to include, use '<x-include @file>'")
+		return
+	}
+
+	if len(doc.sources) > maxIncludeDepth {
+		doc.errorf(lineNum, "include", "too many nested includes (more than %v) including '%v'", maxIncludeDepth, ref)
+		return
+	}
+
+	current := doc.sources[len(doc.sources)-1]
+	name, err := resolveInclude(current.fileName, ref)
+	if err != nil {
+		doc.errorf(lineNum, "include", "error including '%v': %v", ref, err)
+		return
+	}
+
+	// The headings of the file can be nested under the including location, like in '<x-include @file offset=1>',
+	// and the offset of the including file applies also to the included one
+	offset := current.offset
+	if value := stdAttribute(tagFields["stdFields"], "offset"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			doc.errorf(lineNum, "include", "invalid offset '%v', it must be a positive number", value)
+		} else {
+			offset += n
+		}
+	}
+
+	// A pattern of local files, like '<x-include @chapters/*.rite>', includes all the files matching it in lexical order
+	names := []string{name}
+	if !isURL(name) && strings.ContainsAny(name, "*?[") {
+		names, err = filepath.Glob(name)
+		if err != nil {
+			doc.errorf(lineNum, "include", "invalid pattern '%v': %v", ref, err)
+			return
+		}
+		if len(names) == 0 {
+			doc.errorf(lineNum, "include", "no files match '%v'", ref)
+			return
+		}
+	}
+
+	// The files are pushed in reverse order, because the last file pushed is read first
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+
+		if cycle := doc.includeCycle(name); len(cycle) > 0 {
+			doc.errorf(lineNum, "include-cycle", "include cycle: %v", strings.Join(cycle, " -> "))
+			continue
+		}
+
+		content, err := readInclude(name)
+		if err != nil {
+			doc.errorf(lineNum, "include", "error including '%v': %v", name, err)
+			continue
+		}
+
+		// The Markdown and AsciiDoc files are converted to rite
+		content = convertToRite(name, content)
+
+		// Only the element with the id is included if specified, like in '<x-include @file #section>'
+		firstLine := 0
+		if id := tagFields["id"]; len(id) > 0 {
+			content, firstLine, err = extractSection(content, id)
+			if err != nil {
+				doc.errorf(lineNum, "include", "error including '%v': %v", name, err)
+				continue
+			}
+		}
+
+		doc.log.Debugw("including file", "name", name, "line", lineNum+1, "offset", offset)
+
+		doc.pushSource(&lineSource{
+			scanner:     bufio.NewScanner(bytes.NewReader(content)),
+			fileName:    name,
+			indentation: strings.Repeat(" ", doc.indentations[lineNum]),
+			included:    true,
+			offset:      offset,
+			lineNum:     firstLine,
+		})
+	}
+}
+
+// extractSection returns the lines of the element with the id and its content, which are the lines indented
+// more than the element or, for headings, the lines until the next heading of the same or higher level.
+// The lines are returned without the indentation of the element, with the line number (starting at 0) of the first one.
+func extractSection(content []byte, id string) ([]byte, int, error) {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(content))
+	s.Split(scanLines)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	reID := regexp.MustCompile(`^\s*[<{]\S+.*(\s#|\sid="?)` + regexp.QuoteMeta(id) + `([\s>}"]|$)`)
+
+	start := -1
+	for i, line := range lines {
+		if reID.MatchString(line) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, 0, fmt.Errorf("id '%v' not found", id)
+	}
+
+	indentation := len(lines[start]) - len(strings.TrimLeft(lines[start], " "))
+	level := headingLevel(lines[start])
+
+	end := start + 1
+	for ; end < len(lines); end++ {
+		line := lines[end]
+		trimmed := strings.TrimLeft(line, " ")
+		if len(trimmed) == 0 {
+			continue
+		}
+		if level > 0 {
+			if l := headingLevel(line); l > 0 && l <= level {
+				break
+			}
+		} else if len(line)-len(trimmed) <= indentation {
+			break
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range lines[start:end] {
+		if len(line) >= indentation && len(strings.TrimLeft(line[:indentation], " ")) == 0 {
+			line = line[indentation:]
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	return []byte(sb.String()), start, nil
+}
+
+// headingLevel returns the level of the heading in the line, written as a tag or in Markdown, or 0 if none
+func headingLevel(line string) int {
+	if m := reHeadingTag.FindStringSubmatch(line); m != nil {
+		return int(m[2][0] - '0')
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	if strings.HasPrefix(trimmed, "#") {
+		return len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+	}
+	return 0
+}
+
+// The start of a heading tag, like '<h2' or '{h2'
+var reHeadingTag = regexp.MustCompile(`^(\s*[<{]h)([1-6])([\s>}]|$)`)
+
+// shiftHeading increases the level of the heading in the line, if any, up to h6.
+// Both heading tags and Markdown headings are shifted.
+func shiftHeading(line string, offset int) string {
+	if m := reHeadingTag.FindStringSubmatchIndex(line); m != nil {
+		level := int(line[m[4]]-'0') + offset
+		if level > 6 {
+			level = 6
+		}
+		return line[:m[3]] + strconv.Itoa(level) + line[m[5]:]
+	}
+
+	trimmed := strings.TrimLeft(line, " ")
+	if strings.HasPrefix(trimmed, "#") {
+		marks := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		level := marks + offset
+		if level > 5 {
+			// There is no Markdown syntax for h6
+			return line[:len(line)-len(trimmed)] + "<h6>" + trimmed[marks:]
+		}
+		return line[:len(line)-len(trimmed)] + strings.Repeat("#", level) + trimmed[marks:]
+	}
+
+	return line
+}
+
+// stdAttribute returns the value of a standard HTML attribute in the attributes of a tag, without quotes
+func stdAttribute(stdFields string, name string) string {
+	m := stdAttributeRegexp(name).FindStringSubmatch(stdFields)
+	if m == nil {
+		return ""
+	}
+	return m[2] + m[3]
+}
+
+// removeStdAttribute returns the attributes of a tag without the standard HTML attribute
+func removeStdAttribute(stdFields string, name string) string {
+	return strings.TrimSpace(stdAttributeRegexp(name).ReplaceAllString(stdFields, ""))
+}
+
+// stdAttributeRegexp returns the regular expression of a standard HTML attribute, whose value can be quoted
+// to include spaces, like 'alt="The architecture"'
+func stdAttributeRegexp(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|\s)` + regexp.QuoteMeta(name) + `=(?:"([^"]*)"|([^"\s]*))`)
+}
+
+// includeCycle returns the chain of files including each other if including the file would create a cycle,
+// or nil if there is no cycle
+func (doc *Document) includeCycle(name string) []string {
+	target := sameFileKey(name)
+
+	for i, src := range doc.sources {
+		if len(src.fileName) > 0 && sameFileKey(src.fileName) == target {
+			cycle := []string{}
+			for _, s := range doc.sources[i:] {
+				cycle = append(cycle, s.fileName)
+			}
+			return append(cycle, name)
+		}
+	}
+
+	return nil
+}
+
+// sameFileKey returns a key to compare file names, which is the absolute path for local files
+func sameFileKey(name string) string {
+	if isURL(name) {
+		return name
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// isURL returns true if the name is an http or https URL
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// resolveInclude returns the name or URL of a file referenced from another file, relative to it.
+// The references in a remote file are resolved only against its URL, so a file from another site can not
+// read the local files: the absolute paths and the paths going up with '..' are rejected.
+func resolveInclude(base string, ref string) (string, error) {
+	if isURL(ref) {
+		return ref, nil
+	}
+
+	if isURL(base) {
+		if filepath.IsAbs(ref) || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, `\`) || hasParentDir(ref) {
+			return "", fmt.Errorf("'%v' is not relative to the remote file %v", ref, base)
+		}
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		if len(refURL.Scheme) > 0 || len(refURL.Host) > 0 {
+			return "", fmt.Errorf("'%v' is not relative to the remote file %v", ref, base)
+		}
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		return baseURL.ResolveReference(refURL).String(), nil
+	}
+
+	if filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(ref)), nil
+}
+
+// hasParentDir returns true if the path has a '..' element, with slashes or backslashes as separators
+func hasParentDir(ref string) bool {
+	for _, elem := range strings.FieldsFunc(ref, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// readInclude returns the content of a local file or URL
+func readInclude(name string) ([]byte, error) {
+	if isURL(name) {
+		return fetchURL(name)
+	}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return content, nil
+}
+
+// convertToRite returns the content of a file written in Markdown or AsciiDoc converted to rite,
+// or the content as it is for the other files
+func convertToRite(name string, content []byte) []byte {
+	switch {
+	case isMarkdown(name):
+		return markdownToRite(content)
+	case isAsciiDoc(name):
+		return asciiDocToRite(content)
+	}
+	return content
+}
+
+// origin returns the file and line where a line of the document comes from
+func (doc *Document) origin(lineNum int) lineOrigin {
+	if lineNum >= 0 && lineNum < len(doc.origins) {
+		return doc.origins[lineNum]
+	}
+	return lineOrigin{fileName: doc.fileName, lineNum: lineNum + 1}
+}
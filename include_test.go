@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveInclude(t *testing.T) {
+	remote := "https://example.com/specs/main.rite"
+	local := filepath.Join("docs", "main.rite")
+
+	tests := []struct {
+		base string
+		ref  string
+		want string
+	}{
+		{remote, "intro.rite", "https://example.com/specs/intro.rite"},
+		{remote, "parts/intro.rite", "https://example.com/specs/parts/intro.rite"},
+		{remote, "https://other.example/intro.rite", "https://other.example/intro.rite"},
+		{local, "intro.rite", filepath.Join("docs", "intro.rite")},
+		{local, "../common/intro.rite", filepath.Join("common", "intro.rite")},
+	}
+	for _, tt := range tests {
+		got, err := resolveInclude(tt.base, tt.ref)
+		if err != nil {
+			t.Errorf("%v from %v: %v", tt.ref, tt.base, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v from %v: got %q, want %q", tt.ref, tt.base, got, tt.want)
+		}
+	}
+
+	// The remote files can not include the local files, nor go up in the site
+	rejected := []string{
+		"/etc/passwd",
+		`\windows\win.ini`,
+		"../secret.rite",
+		"parts/../../secret.rite",
+		`parts\..\..\secret.rite`,
+		"//other.example/intro.rite",
+		"file:///etc/passwd",
+	}
+	for _, ref := range rejected {
+		if got, err := resolveInclude(remote, ref); err == nil {
+			t.Errorf("%v from %v: got %q, want an error", ref, remote, got)
+		}
+	}
+}
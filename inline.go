@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The inline markup in the text of a line is processed by a small tokenizer, so the different kinds of markup
+// can be nested, like in '**bold with __italic__ inside**'. In order of precedence:
+//
+//   - '\x' writes the special character x literally, for any of \ ` $ * _ ~ [ ]
+//   - HTML tags are written as they are, and the content of code elements is not processed
+//   - `code` writes the text literally in a <code> element. Use more backticks to include a backtick in the text
+//   - $math$ writes inline math, rendered by KaTeX
+//   - bare URLs are written as they are, to be converted to links later
+//   - **bold**, __italic__ and ~~removed text~~, which can be nested
+//   - [text](url) writes a link, whose text can have other markup
+
+// The markers of the inline markup that wrap some text, and the HTML element they are converted to
+var inlineMarkers = []struct {
+	marker  string
+	element string
+}{
+	{"**", "b"},
+	{"__", "i"},
+	{"~~", "del"},
+}
+
+// The characters which can be escaped with a backslash
+const inlineEscapable = "\\`$*_~[]"
+
+// inlineMarkup converts the inline markup in a line to HTML.
+// The tag spec at the beginning of the line, if any, is not changed.
+func (doc *Document) inlineMarkup(line string) string {
+	prefix := ""
+	if startsWithTag(line) {
+		end := strings.IndexRune(line, endTagFor[rune(line[0])])
+		if end < 0 {
+			return line
+		}
+		prefix, line = line[:end+1], line[end+1:]
+	}
+
+	out, _, _ := doc.parseInline(line, "")
+	return prefix + out
+}
+
+// parseInline converts the inline markup in the text until the closer is found, or until the end of the text
+// if the closer is empty. It returns the HTML, the number of bytes consumed, including the closer, and if the closer was found.
+func (doc *Document) parseInline(text string, closer string) (string, int, bool) {
+	var sb strings.Builder
+
+	i := 0
+	for i < len(text) {
+		c := text[i]
+
+		// The end of the markup being parsed
+		if len(closer) > 0 && strings.HasPrefix(text[i:], closer) && canCloseInline(text, i, closer) {
+			return sb.String(), i + len(closer), true
+		}
+
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(inlineEscapable, text[i+1]) >= 0:
+			sb.WriteByte(text[i+1])
+			i += 2
+			continue
+
+		case c == '<' && i+1 < len(text) && (isASCIILetter(text[i+1]) || text[i+1] == '/' || text[i+1] == '!'):
+			n := htmlTagLength(text[i:])
+			sb.WriteString(text[i : i+n])
+			i += n
+			continue
+
+		case c == '`':
+			if code, n := parseCodeSpan(text[i:]); n > 0 {
+				sb.WriteString(code)
+				i += n
+				continue
+			}
+
+		case c == '$':
+			if end := closingDollar(text, i+1); end > 0 {
+				sb.WriteString(fmt.Sprintf("<span class=\"math\">%v</span>", html.EscapeString(text[i+1:end])))
+				doc.hasMath = true
+				i = end + 1
+				continue
+			}
+
+		case c == 'h' && atWordStart(text, i) && (strings.HasPrefix(text[i:], "http://") || strings.HasPrefix(text[i:], "https://")):
+			n := strings.IndexFunc(text[i:], func(r rune) bool { return unicode.IsSpace(r) || r == '<' || r == '"' })
+			if n < 0 {
+				n = len(text) - i
+			}
+			sb.WriteString(text[i : i+n])
+			i += n
+			continue
+
+		case c == '[':
+			inner, n, closed := doc.parseInline(text[i+1:], "]")
+			after := i + 1 + n
+			if closed && strings.HasPrefix(text[after:], "(") {
+				if end := strings.IndexByte(text[after:], ')'); end > 0 {
+					url := strings.TrimSpace(text[after+1 : after+end])
+					sb.WriteString(fmt.Sprintf("<a href=\"%v\">%v</a>", url, inner))
+					i = after + end + 1
+					continue
+				}
+			}
+		}
+
+		// The markers of bold, italic and removed text
+		if m := inlineMarkerAt(text, i); m >= 0 && canOpenInline(text, i, inlineMarkers[m].marker) {
+			marker := inlineMarkers[m].marker
+			inner, n, closed := doc.parseInline(text[i+len(marker):], marker)
+			if closed {
+				element := inlineMarkers[m].element
+				sb.WriteString(fmt.Sprintf("<%v>%v</%v>", element, inner, element))
+				i += len(marker) + n
+				continue
+			}
+			// Without closing marker, the marker is just text
+			sb.WriteString(marker)
+			i += len(marker)
+			continue
+		}
+
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), i, false
+}
+
+// inlineMarkerAt returns the index in inlineMarkers of the marker at the position of the text, or -1
+func inlineMarkerAt(text string, i int) int {
+	for m, im := range inlineMarkers {
+		if strings.HasPrefix(text[i:], im.marker) {
+			return m
+		}
+	}
+	return -1
+}
+
+// canOpenInline returns true if the marker in the position can start markup: it must be followed by
+// a non-blank character, and '__' can not be inside a word, like in 'snake__case'
+func canOpenInline(text string, i int, marker string) bool {
+	next := i + len(marker)
+	if next >= len(text) || text[next] == ' ' {
+		return false
+	}
+	if marker == "__" && !atWordStart(text, i) {
+		return false
+	}
+	return true
+}
+
+// canCloseInline returns true if the closer in the position can end markup: it must be preceded by
+// a non-blank character, and '__' can not be inside a word
+func canCloseInline(text string, i int, closer string) bool {
+	if closer == "]" {
+		return true
+	}
+	if i == 0 || text[i-1] == ' ' {
+		return false
+	}
+	if closer == "__" {
+		r, _ := utf8.DecodeRuneInString(text[i+len(closer):])
+		if i+len(closer) < len(text) && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// atWordStart returns true if the position of the text is not preceded by a letter or digit
+func atWordStart(text string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// isASCIILetter returns true if the byte is an ASCII letter
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// htmlTagLength returns the length of the HTML tag at the beginning of the text.
+// The content of the elements whose text is not changed, like <code>, is included with the tag.
+func htmlTagLength(text string) int {
+	end := strings.IndexByte(text, '>')
+	if end < 0 {
+		return len(text)
+	}
+
+	name, closing := htmlTagName(text[:end+1])
+	if closing || !contains(noTypographyElements, name) {
+		return end + 1
+	}
+
+	endTag := strings.Index(strings.ToLower(text), "</"+name)
+	if endTag < 0 {
+		return end + 1
+	}
+	return endTag
+}
+
+// parseCodeSpan returns the HTML of the code span at the beginning of the text, and its length,
+// or zero if there is no code span
+func parseCodeSpan(text string) (string, int) {
+	ticks := len(text) - len(strings.TrimLeft(text, "`"))
+	fence := text[:ticks]
+
+	// The closing backticks must be the same number as the opening ones
+	for from := ticks; from < len(text); {
+		end := strings.Index(text[from:], fence)
+		if end < 0 {
+			return "", 0
+		}
+		end += from
+		after := end + ticks
+		if after < len(text) && text[after] == '`' {
+			// A longer run of backticks is part of the code
+			from = after + len(text[after:]) - len(strings.TrimLeft(text[after:], "`"))
+			continue
+		}
+
+		code := text[ticks:end]
+		// A space at both ends allows the code to start or end with a backtick
+		if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		return "<code>" + html.EscapeString(code) + "</code>", after
+	}
+
+	return "", 0
+}
+
+// mapOutsideCode applies the mapping to the parts of the line outside code spans, whose text is written literally
+func mapOutsideCode(line string, mapping func(string) string) string {
+	var sb strings.Builder
+
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+		case line[i] == '`':
+			_, n := parseCodeSpan(line[i:])
+			if n == 0 {
+				// The rest of the backticks can not start a code span either
+				i += len(line[i:]) - len(strings.TrimLeft(line[i:], "`")) - 1
+				continue
+			}
+			sb.WriteString(mapping(line[start:i]))
+			sb.WriteString(line[i : i+n])
+			i += n - 1
+			start = i + 1
+		}
+	}
+	sb.WriteString(mapping(line[start:]))
+
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A reference to a value of the YAML header, like '{{title}}' or '{{editors.0.name}}'
+var reInterpolation = regexp.MustCompile(`\{\{\s*([0-9a-zA-Z-_\.]+)\s*\}\}`)
+
+// The key in the YAML header with the map of user definitions, which are referenced like the other values
+// but have precedence over them
+const definitionsKey = "definitions"
+
+// lookupValue returns the value of the key in the user definitions or in the YAML header as a string,
+// and if it was found
+func (doc *Document) lookupValue(key string) (string, bool) {
+	if value, found := doc.lookupConfig(definitionsKey + "." + key); found {
+		return value, true
+	}
+	return doc.lookupConfig(key)
+}
+
+// lookupConfig returns the value of the path in the YAML header as a string, and if it was found.
+// Only simple values can be used, not lists or maps.
+func (doc *Document) lookupConfig(path string) (string, bool) {
+	v, err := doc.config.Get(path)
+	if err != nil || v.Data() == nil {
+		return "", false
+	}
+
+	switch v.Data().(type) {
+	case map[string]any, []any:
+		return "", false
+	}
+
+	return fmt.Sprint(v.Data()), true
+}
+
+// interpolate replaces the references to values of the YAML header in the line by the values.
+// References to keys which do not exist are left as they are.
+func (doc *Document) interpolate(lineNum int, line string) string {
+	return reInterpolation.ReplaceAllStringFunc(line, func(ref string) string {
+		key := reInterpolation.FindStringSubmatch(ref)[1]
+		value, found := doc.lookupValue(key)
+		if !found {
+			doc.warnf(lineNum, "unknown-key", "'%v' is not a value in the YAML header", key)
+			return ref
+		}
+		return value
+	})
+}
+
+// expandDefinitions replaces the references to user definitions in a verbatim line.
+// Any other text between '{{' and '}}' is left as it is, because it is common in code.
+func (doc *Document) expandDefinitions(line string) string {
+	return reInterpolation.ReplaceAllStringFunc(line, func(ref string) string {
+		key := reInterpolation.FindStringSubmatch(ref)[1]
+		if value, found := doc.lookupConfig(definitionsKey + "." + key); found {
+			return value
+		}
+		return ref
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The labels of the issues and the to-do notes, translated with localize
+const (
+	issueLabel = "Issue"
+	todoLabel  = "To do"
+)
+
+// Issue is an open question in the document, written with '<x-issue 42>Text' to reference the issue 42
+// of the GitHub repository in the YAML header, or with '<x-issue>Text' or '<x-todo>Text' for notes
+// which are not in the tracker
+type Issue struct {
+	kind    string // The tag, "x-issue" or "x-todo"
+	id      string
+	number  string // The number of the issue in the tracker, if any
+	text    string
+	title   string // The title in the tracker, if requested with 'fetchIssues: true'
+	state   string // The state in the tracker, like "open" or "closed"
+	lineNum int
+}
+
+// issueNumber returns the number of the issue in the tag, like in '<x-issue 42>', or the empty string
+func issueNumber(tagFields map[string]string) string {
+	fields := strings.Fields(tagFields["stdFields"])
+	if len(fields) == 0 || strings.Trim(fields[0], "0123456789") != "" {
+		return ""
+	}
+	return fields[0]
+}
+
+// preprocessIssueID gives an id to an issue or to-do note without one, so they can be linked
+// from the list of open issues
+func (doc *Document) preprocessIssueID(lineNum int, tagFields map[string]string) {
+	name := "todo"
+	if tagFields["tag"] == "x-issue" {
+		name = strings.TrimSpace("issue " + issueNumber(tagFields))
+	}
+	id := doc.uniqueSlug(name)
+
+	line := doc.lines[lineNum]
+	tagName := tagFields["tag"]
+	doc.lines[lineNum] = line[:1+len(tagName)] + " #" + id + line[1+len(tagName):]
+
+	tagFields["id"] = id
+	doc.autoIDs[id] = true
+}
+
+// preprocessIssue converts an <x-issue> or <x-todo> tag into a highlighted box with its label,
+// which links to the issue in GitHub when it has a number and the repository is in the YAML header,
+// like 'github: hesusruiz/rite'
+func (doc *Document) preprocessIssue(lineNum int, tagFields map[string]string) {
+	issue := &Issue{kind: tagFields["tag"], id: tagFields["id"], text: strings.TrimSpace(tagFields["restLine"]), lineNum: lineNum}
+	doc.issues = append(doc.issues, issue)
+
+	class := "todo"
+	label := doc.localize(todoLabel)
+	stdFields := tagFields["stdFields"]
+	if issue.kind == "x-issue" {
+		class = "issue"
+		label = doc.localize(issueLabel)
+		if issue.number = issueNumber(tagFields); len(issue.number) > 0 {
+			label = label + " " + issue.number
+			stdFields = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(stdFields), issue.number))
+		}
+	}
+
+	if href := doc.issueURL(issue.number); len(href) > 0 {
+		label = fmt.Sprintf("<a href=\"%v\">%v</a>", href, label)
+		if doc.config.Bool("fetchIssues") {
+			doc.fetchIssue(issue)
+		}
+	}
+	if len(issue.title) > 0 {
+		label = fmt.Sprintf("%v: %v", label, html.EscapeString(issue.title))
+	}
+	if len(issue.state) > 0 {
+		label = fmt.Sprintf("%v <span class=\"issue-state\">(%v)</span>", label, issue.state)
+	}
+
+	// The box keeps the id, class and other attributes of the tag
+	if c := tagFields["class"]; len(c) > 0 {
+		class = class + " " + c
+	}
+	box := fmt.Sprintf("<div #%v class=\"%v\"", issue.id, class)
+	if len(stdFields) > 0 {
+		box = box + " " + stdFields
+	}
+
+	doc.lines[lineNum] = fmt.Sprintf("%v><span class=\"issue-label\">%v</span> %v", box, label, issue.text)
+}
+
+// githubRepo returns the owner and name of the GitHub repository in the YAML header, like "hesusruiz/rite",
+// which can also be written as the URL of the repository
+func (doc *Document) githubRepo() string {
+	repo := strings.TrimSpace(doc.config.String("github"))
+	repo = strings.TrimPrefix(repo, "https://")
+	repo = strings.TrimPrefix(repo, "github.com/")
+	return strings.Trim(repo, "/")
+}
+
+// issueURL returns the URL of the issue in GitHub, or the empty string if the issue has no number
+// or there is no repository
+func (doc *Document) issueURL(number string) string {
+	repo := doc.githubRepo()
+	if len(number) == 0 || len(repo) == 0 {
+		return ""
+	}
+	return "https://github.com/" + repo + "/issues/" + number
+}
+
+// fetchIssue sets the title and state of the issue from GitHub.
+// The responses are cached like the other resources downloaded from the network.
+func (doc *Document) fetchIssue(issue *Issue) {
+	content, err := fetchURL("https://api.github.com/repos/" + doc.githubRepo() + "/issues/" + issue.number)
+	if err != nil {
+		doc.warnf(issue.lineNum, "issue", "error getting issue %v from GitHub: %v", issue.number, err)
+		return
+	}
+
+	var ghIssue struct {
+		Title string `json:"title"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(content, &ghIssue); err != nil {
+		doc.warnf(issue.lineNum, "issue", "invalid response from GitHub for issue %v: %v", issue.number, err)
+		return
+	}
+
+	issue.title = ghIssue.Title
+	issue.state = ghIssue.State
+}
+
+// issuesSection returns the list of the issues and to-do notes which are not closed, with links to them
+func (doc *Document) issuesSection() string {
+	var sb strings.Builder
+
+	for _, issue := range doc.issues {
+		if issue.state == "closed" {
+			continue
+		}
+
+		label := doc.localize(todoLabel)
+		if issue.kind == "x-issue" {
+			label = strings.TrimSpace(doc.localize(issueLabel) + " " + issue.number)
+		}
+		text := issue.text
+		if len(issue.title) > 0 {
+			text = html.EscapeString(issue.title)
+		}
+		entry := fmt.Sprintf("<a href=\"#%v\">%v</a>", issue.id, label)
+		if len(text) > 0 {
+			entry = entry + ": " + text
+		}
+		sb.WriteString("<li>" + entry + "</li>\n")
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "<ul class=\"issues\">\n" + sb.String() + "</ul>\n"
+}
+
+// The placeholder where the list of open issues is written, replaced when the whole document has been processed
+const issuesPlaceholder = "{#issues}"
+
+// startsWithIssues returns true if the line is the <x-issues> tag, which marks where the list of open issues is written
+func (doc *Document) startsWithIssues(lineNum int) bool {
+	return strings.HasPrefix(doc.lines[lineNum], "<x-issues")
+}
+
+// processIssues writes the placeholder of the list of open issues, which is generated when all of them are known
+func (doc *Document) processIssues(lineNum int) int {
+	doc.sb.WriteString(doc.indentStr(lineNum) + issuesPlaceholder + "\n")
+	return lineNum + 1
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The conformance keywords of RFC 2119 and RFC 8174, which have their special meaning only when they are in capitals
+var reKeyword = regexp.MustCompile(`\b(MUST NOT|MUST|REQUIRED|SHALL NOT|SHALL|SHOULD NOT|SHOULD|NOT RECOMMENDED|RECOMMENDED|MAY|OPTIONAL)\b`)
+
+// The keywords of two words written partially in capitals, like 'MUST not', which are probably a mistake
+var reKeywordMisuse = regexp.MustCompile(`\b(MUST not|Must NOT|SHALL not|Shall NOT|SHOULD not|Should NOT|NOT recommended|Not RECOMMENDED)\b`)
+
+// A heading, like '<h2 .informative>Introduction'
+var reHeadingAttrs = regexp.MustCompile(`^[<{]h([1-6])(\s[^>}]*)?`)
+
+// A block which is a note, like '<x-note>', '<div .note>' or '<p class="note">'
+var reNoteTag = regexp.MustCompile(`^[<{](x-note\b|[a-zA-Z][a-zA-Z0-9-]*\s[^>}]*(\.note\b|class="[^"]*\bnote\b))`)
+
+// The elements where the keywords are not highlighted
+var noKeywordElements = []string{"pre", "code", "kbd", "samp", "script", "style", "textarea"}
+
+// keywordScope is where the lines being preprocessed are, to check that the conformance keywords are only
+// used in normative text
+type keywordScope struct {
+	informativeLevel int // The level of the heading of the informative section, or 0 if the section is normative
+	noteIndentation  int // The indentation of the note, or -1 if the line is not in a note
+}
+
+// preprocessKeywords highlights the conformance keywords of RFC 2119 in the line, if requested with 'rfc2119: true'
+// in the YAML header. The keywords should not be used in the informative sections, which are the ones whose
+// heading has the 'informative' class, nor in notes.
+func (doc *Document) preprocessKeywords(lineNum int, scope *keywordScope) {
+	line := doc.lines[lineNum]
+	indentation := doc.indentations[lineNum]
+
+	// A heading starts a new section, which is informative if the heading says so or it is inside an informative section
+	if m := reHeadingAttrs.FindStringSubmatch(line); m != nil {
+		level := int(m[1][0] - '0')
+		if scope.informativeLevel > 0 && level <= scope.informativeLevel {
+			scope.informativeLevel = 0
+		}
+		if scope.informativeLevel == 0 && hasClass(m[2], "informative") {
+			scope.informativeLevel = level
+		}
+	}
+
+	// The notes end with the first line which is not indented more than the note
+	if scope.noteIndentation >= 0 && indentation <= scope.noteIndentation {
+		scope.noteIndentation = -1
+	}
+	if scope.noteIndentation < 0 && reNoteTag.MatchString(line) {
+		scope.noteIndentation = indentation
+	}
+
+	if m := reKeywordMisuse.FindString(line); len(m) > 0 {
+		doc.warnf(lineNum, "rfc2119", "'%v' mixes capitals and lowercase, use '%v' for the conformance keyword or lowercase otherwise", m, strings.ToUpper(m))
+	}
+
+	doc.lines[lineNum] = mapText(line, noKeywordElements, func(text string) string {
+		return reKeyword.ReplaceAllStringFunc(text, func(keyword string) string {
+			switch {
+			case scope.noteIndentation >= 0:
+				doc.warnf(lineNum, "rfc2119", "conformance keyword '%v' in a note", keyword)
+			case scope.informativeLevel > 0:
+				doc.warnf(lineNum, "rfc2119", "conformance keyword '%v' in an informative section", keyword)
+			}
+			return fmt.Sprintf("<em class=\"rfc2119\">%v</em>", keyword)
+		})
+	})
+}
+
+// The class attribute of a tag
+var reClassAttr = regexp.MustCompile(`class="([^"]*)"`)
+
+// hasClass returns true if the attributes of a tag have the class, with the shortcut syntax or the class attribute
+func hasClass(attributes string, class string) bool {
+	for _, f := range strings.Fields(attributes) {
+		if f == "."+class {
+			return true
+		}
+	}
+	if m := reClassAttr.FindStringSubmatch(attributes); m != nil {
+		return contains(strings.Fields(m[1]), class)
+	}
+	return false
+}
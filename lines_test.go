@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineEndings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"LF", "one\ntwo\n\nthree\n", []string{"one", "two", "", "three"}},
+		{"CRLF", "one\r\ntwo\r\n\r\nthree\r\n", []string{"one", "two", "", "three"}},
+		{"lone CR", "one\rtwo\r\rthree\r", []string{"one", "two", "", "three"}},
+		{"mixed", "one\r\ntwo\rthree\n\r\nfour", []string{"one", "two", "three", "", "four"}},
+		{"without end of line at the end", "one\r\ntwo", []string{"one", "two"}},
+		{"CR at the end", "one\r", []string{"one"}},
+		{"BOM", "\uFEFFone\ntwo\n", []string{"one", "two"}},
+		{"BOM and CRLF", "\uFEFFone\r\ntwo\r\n", []string{"one", "two"}},
+		{"BOM only at the beginning", "one\n\uFEFFtwo\n", []string{"one", "\uFEFFtwo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			if !reflect.DeepEqual(doc.lines, tt.want) {
+				t.Errorf("got lines %q, want %q", doc.lines, tt.want)
+			}
+
+			// A '\r' at the end of the data read so far may be followed by a '\n' in the next read
+			s := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(tt.src)))
+			doc = NewDocument(s, nil)
+			if !reflect.DeepEqual(doc.lines, tt.want) {
+				t.Errorf("reading byte by byte, got lines %q, want %q", doc.lines, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The links to resources in other sites in the generated HTML, in the text and in the bibliography
+var reExternalLink = regexp.MustCompile(`\s(?:href|src)\s*=\s*"(https?://[^"]+)"`)
+
+// LinkStatus is the result of checking an external link, which is cached to avoid checking it again
+type LinkStatus struct {
+	Status  int       `json:"status"`          // The HTTP status, or 0 if the server could not be reached
+	Error   string    `json:"error,omitempty"` // The description of the problem, if the link is broken
+	Checked time.Time `json:"checked"`
+}
+
+// broken returns true if the link does not lead to the resource
+func (s *LinkStatus) broken() bool {
+	return s.Status < 200 || s.Status >= 400
+}
+
+// linksCacheFile returns the name of the file with the results of the links checked before,
+// or the empty string if there is no cache directory
+func linksCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rite", "links.json")
+}
+
+// readLinksCache returns the links checked before which are still valid. The broken links are always checked again.
+func readLinksCache() map[string]*LinkStatus {
+	cache := map[string]*LinkStatus{}
+	if content, err := os.ReadFile(linksCacheFile()); err == nil {
+		json.Unmarshal(content, &cache)
+	}
+	for link, status := range cache {
+		if status.broken() || time.Since(status.Checked) >= cacheTTL {
+			delete(cache, link)
+		}
+	}
+	return cache
+}
+
+// writeLinksCache writes the results of the links checked. A failure only means they will be checked again.
+func writeLinksCache(cache map[string]*LinkStatus) {
+	name := linksCacheFile()
+	if len(name) == 0 {
+		return
+	}
+	content, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0775); err == nil {
+		os.WriteFile(name, content, 0664)
+	}
+}
+
+// temporary returns true if the link could not be checked because of a problem which may go away if
+// it is checked again, like a timeout or an overloaded server
+func (s *LinkStatus) temporary() bool {
+	return s.Status == 0 || s.Status == http.StatusTooManyRequests || s.Status >= 500
+}
+
+// checkLink checks that a link leads to a resource, retrying after the temporary failures like the downloads
+func checkLink(link string) *LinkStatus {
+	status := requestLink(link)
+	for retry := 1; retry <= httpRetries && status.temporary(); retry++ {
+		time.Sleep(time.Duration(retry*retry) * time.Second)
+		status = requestLink(link)
+	}
+	return status
+}
+
+// requestLink checks a link once, with a HEAD request or with a GET request for the servers which do not support HEAD
+func requestLink(link string) *LinkStatus {
+	status := &LinkStatus{Checked: time.Now()}
+
+	// The client is shared by the links checked at the same time, so each check has its own deadline
+	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+	defer cancel()
+	request := func(method string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, link, nil)
+		if err != nil {
+			return nil, err
+		}
+		return httpClient.Do(req)
+	}
+
+	resp, err := request(http.MethodHead)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = request(http.MethodGet)
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	status.Status = resp.StatusCode
+	if status.broken() {
+		status.Error = resp.Status
+	}
+	return status
+}
+
+// checkLinks checks the links to other sites in the generated HTML of the document, using concurrent requests
+// and the results of the links checked before, and warns about the broken ones in the first line which mentions
+// them. The links which start with any of the allowed prefixes are not checked.
+func (doc *Document) checkLinks(html string, allowed []string, concurrency int) {
+	links := []string{}
+	seen := map[string]bool{}
+	for _, m := range reExternalLink.FindAllStringSubmatch(html, -1) {
+		link := strings.ReplaceAll(m[1], "&amp;", "&")
+		if seen[link] || isAllowedLink(link, allowed) {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	cache := readLinksCache()
+	unchecked := []string{}
+	for _, link := range links {
+		if _, found := cache[link]; !found && !noNetwork {
+			unchecked = append(unchecked, link)
+		}
+	}
+
+	pending := make(chan string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range pending {
+				status := checkLink(link)
+				mutex.Lock()
+				cache[link] = status
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, link := range unchecked {
+		pending <- link
+	}
+	close(pending)
+	wg.Wait()
+
+	writeLinksCache(cache)
+
+	for _, link := range links {
+		status, found := cache[link]
+		if !found {
+			doc.warnf(doc.findLine(link), "unchecked-url", "link to '%v' not checked, network access is disabled", link)
+			continue
+		}
+		if status.broken() {
+			doc.errorf(doc.findLine(link), "broken-url", "link to '%v' is broken: %v", link, status.Error)
+		}
+	}
+	doc.log.Infof("%v links checked", len(links))
+}
+
+// isAllowedLink returns true if the link starts with any of the prefixes
+func isAllowedLink(link string, allowed []string) bool {
+	for _, prefix := range allowed {
+		if strings.HasPrefix(link, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// processCheckLinks processes a document and checks the links to other sites in it, reporting the broken ones
+func processCheckLinks(c *cli.Context) error {
+	noNetwork = c.Bool("no-network")
+	httpTimeout = c.Duration("http-timeout")
+	httpRetries = c.Int("http-retries")
+	if err := setupTLS(c.String("ca-cert"), c.Bool("insecure")); err != nil {
+		return fmt.Errorf("invalid --ca-cert: %w", err)
+	}
+	diagFormat = c.String("diag-format")
+
+	inputFileName := "index.txt"
+	if c.Args().Present() {
+		inputFileName = c.Args().First()
+	}
+	if _, err := os.Stat(inputFileName); err != nil {
+		return err
+	}
+
+	config := zap.NewDevelopmentConfig()
+	config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	config.DisableCaller = true
+	config.DisableStacktrace = true
+	z, err := config.Build()
+	if err != nil {
+		return err
+	}
+	sugar := z.Sugar()
+	defer sugar.Sync()
+
+	var b *Document
+	if aborted := catchFatal(func() {
+		b = NewDocumentFromFile(inputFileName, sugar)
+		b.checkLinks(b.ToHTML(), c.StringSlice("allow"), c.Int("concurrency"))
+	}); aborted != nil {
+		b = aborted
+	}
+
+	b.ReportDiagnostics()
+	if len(b.Errors()) > 0 {
+		return fmt.Errorf("errors processing %v", inputFileName)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckLinkRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	defer func(retries int) { httpRetries = retries }(httpRetries)
+
+	httpRetries = 0
+	if status := checkLink(server.URL); !status.broken() {
+		t.Errorf("got status %v without retries, want a broken link", status.Status)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	httpRetries = 1
+	if status := checkLink(server.URL); status.broken() {
+		t.Errorf("got status %v after retrying, want %v", status.Status, http.StatusOK)
+	}
+}
+
+func TestCheckLinksTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	defer func(timeout time.Duration, retries int) { httpTimeout, httpRetries = timeout, retries }(httpTimeout, httpRetries)
+	httpTimeout = 100 * time.Millisecond
+	httpRetries = 0
+
+	// The results are cached in a temporary directory
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	doc := newTestDocument("Text.\n")
+	html := `<a href="` + server.URL + `/slow">slow</a> <a href="` + server.URL + `/fast">fast</a> <a href="` + server.URL + `/other">other</a>`
+	doc.checkLinks(html, nil, 3)
+
+	if errors := doc.Errors(); len(errors) != 1 {
+		t.Errorf("got errors %v, want only the slow link", errors)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The translations of the text generated by rite, like the labels of the figures or the titles of the
+// generated sections. The text in English is the key, and it is used when there is no translation.
+var locales = map[string]map[string]string{
+	"es": {
+		figureLabel:         "Figura",
+		tableLabel:          "Tabla",
+		equationLabel:       "Ecuación",
+		issueLabel:          "Cuestión",
+		todoLabel:           "Pendiente",
+		"Note":              "Nota",
+		"Warning":           "Advertencia",
+		"Details":           "Detalles",
+		"Source":            "Código fuente",
+		"Copy":              "Copiar",
+		"Copied":            "Copiado",
+		exampleLabel:        "Ejemplo",
+		"List of Examples":  "Índice de ejemplos",
+		"References":        "Referencias",
+		"Open issues":       "Cuestiones abiertas",
+		"Table of Contents": "Índice",
+		"List of Figures":   "Índice de figuras",
+		"List of Tables":    "Índice de tablas",
+		"Index":             "Índice",
+		"Search":            "Buscar",
+		"Search...":         "Buscar...",
+	},
+	"de": {
+		figureLabel:         "Abbildung",
+		tableLabel:          "Tabelle",
+		equationLabel:       "Gleichung",
+		issueLabel:          "Problem",
+		todoLabel:           "Zu erledigen",
+		"Note":              "Hinweis",
+		"Warning":           "Warnung",
+		"Details":           "Details",
+		"Source":            "Quelltext",
+		"Copy":              "Kopieren",
+		"Copied":            "Kopiert",
+		exampleLabel:        "Beispiel",
+		"List of Examples":  "Beispielverzeichnis",
+		"References":        "Literaturverzeichnis",
+		"Open issues":       "Offene Probleme",
+		"Table of Contents": "Inhaltsverzeichnis",
+		"List of Figures":   "Abbildungsverzeichnis",
+		"List of Tables":    "Tabellenverzeichnis",
+		"Index":             "Übersicht",
+		"Search":            "Suche",
+		"Search...":         "Suchen...",
+	},
+	"fr": {
+		figureLabel:         "Figure",
+		tableLabel:          "Tableau",
+		equationLabel:       "Équation",
+		issueLabel:          "Question",
+		todoLabel:           "À faire",
+		"Note":              "Remarque",
+		"Warning":           "Avertissement",
+		"Details":           "Détails",
+		"Source":            "Source",
+		"Copy":              "Copier",
+		"Copied":            "Copié",
+		exampleLabel:        "Exemple",
+		"List of Examples":  "Liste des exemples",
+		"References":        "Références",
+		"Open issues":       "Questions ouvertes",
+		"Table of Contents": "Table des matières",
+		"List of Figures":   "Table des figures",
+		"List of Tables":    "Liste des tableaux",
+		"Index":             "Sommaire",
+		"Search":            "Recherche",
+		"Search...":         "Rechercher...",
+	},
+}
+
+// The key in the YAML header with the translations specified by the user, like 'labels: {Figure: Fig.}',
+// which have precedence over the ones of the language
+const labelsKey = "labels"
+
+// Lang returns the language of the document in the YAML header, like 'lang: es', or English by default
+func (doc *Document) Lang() string {
+	return doc.config.String("lang", "en")
+}
+
+// localize returns the text generated by rite in the language of the document
+func (doc *Document) localize(text string) string {
+	if label, found := doc.config.Map(labelsKey)[text]; found {
+		return fmt.Sprint(label)
+	}
+
+	// The language may have a region, like 'es-ES', which uses the translations of the language
+	lang := strings.ToLower(doc.Lang())
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if label, found := locales[lang][text]; found {
+		return label
+	}
+
+	return text
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// The Language Server Protocol server, so editors can show the problems in a document while it is written,
+// its outline, and help navigating and writing references to ids.
+// The messages are JSON-RPC, framed with a Content-Length header and exchanged through stdin and stdout.
+
+// LSP constants used by the server
+const (
+	lspTextDocumentSyncFull = 1
+	lspSeverityError        = 1
+	lspSeverityWarning      = 2
+	lspSymbolKindString     = 15
+	lspCompletionKindRef    = 18
+	lspErrMethodNotFound    = -32601
+	lspErrInvalidParams     = -32602
+)
+
+type lspRequest struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   lspError         `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspTextDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspTextDocumentParams struct {
+	TextDocument   lspTextDocumentItem `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Position     lspPosition               `json:"position"`
+}
+
+// lspFile is a document opened in the editor, with its text and the result of processing it
+type lspFile struct {
+	text  string
+	lines []string
+	doc   *Document
+}
+
+// LSPServer serves the documents opened in an editor
+type LSPServer struct {
+	in    *bufio.Reader
+	out   io.Writer
+	files map[string]*lspFile
+}
+
+// NewLSPServer creates a server reading requests from r and writing responses to w
+func NewLSPServer(r io.Reader, w io.Writer) *LSPServer {
+	return &LSPServer{
+		in:    bufio.NewReader(r),
+		out:   w,
+		files: make(map[string]*lspFile),
+	}
+}
+
+// Serve processes the messages from the client until it asks the server to exit or closes the connection
+func (srv *LSPServer) Serve() error {
+
+	for {
+		req, err := srv.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rpcErr := srv.handle(req)
+
+		// Notifications do not have an id and do not get a response
+		if req.ID == nil {
+			continue
+		}
+
+		if rpcErr != nil {
+			err = srv.writeMessage(lspErrorResponse{JSONRPC: "2.0", ID: req.ID, Error: *rpcErr})
+		} else {
+			err = srv.writeMessage(lspResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readMessage reads the headers and the content of a message
+func (srv *LSPServer) readMessage() (*lspRequest, error) {
+	length := -1
+
+	for {
+		line, err := srv.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header: %v", line)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length header")
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(srv.in, content)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &lspRequest{}
+	err = json.Unmarshal(content, req)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// writeMessage writes a message with its Content-Length header
+func (srv *LSPServer) writeMessage(msg any) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(srv.out, "Content-Length: %v\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// handle processes a request or notification, returning the result or an error for the client
+func (srv *LSPServer) handle(req *lspRequest) (any, *lspError) {
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       lspTextDocumentSyncFull,
+				"documentSymbolProvider": true,
+				"definitionProvider":     true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{" ", "["},
+				},
+			},
+			"serverInfo": map[string]any{
+				"name": "rite",
+			},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen", "textDocument/didChange":
+		params := &lspTextDocumentParams{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			return nil, &lspError{Code: lspErrInvalidParams, Message: err.Error()}
+		}
+		text := params.TextDocument.Text
+		if len(params.ContentChanges) > 0 {
+			// With full synchronization, the last change has the whole text
+			text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		}
+		srv.update(params.TextDocument.URI, text)
+		return nil, nil
+
+	case "textDocument/didClose":
+		params := &lspTextDocumentParams{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			return nil, &lspError{Code: lspErrInvalidParams, Message: err.Error()}
+		}
+		delete(srv.files, params.TextDocument.URI)
+		srv.publishDiagnostics(params.TextDocument.URI, []lspDiagnostic{})
+		return nil, nil
+
+	case "textDocument/documentSymbol":
+		params := &lspTextDocumentPositionParams{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			return nil, &lspError{Code: lspErrInvalidParams, Message: err.Error()}
+		}
+		return srv.documentSymbols(params.TextDocument.URI), nil
+
+	case "textDocument/definition":
+		params := &lspTextDocumentPositionParams{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			return nil, &lspError{Code: lspErrInvalidParams, Message: err.Error()}
+		}
+		return srv.definition(params.TextDocument.URI, params.Position), nil
+
+	case "textDocument/completion":
+		params := &lspTextDocumentPositionParams{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			return nil, &lspError{Code: lspErrInvalidParams, Message: err.Error()}
+		}
+		return srv.completion(params.TextDocument.URI, params.Position), nil
+	}
+
+	// Unknown notifications, like 'initialized', are ignored
+	if req.ID == nil {
+		return nil, nil
+	}
+	return nil, &lspError{Code: lspErrMethodNotFound, Message: "method not supported: " + req.Method}
+}
+
+// uriToFileName returns the name of the file for a 'file:' URI, or the empty string for other URIs
+func uriToFileName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// analyzeDocument processes the text of a document to find its problems, headings and ids.
+// The whole content is generated and checked, because some problems are found only at the end, like the
+// links to fragments which do not exist. The template is not applied, because its problems are not
+// problems of the text being edited.
+func analyzeDocument(fileName string, text string) *Document {
+	var doc *Document
+
+	// A document with unrecoverable syntax errors is returned as it was when the error was found
+	if aborted := catchFatal(func() {
+		doc = newDocument(fileName, bufio.NewScanner(strings.NewReader(text)), nil)
+		content, _ := doc.render()
+		doc.check(content)
+	}); aborted != nil {
+		return aborted
+	}
+	return doc
+}
+
+// update processes the new text of a document and sends its problems to the client
+func (srv *LSPServer) update(uri string, text string) {
+	file := &lspFile{
+		text:  text,
+		lines: strings.Split(text, "\n"),
+		doc:   analyzeDocument(uriToFileName(uri), text),
+	}
+	srv.files[uri] = file
+
+	// The problems in included files are not shown, as they are reported for those files
+	diagnostics := []lspDiagnostic{}
+	for _, d := range file.doc.Diagnostics() {
+		if d.File != file.doc.fileName {
+			continue
+		}
+		severity := lspSeverityError
+		if d.Severity == SeverityWarning {
+			severity = lspSeverityWarning
+		}
+		// The problems of the whole document are shown in its first line
+		lineNum := d.Line - 1
+		if lineNum < 0 {
+			lineNum = 0
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    file.lineRange(lineNum),
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "rite",
+			Message:  d.Msg,
+		})
+	}
+	srv.publishDiagnostics(uri, diagnostics)
+}
+
+// publishDiagnostics sends to the client the problems in a document
+func (srv *LSPServer) publishDiagnostics(uri string, diagnostics []lspDiagnostic) {
+	err := srv.writeMessage(lspNotification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: map[string]any{
+			"uri":         uri,
+			"diagnostics": diagnostics,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+}
+
+// localLine returns the line in the file (starting at 0) of a line of the processed document,
+// and false if the line comes from an included file
+func (file *lspFile) localLine(lineNum int) (int, bool) {
+	origin := file.doc.origin(lineNum)
+	if origin.fileName != file.doc.fileName {
+		return 0, false
+	}
+	return origin.lineNum - 1, true
+}
+
+// lineRange returns the range of the text in a line of the file, without the indentation
+func (file *lspFile) lineRange(lineNum int) lspRange {
+	if lineNum < 0 || lineNum >= len(file.lines) {
+		return lspRange{Start: lspPosition{Line: lineNum}, End: lspPosition{Line: lineNum}}
+	}
+	line := strings.TrimRight(file.lines[lineNum], "\r")
+	start := len(line) - len(strings.TrimLeft(line, " "))
+	return lspRange{
+		Start: lspPosition{Line: lineNum, Character: utf16Column(line, start)},
+		End:   lspPosition{Line: lineNum, Character: utf16Column(line, len(line))},
+	}
+}
+
+// utf16Column returns the column of the LSP positions, which counts UTF-16 code units, of a byte offset in the line
+func utf16Column(line string, offset int) int {
+	column := 0
+	for _, r := range line[:offset] {
+		column++
+		if r >= 0x10000 {
+			// The characters outside the Basic Multilingual Plane are written as a surrogate pair
+			column++
+		}
+	}
+	return column
+}
+
+// byteOffset returns the byte offset in the line of a column of the LSP positions, which counts UTF-16 code units
+func byteOffset(line string, column int) int {
+	n := 0
+	for i, r := range line {
+		if n >= column {
+			return i
+		}
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return len(line)
+}
+
+// documentSymbols returns the outline of a document, with the headings nested by level
+func (srv *LSPServer) documentSymbols(uri string) []lspDocumentSymbol {
+	file := srv.files[uri]
+	if file == nil {
+		return []lspDocumentSymbol{}
+	}
+
+	// The symbols of the headings enclosing the current one, and their levels
+	root := lspDocumentSymbol{}
+	parents := []*lspDocumentSymbol{&root}
+	levels := []int{0}
+
+	for _, h := range file.doc.headings {
+		lineNum, local := file.localLine(h.lineNum)
+		if !local {
+			continue
+		}
+
+		for len(levels) > 1 && levels[len(levels)-1] >= h.level {
+			parents = parents[:len(parents)-1]
+			levels = levels[:len(levels)-1]
+		}
+
+		name := plainText(h.title)
+		if len(name) == 0 {
+			name = fmt.Sprintf("h%v", h.level)
+		}
+		r := file.lineRange(lineNum)
+
+		parent := parents[len(parents)-1]
+		parent.Children = append(parent.Children, lspDocumentSymbol{
+			Name:           name,
+			Kind:           lspSymbolKindString,
+			Range:          r,
+			SelectionRange: r,
+		})
+		parents = append(parents, &parent.Children[len(parent.Children)-1])
+		levels = append(levels, h.level)
+	}
+
+	if root.Children == nil {
+		return []lspDocumentSymbol{}
+	}
+	return root.Children
+}
+
+// definition returns where the id referenced by the <x-ref> at the given position is defined
+func (srv *LSPServer) definition(uri string, pos lspPosition) []lspLocation {
+	file := srv.files[uri]
+	if file == nil || pos.Line < 0 || pos.Line >= len(file.lines) {
+		return []lspLocation{}
+	}
+
+	line := file.lines[pos.Line]
+	offset := byteOffset(line, pos.Character)
+	for _, m := range reXref.FindAllStringSubmatchIndex(line, -1) {
+		if offset < m[0] || offset > m[1] {
+			continue
+		}
+		id := line[m[2]:m[3]]
+		lineNum, found := file.doc.idLines[id]
+		if !found {
+			return []lspLocation{}
+		}
+
+		// The id may be defined in an included file
+		if local, isLocal := file.localLine(lineNum); isLocal {
+			return []lspLocation{{URI: uri, Range: file.lineRange(local)}}
+		}
+		origin := file.doc.origin(lineNum)
+		if isURL(origin.fileName) {
+			return []lspLocation{}
+		}
+		absName, err := filepath.Abs(origin.fileName)
+		if err != nil {
+			return []lspLocation{}
+		}
+		start := lspPosition{Line: origin.lineNum - 1}
+		return []lspLocation{{URI: "file://" + filepath.ToSlash(absName), Range: lspRange{Start: start, End: start}}}
+	}
+
+	return []lspLocation{}
+}
+
+// The start of a citation before the position being completed, like '[[RFC' or '[[!'
+var reCitationStart = regexp.MustCompile(`\[\[!?[0-9a-zA-Z-_\.]*$`)
+
+// completion returns the keys of the bibliography inside a citation like '[[RFC9068]]', or otherwise
+// the ids defined in the document, which can be referenced with <x-ref>
+func (srv *LSPServer) completion(uri string, pos lspPosition) []lspCompletionItem {
+	file := srv.files[uri]
+	if file == nil {
+		return []lspCompletionItem{}
+	}
+
+	if pos.Line >= 0 && pos.Line < len(file.lines) {
+		line := file.lines[pos.Line]
+		if reCitationStart.MatchString(line[:byteOffset(line, pos.Character)]) {
+			return file.citationCompletion()
+		}
+	}
+
+	ids := make([]string, 0, len(file.doc.idLines))
+	for id := range file.doc.idLines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := []lspCompletionItem{}
+	for _, id := range ids {
+		items = append(items, lspCompletionItem{
+			Label:  id,
+			Kind:   lspCompletionKindRef,
+			Detail: fmt.Sprintf("line %v", file.doc.origin(file.doc.idLines[id]).lineNum),
+		})
+	}
+	return items
+}
+
+// citationCompletion returns the keys of the entries of the bibliography of the document, with their titles
+func (file *lspFile) citationCompletion() []lspCompletionItem {
+	keys := make([]string, 0, len(file.doc.biblio))
+	for key := range file.doc.biblio {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := []lspCompletionItem{}
+	for _, key := range keys {
+		items = append(items, lspCompletionItem{
+			Label:  key,
+			Kind:   lspCompletionKindRef,
+			Detail: file.doc.biblio[key].title,
+		})
+	}
+	return items
+}
+
+// processLSP runs the language server on stdin and stdout
+func processLSP(c *cli.Context) error {
+	return NewLSPServer(os.Stdin, os.Stdout).Serve()
+}
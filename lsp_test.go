@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		code string
+	}{
+		{"broken link", "See <a href=\"#nowhere\">this</a>.\n", "broken-link"},
+		{"unreferenced table", "<x-table #data>Data\n    <tr><td>1</td></tr>\n", "unreferenced-figure"},
+		{"dangling reference", "See <x-ref \"nowhere\">.\n", "dangling-xref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := analyzeDocument("", tt.text)
+			if !hasDiagnostic(doc, tt.code, SeverityWarning) {
+				t.Errorf("no %v warning, diagnostics: %v", tt.code, doc.diagnostics)
+			}
+		})
+	}
+}
+
+func TestAnalyzeDocumentWithFatalError(t *testing.T) {
+	doc := analyzeDocument("", "Text.\n\n<ul>\n    Not an item.\n")
+	if !hasDiagnostic(doc, "list-element", SeverityError) {
+		t.Errorf("no list-element error, diagnostics: %v", doc.diagnostics)
+	}
+}
+
+func TestAnalyzeDocumentWithoutTemplate(t *testing.T) {
+	// The template is not read, so its errors do not hide the problems of the content
+	doc := analyzeDocument("", "---\ntemplate: nowhere.html\n---\n\nSee <a href=\"#nowhere\">this</a>.\n")
+	if hasDiagnostic(doc, "template", SeverityError) {
+		t.Errorf("template error, diagnostics: %v", doc.diagnostics)
+	}
+	if !hasDiagnostic(doc, "broken-link", SeverityWarning) {
+		t.Errorf("no broken-link warning, diagnostics: %v", doc.diagnostics)
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	tests := []struct {
+		line   string
+		offset int
+		column int
+	}{
+		{"abc", 2, 2},
+		{"año", 3, 2},
+		{"año", len("año"), 3},
+		{"😀 x", len("😀 "), 3},
+		{"😀😀x", len("😀😀x"), 5},
+	}
+
+	for _, tt := range tests {
+		if got := utf16Column(tt.line, tt.offset); got != tt.column {
+			t.Errorf("utf16Column(%q, %v) = %v, want %v", tt.line, tt.offset, got, tt.column)
+		}
+		if got := byteOffset(tt.line, tt.column); got != tt.offset {
+			t.Errorf("byteOffset(%q, %v) = %v, want %v", tt.line, tt.column, got, tt.offset)
+		}
+	}
+}
+
+func TestDefinitionAfterWideCharacters(t *testing.T) {
+	srv := NewLSPServer(strings.NewReader(""), &bytes.Buffer{})
+	uri := "file:///tmp/doc.rite"
+	srv.update(uri, "😀😀😀😀 See <x-ref \"data\">.\n\n  <x-table #data>Data\n    <tr><td>ñ</td></tr>\n")
+
+	// The reference starts in the column 14, after four surrogate pairs and ' See '
+	locations := srv.definition(uri, lspPosition{Line: 0, Character: 14})
+	if len(locations) != 1 {
+		t.Fatalf("got locations %v, want one", locations)
+	}
+	want := lspRange{Start: lspPosition{Line: 2, Character: 2}, End: lspPosition{Line: 2, Character: 21}}
+	if locations[0].Range != want {
+		t.Errorf("got range %v, want %v", locations[0].Range, want)
+	}
+
+	// Before the reference, in the middle of the text
+	if locations := srv.definition(uri, lspPosition{Line: 0, Character: 10}); len(locations) != 0 {
+		t.Errorf("got locations %v before the reference", locations)
+	}
+
+	// Outside of the document
+	if locations := srv.definition(uri, lspPosition{Line: -1, Character: 14}); len(locations) != 0 {
+		t.Errorf("got locations %v before the first line", locations)
+	}
+}
+
+func TestCitationCompletion(t *testing.T) {
+	dir := t.TempDir()
+	bibliography := "RFC9068:\n  title: JWT Profile for OAuth 2.0 Access Tokens\nVC:\n  title: Verifiable Credentials Data Model\n"
+	if err := os.WriteFile(filepath.Join(dir, "biblio.yaml"), []byte(bibliography), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewLSPServer(strings.NewReader(""), &bytes.Buffer{})
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "doc.rite"))
+	srv.update(uri, "---\nbibliography: biblio.yaml\n---\n\n<x-table #data>Data\n    <tr><td>1</td></tr>\n\nAs in [[RF and [[!\n")
+
+	labels := func(items []lspCompletionItem) string {
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return strings.Join(names, " ")
+	}
+
+	tests := []struct {
+		name      string
+		character int
+		want      string
+	}{
+		{"inside a citation", len("As in [[RF"), "RFC9068 VC"},
+		{"inside a normative citation", len("As in [[RF and [[!"), "RFC9068 VC"},
+		{"outside a citation", len("As in"), "data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := srv.completion(uri, lspPosition{Line: 7, Character: tt.character})
+			if got := labels(items); got != tt.want {
+				t.Errorf("got completions %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
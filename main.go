@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"html"
+	"io"
 	"os"
 	"path"
 	"regexp"
@@ -14,21 +16,74 @@ import (
 	"github.com/hesusruiz/vcutils/yaml"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// Logger receives the messages logged while the documents and the sites are processed. The command uses
+// a *zap.SugaredLogger, and the programs which embed rite can pass an adapter to their own logging system.
+type Logger interface {
+	Debugf(template string, args ...any)
+	Debugw(msg string, keysAndValues ...any)
+	Infof(template string, args ...any)
+	Warnw(msg string, keysAndValues ...any)
+}
+
 // Document represents a parsed document
 type Document struct {
-	sb           strings.Builder
-	lines        []string       // The lines of the file. We use line numbers to provide meaningful error messages
-	indentations []int          // The indentation for each line in the 'lines' array
-	ids          map[string]int // To provide numbering of different entity classes
-	figs         map[string]int // To provide numbering of figs of different types in the document
-	log          *zap.SugaredLogger
-	config       *yaml.YAML
+	sb             strings.Builder
+	lines          []string          // The lines of the file. We use line numbers to provide meaningful error messages
+	indentations   []int             // The indentation for each line in the 'lines' array
+	ids            map[string]int    // To provide numbering of different entity classes
+	idLines        map[string]int    // The line where each id is defined
+	refLabels      map[string]string // The text of the references to some ids, like "Table 3"
+	figs           map[string]int    // To provide numbering of figs of different types in the document
+	idNumbers      map[string]string // The numbers of the elements with an id, when they are not just the counter, like "A-1"
+	bucketPrefixes map[string]string // The prefix of the numbers in each bucket specified by the user, like "A"
+	log            Logger
+	config         *yaml.YAML
+	bodyStart      int               // The first line after the YAML header, where the content of the document starts
+	nav            string            // The navigation links to other documents, when processing a directory
+	headings       []*Heading        // All the headings in the document, in order
+	fileName       string            // The name of the source file, used to locate the files referenced by the document
+	assets         map[string]string // Where the files referenced by the document are copied, by their absolute path or URL
+	diagnostics    []*Diagnostic     // The errors and warnings found in the source of the document
+	aborted        bool              // True if the processing was aborted by an unrecoverable syntax error
+	sources        []*lineSource     // The files being read while parsing, the last one is the current one
+	origins        []lineOrigin      // The file and line where each line comes from, which may be an included file
+	footnotes      map[string]*Footnote
+	footnoteList   []*Footnote // The footnotes in the order they are referenced
+	hasMath        bool        // True if the document has math, so the template must include KaTeX
+	hasTabs        bool        // True if the document has tabs, so the template must include the script to switch them
+	hasMermaid     bool        // True if the document has Mermaid diagrams, so the template must include Mermaid
+	tabGroups      []*TabGroup
+	snippets       map[string]*Snippet
+	terms          []*Term           // The terms of the glossary, in the order they are defined
+	abbreviations  map[string]string // The abbreviations and their expansions
+	captions       []*Caption        // The captions of the figures and tables, in order
+	autoIDs        map[string]bool   // The ids given automatically to the headings without one
+	docRefs        []*DocRef         // The references to elements of other documents
+	xrefs          []*DocRef         // The references to elements of this document
+	biblio         map[string]*BiblioEntry
+	citations      []string // The keys of the entries of the bibliography, in the order they are cited
+	site           *Site    // The site when processing a directory, to resolve the references to other documents
+	issues         []*Issue // The issues and to-do notes, in order
+	definitions    []*Definition
+	dfnUses        []*DocRef             // The uses of the defined terms, with the term as the id
+	examples       map[int]*Example      // The examples, by the line of their tag
+	imageCopies    map[string]*ImageCopy // The smaller copies of the images, by their path relative to the output file
 }
 
 var debug bool
 
+// verbosity is the number of times the verbose flag was specified
+var verbosity int
+
+// quiet is true when only errors should be reported
+var quiet bool
+
+// sourceLines is true when the block elements in the output have the line number where they are in the source
+var sourceLines bool
+
 const startTag = '{'
 const endTag = '}'
 const startHTMLTag = '<'
@@ -40,6 +95,20 @@ var noSectionElements = []string{
 }
 var headingElements = []string{"h1", "h2", "h3", "h4", "h5", "h6"}
 
+// The special <x-ref> tag, referencing an element by its id, which may be quoted.
+// The text of the link can be given after the id, like in '<x-ref "sec-intro" "this clause">',
+// or can be just the number of the element, like in 'Section <x-ref "sec-intro" num>'.
+var reXref = regexp.MustCompile(`<x-ref +"?([0-9a-zA-Z-_\.]+)"?(?: +(?:"([^"]*)"|(num)))? *>`)
+
+// The <x-ref> tags are replaced by a link with a placeholder for its text,
+// which is resolved when the whole document has been processed
+const xrefReplacement = "<a href=\"#${1}\" class=\"xref\">{#${1}.ref}</a>"
+
+var reXrefPlaceholder = regexp.MustCompile(`\{#([0-9a-zA-Z-_\.]+)\.ref\}`)
+
+// A bare URL in the text, which is not the value of an attribute nor the text of a link
+var reBareURL = regexp.MustCompile(`(^|[\s(])(https?://[^\s<>"]+)`)
+
 var endTagFor = map[rune]rune{
 	startTag:     endTag,
 	startHTMLTag: endHTMLTag,
@@ -52,34 +121,104 @@ var endTagFor = map[rune]rune{
 // 	"p", "b", "i", "hr", "a", "em", "strong", "small", "s",
 // }
 
+// Heading is a section heading of the document, also used to build the outline with the numbered headings
 type Heading struct {
 	subheadings []*Heading
+	level       int    // The level of the heading: 1 for h1, 2 for h2, ...
+	lineNum     int    // The line where the heading is in the source
+	id          string // The id of the heading, if the user specified it
+	title       string // The text of the heading
+	number      string // The section number, like "2.1", or empty if the heading is not numbered
 }
 
 // NewDocument parses the input one line at a time, preprocessing the lines and building
 // a parsed document ready to be processed
-func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
-	re := regexp.MustCompile(`<x-ref +([0-9a-zA-Z-_\.]+) *>`)
+func NewDocument(s *bufio.Scanner, logger Logger) *Document {
+	return newDocument("", s, logger)
+}
 
+// newDocument parses the input, which comes from the given file name when it is not empty.
+// If logger is nil, nothing is logged.
+func newDocument(fileName string, s *bufio.Scanner, logger Logger) *Document {
 	insideVerbatim := false
 	indentationVerbatim := 0
+	escapeVerbatim := false
 
 	// Create and initialize the document structure
 	doc := &Document{}
 	doc.lines = []string{}
 	doc.ids = make(map[string]int)
+	doc.idLines = make(map[string]int)
+	doc.refLabels = make(map[string]string)
 	doc.figs = make(map[string]int)
+	doc.idNumbers = make(map[string]string)
+	doc.bucketPrefixes = make(map[string]string)
+	doc.autoIDs = make(map[string]bool)
+	doc.biblio = make(map[string]*BiblioEntry)
+	doc.assets = make(map[string]string)
+	doc.footnotes = make(map[string]*Footnote)
+	doc.snippets = make(map[string]*Snippet)
+	doc.abbreviations = make(map[string]string)
+	doc.examples = make(map[int]*Example)
+	doc.imageCopies = make(map[string]*ImageCopy)
+	doc.fileName = fileName
 	doc.log = logger
+	if doc.log == nil {
+		doc.log = zap.NewNop().Sugar()
+	}
+	doc.config = yaml.New(map[string]any{})
+
+	keywords := &keywordScope{noteIndentation: -1}
 
 	outline := []*Heading{}
 	previousHeading := "h1"
 
-	// Pre-process all lines as we read them
+	insideYAML := false
+
+	// The prefix of the line comments, which can be changed in the YAML header or disabled with an empty one
+	commentPrefix := "//"
+
+	// The indentation of the block which is excluded because of its 'if' attribute, or -1 if none
+	indentationExcluded := -1
+
+	// True if the user definitions are also expanded in verbatim areas
+	definitionsInVerbatim := false
+
+	// True while inside a block comment, which may span several lines
+	insideComment := false
+
+	// The footnote being defined, which may continue in the following lines
+	var insideFootnote *Footnote
+	indentationFootnote := 0
+
+	// The snippet being defined, whose content are the following lines indented more than the definition
+	var insideSnippet *Snippet
+	indentationSnippet := 0
+
+	// The term of the glossary being defined, whose definition continues in the following lines
+	var insideTerm *Term
+	indentationTerm := 0
+
+	// The figure being preprocessed, whose caption may continue in the following lines
+	var insideFigure *Figure
+	indentationFigure := 0
+
+	// True inside a block of abbreviations, whose lines define one abbreviation each
+	insideAbbr := false
+	indentationAbbr := 0
+
+	// Start reading the document
+	doc.pushSource(&lineSource{scanner: s, fileName: fileName})
+
+	// Pre-process all lines as we read them, including the lines of the included files
 	// This means that we can not use information that resides later in the file
-	for s.Scan() {
+	for {
 
 		// Get a rawLine from the file
-		rawLine := s.Text()
+		rawLine, more := doc.nextLine()
+		if !more {
+			break
+		}
 
 		// Calculate its indentation
 		line := strings.TrimLeft(rawLine, " ")
@@ -97,13 +236,47 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 		// Add the indentation
 		doc.indentations = append(doc.indentations, indentation)
 
+		// We accept YAML data only at the beginning of the file, and it is not preprocessed
+		if lineNum == 0 && strings.HasPrefix(line, "---") {
+			insideYAML = true
+			continue
+		}
+		if insideYAML {
+			if strings.HasPrefix(line, "---") {
+				insideYAML = false
+				doc.bodyStart = doc.preprocessYAMLHeader()
+				commentPrefix = doc.config.String("commentPrefix", commentPrefix)
+				definitionsInVerbatim = doc.config.Bool("definitionsInVerbatim")
+				doc.loadBibliography(lineNum)
+				doc.importDefinitions(lineNum)
+			}
+			continue
+		}
+
+		// The lines of a snippet definition are kept without preprocessing, to be processed where it is used
+		if insideSnippet != nil {
+			if len(line) == 0 || indentation > indentationSnippet {
+				insideSnippet.addLine(rawLine)
+				doc.lines[lineNum] = ""
+				continue
+			}
+			insideSnippet = nil
+		}
+
 		// Preprocess the line if not a blank one
 		if len(doc.lines[lineNum]) > 0 {
 
 			// Special processing for verbatim areas.
 			if insideVerbatim {
-				// Do not process the line if we are still inside a verbatim area
+				// Do not process the line if we are still inside a verbatim area,
+				// except for the user definitions if requested in the YAML header
 				if indentation > indentationVerbatim {
+					if escapeVerbatim {
+						doc.lines[lineNum] = html.EscapeString(doc.lines[lineNum])
+					}
+					if definitionsInVerbatim {
+						doc.lines[lineNum] = doc.expandDefinitions(doc.lines[lineNum])
+					}
 					continue
 				}
 				// Check if we exited the verbatim area
@@ -112,14 +285,153 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 				}
 			}
 
-			// Check if we enter into a verbatim area
-			if strings.HasPrefix(doc.lines[lineNum], "<pre") {
+			// Comments are removed, leaving blank lines so the line numbers do not change.
+			// Block comments start with '<!--' at the beginning of a line and end with the first line with '-->'
+			if insideComment || strings.HasPrefix(doc.lines[lineNum], "<!--") {
+				insideComment = !strings.Contains(doc.lines[lineNum], "-->")
+				doc.lines[lineNum] = ""
+				continue
+			}
+			if len(commentPrefix) > 0 && strings.HasPrefix(doc.lines[lineNum], commentPrefix) {
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// Blocks for profiles which are not selected are removed like comments, including their indented content
+			if indentationExcluded >= 0 {
+				if indentation > indentationExcluded {
+					doc.lines[lineNum] = ""
+					continue
+				}
+				indentationExcluded = -1
+			}
+			if !doc.preprocessCondition(lineNum) {
+				doc.lines[lineNum] = ""
+				indentationExcluded = indentation
+				continue
+			}
+
+			// Include the content of other files, as if it was written here with the same indentation
+			if strings.HasPrefix(doc.lines[lineNum], "<x-include") {
+				doc.preprocessInclude(lineNum)
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// Snippets are defined once and inserted wherever they are used, like included files
+			if strings.HasPrefix(doc.lines[lineNum], "<x-snippet") {
+				insideSnippet = doc.defineSnippet(lineNum)
+				indentationSnippet = indentation
+				doc.lines[lineNum] = ""
+				continue
+			}
+			if strings.HasPrefix(doc.lines[lineNum], "<x-use") {
+				doc.preprocessSnippetUse(lineNum)
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// Code blocks can have the content of a source file, like '<pre @client.go region=auth>'
+			included := false
+			if strings.HasPrefix(doc.lines[lineNum], "<pre") || strings.HasPrefix(doc.lines[lineNum], "<x-example") {
+				included = doc.preprocessCodeInclude(lineNum)
+			}
+
+			// Check if we enter into a verbatim area. Blocks of math, examples and diagrams are also verbatim areas
+			if strings.HasPrefix(doc.lines[lineNum], "<pre") || doc.startsWithMath(lineNum) || strings.HasPrefix(doc.lines[lineNum], "<x-example") || startsWithDiagram(doc.lines[lineNum]) {
 				insideVerbatim = true
 				indentationVerbatim = indentation
+
+				// The content of the examples is written literally, unless they have the 'raw' attribute.
+				// The source files included are escaped already. The source of diagrams is always escaped.
+				escapeVerbatim = strings.HasPrefix(doc.lines[lineNum], "<x-example") && !included && !doc.rawExample(lineNum)
+				escapeVerbatim = escapeVerbatim || startsWithDiagram(doc.lines[lineNum])
 			}
 
+			// Replace the references to user definitions and values in the YAML header, like '{{title}}'
+			doc.lines[lineNum] = doc.interpolate(lineNum, doc.lines[lineNum])
+
+			// The definitions of footnotes are removed from the text, to be written at the end of the document
+			if insideFootnote != nil {
+				if indentation > indentationFootnote {
+					insideFootnote.text = insideFootnote.text + "\n" + doc.footnoteText(lineNum, doc.lines[lineNum])
+					doc.lines[lineNum] = ""
+					continue
+				}
+				insideFootnote = nil
+			}
+			if m := reFootnoteDef.FindStringSubmatch(doc.lines[lineNum]); m != nil {
+				insideFootnote = doc.defineFootnote(lineNum, m[1], doc.footnoteText(lineNum, m[2]))
+				indentationFootnote = indentation
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// Preprocess the references to footnotes
+			doc.lines[lineNum] = doc.replaceFootnoteRefs(lineNum, doc.lines[lineNum])
+
+			// Preprocess the citations of the bibliography
+			doc.lines[lineNum] = doc.replaceCitations(lineNum, doc.lines[lineNum])
+
 			// Preprocess the special <x-ref> tag
-			doc.lines[lineNum] = string(re.ReplaceAll([]byte(doc.lines[lineNum]), []byte("<a href=\"#${1}\" class=\"xref\">[${1}]</a>")))
+			doc.lines[lineNum] = doc.replaceXrefs(lineNum, doc.lines[lineNum])
+
+			// The local images in the text, not only at the start of the line, may be copied to the output location
+			doc.lines[lineNum] = doc.replaceInlineImages(lineNum, doc.lines[lineNum])
+
+			// Preprocess the inline markup, like code, math, bold, italic, removed text and links
+			doc.lines[lineNum] = doc.inlineMarkup(doc.lines[lineNum])
+
+			// Convert the bare URLs in the text to links, unless disabled in the YAML header
+			if doc.config.Bool("linkify", true) {
+				doc.lines[lineNum] = linkify(doc.lines[lineNum])
+			}
+
+			// Preprocess the definitions of terms with <dfn> and their uses, like '<a>term</a>'
+			doc.lines[lineNum] = doc.preprocessDefinitions(lineNum, doc.lines[lineNum])
+			doc.preprocessDefinitionUses(lineNum, doc.lines[lineNum])
+
+			// The definitions of the terms are removed from the text, to be written in the glossary
+			if insideTerm != nil {
+				if indentation > indentationTerm {
+					insideTerm.addLine(doc.lines[lineNum])
+					doc.lines[lineNum] = ""
+					continue
+				}
+				insideTerm = nil
+			}
+			if strings.HasPrefix(doc.lines[lineNum], "<x-term") {
+				insideTerm = doc.defineTerm(lineNum)
+				indentationTerm = indentation
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// The definitions of abbreviations are also removed from the text
+			if insideAbbr {
+				if indentation > indentationAbbr {
+					doc.preprocessAbbreviationLine(lineNum)
+					doc.lines[lineNum] = ""
+					continue
+				}
+				insideAbbr = false
+			}
+			if strings.HasPrefix(doc.lines[lineNum], "<x-abbr>") || strings.HasPrefix(doc.lines[lineNum], "<x-abbr ") {
+				insideAbbr = doc.preprocessAbbreviation(lineNum)
+				indentationAbbr = indentation
+				doc.lines[lineNum] = ""
+				continue
+			}
+
+			// The caption of a figure can continue in the lines indented more than the <x-img> tag
+			if insideFigure != nil {
+				if indentation > indentationFigure {
+					doc.addCaptionLine(insideFigure, doc.lines[lineNum])
+					doc.lines[lineNum] = ""
+					continue
+				}
+				insideFigure = nil
+			}
 
 			// Preprocess Markdown headers ('#') and convert to h1, h2, ...
 			if doc.lines[lineNum][0] == '#' {
@@ -143,8 +455,16 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 
 			}
 
-			// Preprocess Markdown list markers
-			if strings.HasPrefix(doc.lines[lineNum], "- ") {
+			// Preprocess Markdown list markers, including the ones of task lists: '- [ ]' and '- [x]'
+			if taskLine, checked, found := cutTaskMarker(doc.lines[lineNum]); found {
+
+				checkbox := `<input type="checkbox" disabled>`
+				if checked {
+					checkbox = `<input type="checkbox" disabled checked>`
+				}
+				doc.lines[lineNum] = "<li .task-list-item>" + checkbox + taskLine
+
+			} else if strings.HasPrefix(doc.lines[lineNum], "- ") {
 
 				doc.lines[lineNum] = strings.Replace(doc.lines[lineNum], "- ", "<li>", 1)
 
@@ -155,19 +475,27 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 				// Get the end ')'
 				indexRightBracket := strings.IndexRune(line, ')')
 				if indexRightBracket == -1 {
-					doc.log.Fatalw("no closing ) in list bullet", "line", lineNum)
-				}
+					// Leave the line as normal text
+					doc.errorf(lineNum, "list-bullet", "no closing ) in list bullet")
+				} else {
+
+					// Extract the whole tag spec
+					bulletText := line[2:indexRightBracket]
+					bulletText = strings.ReplaceAll(bulletText, " ", "%20")
 
-				// Extract the whole tag spec
-				bulletText := line[2:indexRightBracket]
-				bulletText = strings.ReplaceAll(bulletText, " ", "%20")
+					// And the remaining text in the line
+					restLine := line[indexRightBracket+1:]
 
-				// And the remaining text in the line
-				restLine := line[indexRightBracket+1:]
+					// Update the line in the document
+					doc.lines[lineNum] = "<li =" + bulletText + ">" + restLine
 
-				// Update the line in the document
-				doc.lines[lineNum] = "<li =" + bulletText + ">" + restLine
+				}
+
+			}
 
+			// Highlight the conformance keywords, like MUST or SHOULD, and check where they are used
+			if doc.config.Bool("rfc2119") {
+				doc.preprocessKeywords(lineNum, keywords)
 			}
 
 			// Preprocess tags if they are at the beginning of the line
@@ -175,16 +503,41 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 				tagFields := doc.preprocessTagSpec(lineNum)
 
 				// Preprocess tags with ID fields so they can be referenced later
-				// We also keep a counter so they can be numbered in the final HTML
+				// We also keep a counter so they can be numbered in the final HTML.
+				// The id can also be given with the standard attribute, like in '<dt id="RFC9068">'
 				id := tagFields["id"]
+				if len(id) == 0 {
+					id = stdAttribute(tagFields["stdFields"], "id")
+				}
+
+				// The ids of the definitions of terms, given or automatic, are registered by preprocessDefinitions
+				if tagFields["tag"] == "dfn" && len(tagFields["id"]) == 0 {
+					id = ""
+				}
+
+				// Headings without an id get one derived from their title
+				if contains(headingElements, tagFields["tag"]) && len(id) == 0 {
+					doc.preprocessAutoID(lineNum, tagFields)
+					id = tagFields["id"]
+				}
+
+				// Issues and to-do notes without an id get one, so they can be linked from the list of open issues
+				if (tagFields["tag"] == "x-issue" || tagFields["tag"] == "x-todo") && len(id) == 0 {
+					doc.preprocessIssueID(lineNum, tagFields)
+					id = tagFields["id"]
+				}
+
+				// Tabs without an id get one, so their buttons can select them
+				if tagFields["tag"] == "x-tab" && len(id) == 0 {
+					doc.preprocessTabID(lineNum, tagFields)
+					id = tagFields["id"]
+				}
+
 				if len(id) > 0 {
 
-					// If the user specified the "type" attribute, we use its value as a classification bucket for numbering
-					typ := tagFields["type"]
-					if len(typ) == 0 {
-						// Otherwise, we use the name of the tag as a classification bucket
-						typ = tagFields["tag"]
-					}
+					// If the user specified the "type" attribute, we use its value as a classification bucket for numbering.
+					// Otherwise, we use the name of the tag as a classification bucket
+					typ := tagBucket(tagFields)
 
 					// As an example, if the user does not specify anything, all <figures> with an id will be in the
 					// same bucket and the counter will be incremented for each figure. But the user may differentiate
@@ -192,62 +545,141 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 					// like this: '<figure #picture1 :photos>' or for tables '<figure #tablewithgrowthrate :tables> The
 					// names of the buckets (the string after the ':') can be any, and there may be as many as needed.
 
-					// We don't allow duplicate id
-					if doc.ids[id] > 0 {
-						doc.log.Fatalw("id already used", "line", lineNum, "id", id)
+					// An id given by the user has precedence over the same id given automatically to a heading before
+					if doc.ids[id] > 0 && doc.autoIDs[id] && doc.idLines[id] != lineNum {
+						doc.renameAutoID(id)
 					}
 
-					// Increment the number of elements in this bucket
-					doc.figs[typ] = doc.figs[typ] + 1
-					// And set the current value of the counter for this id.
-					doc.ids[id] = doc.figs[typ]
+					// We don't allow duplicate id, and keep the number of the first element with the id
+					if doc.ids[id] > 0 {
+						doc.errorf(lineNum, "duplicate-id", "id '%v' already used", id)
+					} else {
+						// Increment the number of elements in this bucket
+						doc.figs[typ] = doc.figs[typ] + 1
+						// And set the current value of the counter for this id.
+						doc.ids[id] = doc.figs[typ]
+						doc.idLines[id] = lineNum
+					}
 
 					// // If the special string '{#my.num}' appears in the line, we can perform the replacement.
 					// line = strings.Replace(line, "{#h.num}", fmt.Sprint(b.figs[typ]), 1)
 
 				}
 
+				// Tables are numbered and get a caption with their number
+				if tagFields["tag"] == "x-table" {
+					doc.preprocessTable(lineNum, tagFields)
+				}
+
+				// Figures with images are numbered and get a caption with their number
+				if tagFields["tag"] == "x-img" {
+					insideFigure = doc.preprocessFigure(lineNum, tagFields)
+					indentationFigure = indentation
+				}
+
+				// Equations are numbered, and the references to them show the number
+				if tagFields["tag"] == "x-eq" {
+					doc.preprocessEquation(lineNum, tagFields)
+				}
+
+				// Issues and to-do notes are highlighted boxes, which are also listed with the open issues
+				if tagFields["tag"] == "x-issue" || tagFields["tag"] == "x-todo" {
+					doc.preprocessIssue(lineNum, tagFields)
+				}
+
+				// Diagrams are rendered in the browser from their source
+				if tagFields["tag"] == "x-diagram" {
+					doc.preprocessDiagram(lineNum, tagFields)
+				}
+
+				// Examples are numbered blocks of code with a caption
+				if tagFields["tag"] == "x-example" {
+					doc.preprocessExample(lineNum, tagFields)
+				}
+
+				// Groups of tabs show one of their tabs at a time
+				if tagFields["tag"] == "x-tabs" {
+					doc.preprocessTabs(lineNum, tagFields)
+				}
+				if tagFields["tag"] == "x-tab" {
+					doc.preprocessTab(lineNum, tagFields)
+				}
+
+				// Details are blocks which can be collapsed, with a summary which is always visible
+				if tagFields["tag"] == "x-details" {
+					doc.preprocessDetails(lineNum, tagFields)
+				}
+
+				// Admonitions, like notes and warnings, are highlighted boxes with a label
+				if kind := doc.admonition(tagFields["tag"]); kind != nil {
+					doc.preprocessAdmonition(lineNum, tagFields, kind)
+				}
+
 				// Preprocess headings (h1, h2, h3, ...), creating the tree of content
 				// We accept a heading of a given level only if it is the same level, one more or one less than
 				// the previously encountered heading
 				tagName, htmlTag, rest := doc.processTagSpec(lineNum)
 				if contains(headingElements, tagName) {
+
+					newHeading := &Heading{
+						level:   int(tagName[1] - '0'),
+						lineNum: lineNum,
+						id:      id,
+						title:   strings.TrimSpace(rest),
+					}
+					doc.headings = append(doc.headings, newHeading)
+
 					if !strings.Contains(htmlTag, "no-num") {
 
-						newHeading := &Heading{}
 						switch tagName {
 						case "h1":
 							outline = append(outline, newHeading)
-							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v</span> %v", htmlTag, len(outline), rest)
+							newHeading.number = fmt.Sprint(len(outline))
+							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v</span> %v", htmlTag, newHeading.number, rest)
 							previousHeading = "h1"
 						case "h2":
 							if previousHeading != "h1" && previousHeading != "h2" && previousHeading != "h3" {
-								doc.log.Fatalf("line %v: adding '%v' but previous heading was '%v'\n", len(doc.lines)+1, tagName, previousHeading)
+								doc.errorf(lineNum, "heading-level", "adding '%v' but previous heading was '%v'", tagName, previousHeading)
 							}
 							if len(outline) == 0 {
-								doc.log.Fatalf("line %v: adding '%v' but no 'h1' exists\n", len(doc.lines)+1, tagName)
+								doc.errorf(lineNum, "heading-level", "adding '%v' but no 'h1' exists", tagName)
+								break
 							}
 							l1 := outline[len(outline)-1]
 							l1.subheadings = append(l1.subheadings, newHeading)
-							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v.%v</span> %v", htmlTag, len(outline), len(l1.subheadings), rest)
+							newHeading.number = fmt.Sprintf("%v.%v", len(outline), len(l1.subheadings))
+							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v</span> %v", htmlTag, newHeading.number, rest)
 							previousHeading = "h2"
 						case "h3":
 							if previousHeading != "h2" && previousHeading != "h3" && previousHeading != "h4" {
-								doc.log.Fatalf("line %v: adding '%v' but previous heading was '%v'\n", len(doc.lines)+1, tagName, previousHeading)
+								doc.errorf(lineNum, "heading-level", "adding '%v' but previous heading was '%v'", tagName, previousHeading)
 							}
 							if len(outline) == 0 {
-								doc.log.Fatalf("line %v: adding '%v' but no 'h1' exists\n", len(doc.lines)+1, tagName)
+								doc.errorf(lineNum, "heading-level", "adding '%v' but no 'h1' exists", tagName)
+								break
 							}
 							l1 := outline[len(outline)-1]
 							if len(l1.subheadings) == 0 {
-								doc.log.Fatalf("line %v: adding '%v' but no 'h2' exists\n", len(doc.lines)+1, tagName)
+								doc.errorf(lineNum, "heading-level", "adding '%v' but no 'h2' exists", tagName)
+								break
 							}
 							l2 := l1.subheadings[len(l1.subheadings)-1]
 							l2.subheadings = append(l2.subheadings, newHeading)
-							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v.%v.%v</span> %v", htmlTag, len(outline), len(l1.subheadings), len(l1.subheadings), rest)
+							newHeading.number = fmt.Sprintf("%v.%v.%v", len(outline), len(l1.subheadings), len(l2.subheadings))
+							doc.lines[lineNum] = fmt.Sprintf("%v<span class='secno'>%v</span> %v", htmlTag, newHeading.number, rest)
 							previousHeading = "h3"
 
 						}
+
+						// The references to the number of the heading show its section number, like "3.2"
+						if len(newHeading.number) > 0 && len(id) > 0 && doc.idLines[id] == lineNum {
+							doc.idNumbers[id] = newHeading.number
+						}
+					}
+
+					// The references to the heading show its text, also the ones from other documents
+					if len(id) > 0 && doc.idLines[id] == lineNum {
+						doc.refLabels[id] = plainText(newHeading.title)
 					}
 
 				}
@@ -258,25 +690,79 @@ func NewDocument(s *bufio.Scanner, logger *zap.SugaredLogger) *Document {
 
 	}
 
-	// Check if there was any error
-	err := s.Err()
-	if err != nil {
-		doc.log.Errorw("error scanning the input file", "err", err)
+	// The YAML header was not closed, so it extends until the end of the file
+	if insideYAML {
+		doc.bodyStart = doc.preprocessYAMLHeader()
+		doc.loadBibliography(len(doc.lines) - 1)
+		doc.importDefinitions(len(doc.lines) - 1)
 	}
 
+	doc.checkFootnotes()
+	doc.checkXrefs()
+	doc.checkDefinitions()
+
 	return doc
 
 }
 
-func (doc *Document) preprocessYAMLHeader() int {
-	var err error
+// linkify wraps the bare URLs in the line with anchor tags.
+// The punctuation at the end of the URL is considered part of the text, like in 'see https://example.com.'
+func linkify(line string) string {
+	return reBareURL.ReplaceAllStringFunc(line, func(match string) string {
+		m := reBareURL.FindStringSubmatch(match)
+		url := strings.TrimRight(m[2], ".,;:!?)")
+		trailing := strings.TrimPrefix(m[2], url)
+		return fmt.Sprintf("%v<a href=\"%v\">%v</a>%v", m[1], url, url, trailing)
+	})
+}
 
-	// We accept YAML data only at the beginning of the file
-	if !strings.HasPrefix(doc.lines[0], "---") {
-		doc.log.Debugln("no YAML metadata found")
-		return 0
+// scanLines is a split function for a bufio.Scanner that returns each line of text without its end of line,
+// which can be "\n", "\r\n" or "\r", even mixed in the same file
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A '\r' may be followed by a '\n', which we need to see before deciding
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
 	}
 
+	// The last line may not have an end of line
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	// Request more data
+	return 0, nil, nil
+}
+
+// cutTaskMarker returns the text of a task list item after its marker ('- [ ]' or '- [x]'),
+// if it is checked, and if the line is a task list item at all
+func cutTaskMarker(line string) (rest string, checked bool, found bool) {
+	for _, marker := range []string{"- [ ]", "- [x]", "- [X]"} {
+		if line == marker || strings.HasPrefix(line, marker+" ") {
+			return strings.TrimPrefix(line, marker), marker != "- [ ]", true
+		}
+	}
+	return line, false, false
+}
+
+// preprocessYAMLHeader parses the YAML metadata at the beginning of the file, which must have already been read.
+// It returns the line number where the content of the document starts.
+func (doc *Document) preprocessYAMLHeader() int {
 	var i int
 	var yamlString strings.Builder
 	for i = 1; i < len(doc.lines); i++ {
@@ -285,35 +771,53 @@ func (doc *Document) preprocessYAMLHeader() int {
 			break
 		}
 
+		// Indentation is significant in YAML, so we restore it
+		yamlString.WriteString(doc.indentStr(i))
 		yamlString.WriteString(doc.lines[i])
 		yamlString.WriteString("\n")
 
 	}
 
-	doc.config, err = yaml.ParseYaml(yamlString.String())
+	config, err := yaml.ParseYaml(yamlString.String())
 	if err != nil {
-		doc.log.Fatalw("malformed YAML metadata", "error", err)
+		doc.errorf(0, "yaml", "malformed YAML metadata: %v", err)
+	} else {
+		doc.config = config
+		doc.checkOptions(i)
 	}
 
 	return i
 }
 
-func NewDocumentFromFile(fileName string, logger *zap.SugaredLogger) *Document {
+// NewDocumentFromFile reads and parses the file, converting it to rite if it is written in Markdown or AsciiDoc.
+// Like all the processing of the document, it panics if the document has an unrecoverable syntax error or
+// can not be read, which the callers recover with catchFatal.
+func NewDocumentFromFile(fileName string, logger Logger) *Document {
 
 	// Read the simple template
 	file, err := os.Open(fileName)
 	if err != nil {
-		logger.Fatalln(err)
+		newDocument(fileName, bufio.NewScanner(strings.NewReader("")), logger).fatalf(-1, "read", "%v", err)
 	}
 	defer file.Close()
 
 	linescanner := bufio.NewScanner(file)
 
-	return NewDocument(linescanner, logger)
+	// The Markdown and AsciiDoc files are converted to rite
+	if isMarkdown(fileName) || isAsciiDoc(fileName) {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			newDocument(fileName, bufio.NewScanner(strings.NewReader("")), logger).fatalf(-1, "read", "%v", err)
+		}
+		linescanner = bufio.NewScanner(bytes.NewReader(convertToRite(fileName, content)))
+	}
+
+	return newDocument(fileName, linescanner, logger)
 
 }
 
-func (doc *Document) SetLogger(logger *zap.SugaredLogger) {
+// SetLogger sets where the messages logged while the document is processed are written
+func (doc *Document) SetLogger(logger Logger) {
 	doc.log = logger
 }
 
@@ -335,6 +839,15 @@ func isVoidElement(tagName string) bool {
 	return false
 }
 
+// closedInLine returns true if the element is closed in the same line where it starts, like the rows of a table
+// written in one line, '<tr><td>1</td></tr>', so its end tag is not added again
+func closedInLine(tagName string, line string) bool {
+	line = strings.TrimSpace(line)
+	closes := strings.Count(line, "</"+tagName+">")
+	opens := strings.Count(line, "<"+tagName+">") + strings.Count(line, "<"+tagName+" ")
+	return closes > 0 && closes >= opens && strings.HasSuffix(line, "</"+tagName+">")
+}
+
 func isNoSectionElement(tagName string) bool {
 	for _, el := range noSectionElements {
 		if tagName == el {
@@ -436,53 +949,310 @@ func (doc *Document) skipBlankLines(lineNumber int) int {
 	return len(doc.lines)
 }
 
-func (doc *Document) printPreprocessStats() {
-	fmt.Printf("Number of lines: %v\n", len(doc.lines))
-	fmt.Println()
-	fmt.Printf("Number of ids: %v\n", len(doc.ids))
+func (doc *Document) logPreprocessStats() {
+	doc.log.Debugw("preprocess stats", "lines", len(doc.lines), "ids", len(doc.ids))
 	for k, v := range doc.figs {
-		fmt.Printf("  %v: %v\n", k, v)
+		doc.log.Debugw("preprocess stats", "type", k, "count", v)
 	}
 }
 
 func (doc *Document) ToHTML() string {
-	// Start processing the main block
-	i := doc.preprocessYAMLHeader()
-	doc.ProcessBlock(i)
+	content, replacePairs := doc.render()
+	html := doc.buildPage(content, replacePairs)
+	doc.check(html)
+	return html
+}
+
+// render processes the document and returns its content, without the template, and the pairs of placeholders
+// of the template and their values
+func (doc *Document) render() (string, []string) {
+	// Start processing the main block, after the YAML header
+	doc.ProcessBlock(doc.bodyStart)
 	return doc.postProcess()
 }
 
-// postProcess performs any process that can only be done after the whole document has been processed,
-// like cross references between sections.
-// It returns the final document as a string
-func (doc *Document) postProcess() string {
+// check finds the problems in the generated HTML of the document, which can be the whole page or only its content
+func (doc *Document) check(html string) {
+	// The links to fragments of the document are checked always, because they are easy to misspell
+	doc.checkFragments(html)
+	if validateHTML {
+		doc.checkHTML(html)
+	}
+	if checkAccessibility {
+		doc.auditAccessibility(html)
+	}
+}
 
+// buildPage builds the full page with the content of the document and the template, performing the counter substitution
+func (doc *Document) buildPage(content string, replacePairs []string) string {
 	// Get the name of the template or the default name
-	templateName := doc.config.String("template", "assets/output_template.html")
+	templateName := doc.config.String("template", defaultTemplateName)
 
-	// Build the full document with the template
-	tmpl, err := os.ReadFile(templateName)
+	html, err := applyTemplate(templateName, doc.siteRoot(), content, replacePairs)
 	if err != nil {
-		doc.log.Fatalw("error reading template", "error", err, "name", templateName)
-		panic(err)
+		doc.fatalf(-1, "template", "error reading the template '%v': %v", templateName, err)
 	}
-	html := string(bytes.Replace(tmpl, []byte("HERE_GOES_THE_CONTENT"), []byte(doc.sb.String()), 1))
+
+	if minifyHTML {
+		html = minify(html)
+	} else if prettyHTML {
+		html = pretty(html)
+	}
+
+	return html
+}
+
+// Title returns the title of the document specified in the YAML header
+func (doc *Document) Title() string {
+	return doc.config.String("title", "title")
+}
+
+// postProcess performs any process that can only be done after the whole document has been processed,
+// like cross references between sections.
+// It returns the content of the document and the pairs of placeholders of the template and their values
+func (doc *Document) postProcess() (string, []string) {
+
+	content := doc.sb.String()
+
+	// The glossary is written where the <x-glossary> tag is, or at the end of the document
+	if strings.Contains(content, glossaryPlaceholder) {
+		content = strings.Replace(content, glossaryPlaceholder, doc.glossarySection(), 1)
+	} else {
+		content = content + doc.glossarySection()
+	}
+
+	// The bibliography is written where the <x-bibliography> tag is, or at the end of the document if there are citations
+	if strings.Contains(content, bibliographyPlaceholder) {
+		content = strings.Replace(content, bibliographyPlaceholder, doc.bibliographySection(), 1)
+	} else if len(doc.citations) > 0 {
+		content = content + "<section class=\"references\">\n<h2 class=\"no-num\">" + doc.localize("References") + "</h2>\n" + doc.bibliographySection() + "</section>\n"
+	}
+
+	// The list of open issues is written where the <x-issues> tag is, or at the end of the document if there are any
+	if strings.Contains(content, issuesPlaceholder) {
+		content = strings.Replace(content, issuesPlaceholder, doc.issuesSection(), 1)
+	} else if issues := doc.issuesSection(); len(issues) > 0 {
+		content = content + "<section class=\"open-issues\">\n<h2 class=\"no-num\">" + doc.localize("Open issues") + "</h2>\n" + issues + "</section>\n"
+	}
+
+	// The list of abbreviations is written only where the <x-abbreviations> tag is
+	doc.loadAbbreviations()
+	content = strings.Replace(content, abbreviationsPlaceholder, doc.abbreviationsSection(), 1)
+
+	content = content + doc.footnotesSection()
 
 	replacePairs := []string{}
 	// Calculate the counters placeholders that we have to replace by their actual values
-	for id, v := range doc.ids {
-		replacePairs = append(replacePairs, "{#"+id+".num}", fmt.Sprint(v))
+	for id := range doc.ids {
+		replacePairs = append(replacePairs, "{#"+id+".num}", doc.idNumber(id))
 	}
 
 	// The title in the metadata
-	title := doc.config.String("title", "title")
-	replacePairs = append(replacePairs, "{#title}", title)
+	replacePairs = append(replacePairs, "{#title}", doc.Title())
+	replacePairs = append(replacePairs, "{#lang}", doc.Lang())
+	replacePairs = append(replacePairs, "{#description}", doc.Description())
+	replacePairs = append(replacePairs, "{#meta}", doc.metaTags())
+
+	// The navigation to other documents, only when processing a directory
+	replacePairs = append(replacePairs, "{#nav}", doc.nav)
+
+	// The scripts to render the math, only if the document has math
+	math := ""
+	if doc.hasMath {
+		math = katexIncludes
+	}
+	replacePairs = append(replacePairs, "{#math}", math)
 
-	// Perform the counter substitution on the string representing the document
-	replacer := strings.NewReplacer(replacePairs...)
-	html = replacer.Replace(html)
+	// The script to render the diagrams, only if the document has diagrams
+	diagrams := ""
+	if doc.hasMermaid {
+		diagrams = mermaidIncludes
+	}
+	replacePairs = append(replacePairs, "{#diagrams}", diagrams)
 
-	return html
+	// The script to switch between tabs, only if the document has tabs
+	tabs := ""
+	if doc.hasTabs {
+		tabs = tabsScript
+	}
+	replacePairs = append(replacePairs, "{#tabs}", tabs)
+	replacePairs = append(replacePairs, doc.tabListPairs()...)
+
+	// The script to copy the content of the code blocks, if requested in the YAML header
+	copyCode := ""
+	if doc.config.Bool("copyCode") {
+		copyCode = fmt.Sprintf(copyCodeScript, doc.localize("Copy"), doc.localize("Copied"))
+	}
+	replacePairs = append(replacePairs, "{#copyCode}", copyCode)
+
+	// The text of the references to other elements in the document
+	content = doc.resolveDocRefs(content)
+	content = doc.resolveXrefs(content)
+
+	// The uses of the defined terms and the terms of the glossary are linked to their definitions
+	content = doc.linkDefinitions(content)
+	content = doc.linkTerms(content)
+
+	doc.checkUnusedIds(content)
+
+	// The first occurrence of each abbreviation shows its expansion
+	content = doc.expandAbbreviations(content)
+
+	// Curly quotes, dashes and ellipsis in the text, if requested in the YAML header
+	smart := doc.config.Bool("smartTypography")
+	if smart {
+		content = smartTypography(content)
+	}
+
+	// The table of contents and the lists of figures and tables, if requested in the YAML header.
+	// They are inserted at the top or bottom of the content, or only where the template has the '{#toc}',
+	// '{#listOfFigures}' and '{#listOfTables}' placeholders.
+	toc := ""
+	if doc.config.Bool("toc") {
+		toc = doc.tableOfContents()
+		if smart {
+			toc = smartTypography(toc)
+		}
+	}
+	listOfFigures := ""
+	if doc.config.Bool("listOfFigures") {
+		listOfFigures = doc.listOfCaptions(figureLabel, doc.config.String("listOfFiguresTitle", doc.localize("List of Figures")))
+	}
+	listOfTables := ""
+	if doc.config.Bool("listOfTables") {
+		listOfTables = doc.listOfCaptions(tableLabel, doc.config.String("listOfTablesTitle", doc.localize("List of Tables")))
+	}
+	listOfExamples := ""
+	if doc.config.Bool("listOfExamples") {
+		listOfExamples = doc.listOfCaptions(exampleLabel, doc.config.String("listOfExamplesTitle", doc.localize("List of Examples")))
+	}
+	if smart {
+		listOfFigures = smartTypography(listOfFigures)
+		listOfTables = smartTypography(listOfTables)
+		listOfExamples = smartTypography(listOfExamples)
+	}
+
+	if front := toc + listOfFigures + listOfTables + listOfExamples; len(front) > 0 {
+		switch placement := doc.config.String("tocPlacement", "top"); placement {
+		case "top":
+			content = front + content
+		case "bottom":
+			content = content + front
+		case "template":
+		default:
+			doc.log.Warnw("invalid tocPlacement, must be 'top', 'bottom' or 'template'", "tocPlacement", placement)
+			content = front + content
+		}
+	}
+	replacePairs = append(replacePairs, "{#toc}", toc, "{#listOfFigures}", listOfFigures, "{#listOfTables}", listOfTables, "{#listOfExamples}", listOfExamples)
+
+	return content, replacePairs
+}
+
+// tagBucket returns the classification bucket used to number the elements with the tag:
+// the "type" attribute if specified by the user, or otherwise the name of the tag
+func tagBucket(tagFields map[string]string) string {
+	if typ := tagFields["type"]; len(typ) > 0 {
+		return typ
+	}
+	return tagFields["tag"]
+}
+
+// idNumber returns the number of the element with the id, which is the counter of its bucket unless
+// it has a special number, like the section number of headings ("3.2") or the numbers with prefixes ("A-1")
+func (doc *Document) idNumber(id string) string {
+	if n, found := doc.idNumbers[id]; found {
+		return n
+	}
+	return fmt.Sprint(doc.ids[id])
+}
+
+// resolveXrefs replaces the placeholders of the references to other elements by their text,
+// which is the label of the element (like "Table 3") or by default its id in brackets
+func (doc *Document) resolveXrefs(content string) string {
+	return reXrefPlaceholder.ReplaceAllStringFunc(content, func(placeholder string) string {
+		id := reXrefPlaceholder.FindStringSubmatch(placeholder)[1]
+		if label, found := doc.refLabels[id]; found {
+			return label
+		}
+		return "[" + id + "]"
+	})
+}
+
+// tableOfContents returns the table of contents of the document, with the headings nested by level
+// until the depth specified in the YAML header.
+// The headings are linked when they have an id, and include their section number if they are numbered.
+func (doc *Document) tableOfContents() string {
+	var toc strings.Builder
+
+	depth := doc.config.Int("tocDepth", 3)
+
+	toc.WriteString("<nav class=\"toc\">\n")
+	toc.WriteString(fmt.Sprintf("<h2 class=\"no-num toc-title\">%v</h2>\n", doc.config.String("tocTitle", doc.localize("Table of Contents"))))
+
+	// The levels of the lists which are open
+	levels := []int{}
+
+	for _, h := range doc.headings {
+		if h.level > depth {
+			continue
+		}
+
+		// Close the items and lists of headings at a deeper level than this one
+		for len(levels) > 0 && levels[len(levels)-1] > h.level {
+			toc.WriteString("</li>\n</ol>\n")
+			levels = levels[:len(levels)-1]
+		}
+
+		if len(levels) > 0 && levels[len(levels)-1] == h.level {
+			// A sibling of the previous heading
+			toc.WriteString("</li>\n")
+		} else {
+			// A deeper level, which starts a new list
+			toc.WriteString("<ol class=\"toc\">\n")
+			levels = append(levels, h.level)
+		}
+
+		title := h.title
+		if len(h.number) > 0 {
+			title = fmt.Sprintf("<span class=\"secno\">%v</span> %v", h.number, title)
+		}
+		if len(h.id) > 0 {
+			title = fmt.Sprintf("<a href=\"#%v\">%v</a>", h.id, title)
+		}
+		toc.WriteString(fmt.Sprintf("<li>%v\n", title))
+	}
+
+	for range levels {
+		toc.WriteString("</li>\n</ol>\n")
+	}
+
+	toc.WriteString("</nav>\n")
+
+	return toc.String()
+}
+
+// The template used when the document does not specify one in the YAML header
+const defaultTemplateName = "assets/output_template.html"
+
+// applyTemplate inserts the content in the template and then replaces the placeholders, specified as
+// pairs of old and new strings. The root is the relative path to the site directory of the pages in its subdirectories.
+func applyTemplate(templateName string, root string, content string, replacePairs []string) (string, error) {
+
+	tmpl, err := os.ReadFile(templateName)
+	if err != nil {
+		return "", err
+	}
+
+	// The assets of the template are relative to the site directory, like './assets/w3.css',
+	// so the pages in its subdirectories refer to them through the given root, like '../'
+	if len(root) > 0 {
+		tmpl = bytes.ReplaceAll(tmpl, []byte(`"./assets/`), []byte(`"`+root+`assets/`))
+	}
+	html := string(bytes.Replace(tmpl, []byte("HERE_GOES_THE_CONTENT"), []byte(content), 1))
+
+	replacer := strings.NewReplacer(replacePairs...)
+	return replacer.Replace(html), nil
 }
 
 // preprocessTagSpec returns a map with the tag fields, or nil if not a tag
@@ -520,7 +1290,7 @@ func (doc *Document) preprocessTagSpec(rawLineNum int) (tagFields map[string]str
 	fields := strings.Fields(tagSpec)
 
 	if len(fields) == 0 {
-		doc.log.Fatalf("line %v, error processing Tag, no tag name found in %v", rawLineNum+1, doc.lines[rawLineNum])
+		doc.fatalf(rawLineNum, "tag-name", "error processing tag, no tag name found in %v", doc.lines[rawLineNum])
 	}
 
 	tagFields["tag"] = fields[0]
@@ -534,42 +1304,48 @@ func (doc *Document) preprocessTagSpec(rawLineNum int) (tagFields map[string]str
 		case '#':
 			// Shortcut for id="xxxx"
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["id"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
 		case '.':
 			// Shortcut for class="xxxx"
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["class"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
 		case '@':
 			// Shortcut for src="xxxx"
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["src"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
 		case '-':
 			// Shortcut for href="xxxx"
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["href"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
 		case ':':
 			// Special attribute "type" for item classification and counters
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["type"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
 		case '=':
 			// Special attribute "number" for list items
 			if len(f) < 2 {
-				doc.log.Fatalf("line %v, Length of attributes must be greater than 1", rawLineNum)
+				doc.errorf(rawLineNum, "attribute", "length of attributes must be greater than 1")
+				continue
 			}
 			tagFields["number"] = f[1:]
 			tagSpec = strings.Replace(tagSpec, f, "", 1)
@@ -593,7 +1369,7 @@ func (doc *Document) buildTagPresentation(rawLineNum int, tagFields map[string]s
 
 	// Sanity check
 	if tagFields == nil {
-		doc.log.Fatalln("tagFields is nil")
+		doc.fatalf(rawLineNum, "tag-name", "error processing tag, no tag found in %v", doc.lines[rawLineNum])
 	}
 
 	tagName = tagFields["tag"]
@@ -602,6 +1378,14 @@ func (doc *Document) buildTagPresentation(rawLineNum int, tagFields map[string]s
 	// Build the HTML start tag
 	for k, v := range tagFields {
 
+		// Local files referenced by the document must exist, and may be copied to the output location
+		if k == "src" {
+			doc.checkAsset(rawLineNum, v)
+		}
+		if k == "src" || k == "href" {
+			v = doc.assetPath(v)
+		}
+
 		if k != "tag" && k != "stdFields" && k != "restLine" {
 			htmlTag = htmlTag + fmt.Sprintf(` %v="%v"`, k, v)
 		}
@@ -610,6 +1394,10 @@ func (doc *Document) buildTagPresentation(rawLineNum int, tagFields map[string]s
 		}
 
 	}
+	// The tag may have been already built with the line attribute, like in numbered headings
+	if !strings.Contains(tagFields["stdFields"], "data-rite-line") {
+		htmlTag = htmlTag + doc.lineAttr(rawLineNum)
+	}
 	htmlTag = htmlTag + ">"
 
 	restLine := tagFields["restLine"]
@@ -628,7 +1416,7 @@ func (doc *Document) processTagSpec(rawLineNum int) (tagName string, htmlTag str
 
 	// Sanity check
 	if tagFields == nil {
-		doc.log.Fatalw("no tag in line", "line", rawLineNum, "l", doc.lines[rawLineNum])
+		doc.fatalf(rawLineNum, "tag-name", "error processing tag, no tag found in %v", doc.lines[rawLineNum])
 	}
 
 	return doc.buildTagPresentation(rawLineNum, tagFields)
@@ -657,7 +1445,7 @@ func (doc *Document) processParagraph(startLineNum int) int {
 			tagName = "p"
 
 			// Write the first line
-			doc.sb.WriteString(fmt.Sprintf("%v<%v>%v\n", strings.Repeat(" ", doc.Indentation(startLineNum)), tagName, startLine))
+			doc.sb.WriteString(fmt.Sprintf("%v<%v%v>%v\n", strings.Repeat(" ", doc.Indentation(startLineNum)), tagName, doc.lineAttr(startLineNum), startLine))
 
 		} else {
 			// Write the first line
@@ -676,7 +1464,7 @@ func (doc *Document) processParagraph(startLineNum int) int {
 		tagName = "p"
 
 		// Write the first line
-		doc.sb.WriteString(fmt.Sprintf("%v<%v>%v\n", strings.Repeat(" ", doc.Indentation(startLineNum)), tagName, startLine))
+		doc.sb.WriteString(fmt.Sprintf("%v<%v%v>%v\n", strings.Repeat(" ", doc.Indentation(startLineNum)), tagName, doc.lineAttr(startLineNum), startLine))
 	}
 
 	// Process the rest of contiguous lines in the block, writing them without any processing
@@ -707,25 +1495,22 @@ func (doc *Document) processHeaderParagraph(headerLineNum int) int {
 	var tagName, htmlTag, restLine string
 	var i int
 
-	if debug {
-		fmt.Println("********** Start HEADER", headerLineNum)
-		defer fmt.Println("********** End HEADER", headerLineNum)
-	}
+	doc.log.Debugw("processHeaderParagraph enter", "line", headerLineNum+1)
+	defer doc.log.Debugw("processHeaderParagraph exit", "line", headerLineNum+1)
 
 	// The header should be just the first line
 	thisIndentation := doc.Indentation(headerLineNum)
-	nextIndentation := doc.Indentation(headerLineNum + 1)
 	indentStr := strings.Repeat(" ", thisIndentation)
 
 	// Process the paragraph with attributes
 	tagName, htmlTag, restLine = doc.processTagSpec(headerLineNum)
 
 	if !contains(headingElements, tagName) {
-		doc.log.Fatalf("No header tag found in line %v\n", headerLineNum+1)
+		doc.fatalf(headerLineNum, "heading", "no heading tag found in %v", doc.lines[headerLineNum])
 	}
 
-	// If the next line is empty or indented less than the header, we are done with the header
-	if len(doc.lines[headerLineNum+1]) == 0 || nextIndentation < thisIndentation {
+	// If the header is the last line, or the next line is empty or indented less than the header, we are done with the header
+	if doc.AtEOF(headerLineNum+1) || len(doc.lines[headerLineNum+1]) == 0 || doc.Indentation(headerLineNum+1) < thisIndentation {
 		// Write the first line and the end tag
 		doc.sb.WriteString(fmt.Sprintf("%v%v%v</%v>\n\n", indentStr, htmlTag, restLine, tagName))
 
@@ -752,6 +1537,15 @@ func (doc *Document) indentStr(lineNum int) string {
 	return strings.Repeat(" ", doc.Indentation(lineNum))
 }
 
+// lineAttr returns the attribute with the line number (starting at 0) of an element in the source file,
+// or the empty string if the user did not ask for them
+func (doc *Document) lineAttr(lineNum int) string {
+	if !sourceLines {
+		return ""
+	}
+	return fmt.Sprintf(` data-rite-line="%v"`, doc.origin(lineNum).lineNum)
+}
+
 func (doc *Document) ProcessList(startLineNum int) int {
 	var i int
 
@@ -766,10 +1560,10 @@ func (doc *Document) ProcessList(startLineNum int) int {
 
 	// Sanity check: verify that only "ol" or "ul" are accepted
 	if tagFields == nil {
-		doc.log.Fatalw("no tag, expecting lists ol or ul", "line", startLineNum+1)
+		doc.fatalf(startLineNum, "list-element", "no tag, expecting lists ol or ul in %v", doc.lines[startLineNum])
 	}
 	if tagFields["tag"] != "ol" && tagFields["tag"] != "ul" {
-		doc.log.Fatalw("invalid tag, expecting lists ol or ul", "line", startLineNum+1)
+		doc.fatalf(startLineNum, "list-element", "invalid tag '%v', expecting lists ol or ul", tagFields["tag"])
 	}
 
 	// Calculate the unique list ID, if it was not specified by the user
@@ -846,7 +1640,7 @@ func (doc *Document) ProcessList(startLineNum int) int {
 			tagName, htmlTag, restLine = doc.buildTagPresentation(i, tagFields)
 
 		} else {
-			doc.log.Fatalf("line %v, this is not a list element: %v", i+1, line)
+			doc.fatalf(i, "list-element", "this is not a list element: %v", line)
 		}
 
 		// Write the first line of the list item
@@ -857,6 +1651,7 @@ func (doc *Document) ProcessList(startLineNum int) int {
 		i = doc.skipBlankLines(i + 1)
 		if doc.AtEOF(i) {
 			doc.log.Infof("EOF reached at line %v\n", i+1)
+			doc.sb.WriteString(fmt.Sprintf("%v</%v>\n", strings.Repeat(" ", itemIndentation), tagName))
 			break
 		}
 
@@ -895,14 +1690,27 @@ func (doc *Document) startsWithList(lineNum int) bool {
 
 func (doc *Document) processVerbatim(startLineNum int) int {
 	// This is a verbatim section, so we write it without processing
-	tagName, htmlTag, restLine := doc.processTagSpec(startLineNum)
+	tagFields := doc.preprocessTagSpec(startLineNum)
+	numbered := doc.preprocessLineNumbers(tagFields)
+	highlighted := doc.preprocessHighlightLines(startLineNum, tagFields)
+	isDiff := contains(strings.Fields(tagFields["class"]), "diff")
+	isDiagram := contains(strings.Fields(tagFields["class"]), "mermaid")
+	tagName, htmlTag, restLine := doc.buildTagPresentation(startLineNum, tagFields)
 
 	thisIndentation := doc.Indentation(startLineNum)
 	indentStr := strings.Repeat(" ", doc.Indentation(startLineNum))
 
-	startOfNextBlock := 0
+	startOfNextBlock := len(doc.lines)
 	lastNonEmptyLineNum := 0
-	minimumIndentation := doc.indentations[startLineNum+1]
+
+	// The tag can be the last line of the document, like a '<pre @file>' including an empty file, and then the block is empty
+	minimumIndentation := 0
+	if startLineNum+1 < len(doc.lines) {
+		minimumIndentation = doc.indentations[startLineNum+1]
+	}
+
+	// The source of a diagram can be written after it too
+	source := []string{}
 
 	for i := startLineNum + 1; !doc.AtEOF(i); i++ {
 
@@ -933,6 +1741,15 @@ func (doc *Document) processVerbatim(startLineNum int) int {
 
 	}
 
+	// A block without content lines is written with the rest of the line of the tag only
+	if lastNonEmptyLineNum <= startLineNum {
+		endTag := fmt.Sprintf("</%v>", tagName)
+		if strings.HasPrefix(restLine, "<code") {
+			endTag = "</code>" + endTag
+		}
+		doc.sb.WriteString(fmt.Sprintf("\n%v%v%v%v\n\n", indentStr, htmlTag, restLine, endTag))
+	}
+
 	for i := startLineNum + 1; i <= lastNonEmptyLineNum; i++ {
 
 		thisIndentationStr := ""
@@ -941,26 +1758,46 @@ func (doc *Document) processVerbatim(startLineNum int) int {
 		}
 
 		if i == startLineNum+1 {
-			// Write the first line
-			doc.sb.WriteString(fmt.Sprintf("\n%v%v%v%v\n", indentStr, htmlTag, restLine, doc.lines[i]))
+			// Write the start tag with the first line, and the numbers and highlighting of the lines if requested
+			if numbered {
+				htmlTag = htmlTag + lineNumbers(lastNonEmptyLineNum-startLineNum)
+			}
+			if highlighted != nil {
+				htmlTag = htmlTag + highlightedLines(lastNonEmptyLineNum-startLineNum, highlighted)
+			}
+			doc.sb.WriteString(fmt.Sprintf("\n%v%v%v", indentStr, htmlTag, restLine))
+		}
 
-		} else if i == lastNonEmptyLineNum {
+		// The lines of a diff are marked as added or removed
+		line := thisIndentationStr + doc.lines[i]
+		if isDiagram {
+			source = append(source, line)
+		}
+		if isDiff {
+			line = diffLine(line)
+		}
+
+		if i == lastNonEmptyLineNum {
 			// Write the end tag
 			// As a very common special case, if there was a <code> in the same line as <pre>, write the end tag too
 			if strings.HasPrefix(restLine, "<code") {
-				doc.sb.WriteString(fmt.Sprintf("%v%v</code></%v>\n\n", thisIndentationStr, doc.lines[i], tagName))
+				doc.sb.WriteString(fmt.Sprintf("%v</code></%v>\n\n", line, tagName))
 			} else {
-				doc.sb.WriteString(fmt.Sprintf("%v%v</%v>\n\n", thisIndentationStr, doc.lines[i], tagName))
+				doc.sb.WriteString(fmt.Sprintf("%v</%v>\n\n", line, tagName))
 			}
 
 		} else {
 			// Write the verbatim line
-			doc.sb.WriteString(fmt.Sprintf("%v%v\n", thisIndentationStr, doc.lines[i]))
+			doc.sb.WriteString(fmt.Sprintf("%v\n", line))
 
 		}
 
 	}
 
+	if isDiagram {
+		doc.sb.WriteString(doc.diagramSource(indentStr, source))
+	}
+
 	return startOfNextBlock
 
 }
@@ -984,19 +1821,17 @@ func (doc *Document) ProcessSectionTag(startLineNum int) int {
 
 	// Skip all the blank lines
 	nextLineNum := doc.skipBlankLines(startLineNum + 1)
+	hasBlock := false
 	if doc.AtEOF(nextLineNum) {
 		doc.log.Debugf("EOF reached at line %v", startLineNum+1)
-		return nextLineNum
-	}
-
-	// Start and process an indented block if the next line is more indented
-	nextIndentation := doc.Indentation(nextLineNum)
-	if nextIndentation > thisIndentation {
+	} else if doc.Indentation(nextLineNum) > thisIndentation {
+		// Start and process an indented block if the next line is more indented
 		nextLineNum = doc.ProcessBlock(nextLineNum)
+		hasBlock = true
 	}
 
-	// Write the end tag for the section
-	if isVoidElement(tagName) {
+	// Write the end tag for the section, unless the element is closed in its line and written as it is
+	if isVoidElement(tagName) || (!hasBlock && closedInLine(tagName, htmlTag+restLine)) {
 		// HTML spec says no end tag should be used
 		doc.sb.WriteString(fmt.Sprintln())
 	} else {
@@ -1057,12 +1892,48 @@ func (doc *Document) ProcessBlock(startLineNum int) int {
 			continue
 		}
 
+		// An example, which is a verbatim section with a caption
+		if doc.examples[currentLineNum] != nil {
+			currentLineNum = doc.processExample(currentLineNum)
+			continue
+		}
+
 		// A verbatim section that is not processed
 		if doc.startsWithVerbatim(currentLineNum) {
 			currentLineNum = doc.processVerbatim(currentLineNum)
 			continue
 		}
 
+		// A block of math, which is not processed either
+		if doc.startsWithMath(currentLineNum) {
+			currentLineNum = doc.processMath(currentLineNum)
+			continue
+		}
+
+		// The place where the glossary is written
+		if doc.startsWithGlossary(currentLineNum) {
+			currentLineNum = doc.processGlossary(currentLineNum)
+			continue
+		}
+
+		// The place where the bibliography is written
+		if doc.startsWithBibliography(currentLineNum) {
+			currentLineNum = doc.processBibliography(currentLineNum)
+			continue
+		}
+
+		// The place where the list of open issues is written
+		if doc.startsWithIssues(currentLineNum) {
+			currentLineNum = doc.processIssues(currentLineNum)
+			continue
+		}
+
+		// The place where the list of abbreviations is written
+		if doc.startsWithAbbreviations(currentLineNum) {
+			currentLineNum = doc.processAbbreviations(currentLineNum)
+			continue
+		}
+
 		// Headers have some special processing
 		if doc.startsWithHeaderTag(currentLineNum) {
 			currentLineNum = doc.processHeaderParagraph(currentLineNum)
@@ -1105,13 +1976,34 @@ func processWatch(inputFileName string, outputFileName string, sugar *zap.Sugare
 
 		if old_timestamp.Before(info.ModTime()) {
 			old_timestamp = current_timestamp
-			fmt.Println("************Processing*************")
-			b := NewDocumentFromFile(inputFileName, sugar)
-			html := b.ToHTML()
+			sugar.Infof("processing %v after a change", inputFileName)
+			var b *Document
+			var html string
+			if aborted := catchFatal(func() {
+				b = NewDocumentFromFile(inputFileName, sugar)
+				html = b.ToHTML()
+			}); aborted != nil {
+				b = aborted
+			}
+
+			// Keep watching when there are errors, so the user can fix them
+			b.ReportDiagnostics()
+			if len(b.Errors()) > 0 {
+				continue
+			}
+
 			err = os.WriteFile(outputFileName, []byte(html), 0664)
 			if err != nil {
 				return err
 			}
+			err = b.ExportDefinitions(outputFileName)
+			if err != nil {
+				return err
+			}
+			err = b.CopyAssets(outputFileName)
+			if err != nil {
+				return err
+			}
 		}
 
 		time.Sleep(1 * time.Second)
@@ -1131,21 +2023,65 @@ func process(c *cli.Context) error {
 	dryrun := c.Bool("dryrun")
 
 	debug = c.Bool("debug")
+	copyAssets = c.Bool("copyassets")
+	downloadImages = c.Bool("download-images")
+	fingerprintAssets = c.Bool("fingerprint-assets")
+	optimizeImages = c.Bool("optimize-images")
+	minifyHTML = c.Bool("minify")
+	prettyHTML = c.Bool("pretty")
+	validateHTML = c.Bool("validate")
+	checkAccessibility = c.Bool("a11y")
+	if minifyHTML && prettyHTML {
+		return fmt.Errorf("--minify and --pretty can not be used together")
+	}
+	strict = c.Bool("strict")
+	quiet = c.Bool("quiet")
+	sourceLines = c.Bool("sourcelines")
+	noNetwork = c.Bool("no-network")
+	httpTimeout = c.Duration("http-timeout")
+	httpRetries = c.Int("http-retries")
+	if err := setupTLS(c.String("ca-cert"), c.Bool("insecure")); err != nil {
+		return fmt.Errorf("invalid --ca-cert: %w", err)
+	}
+	profiles = c.StringSlice("profile")
 
-	var z *zap.Logger
-	var err error
+	diagFormat = c.String("diag-format")
+	if diagFormat != "text" && diagFormat != "json" {
+		return fmt.Errorf("invalid diagnostics format '%v', must be 'text' or 'json'", diagFormat)
+	}
 
-	// Setup the logging system
-	if debug {
-		z, err = zap.NewDevelopment()
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		z, err = zap.NewProduction()
-		if err != nil {
-			panic(err)
-		}
+	// The other formats of the output are converted from the HTML, which is the only one for the watch mode and directories
+	format := c.String("format")
+	outputExt, found := outputFormats[format]
+	if !found {
+		return fmt.Errorf("invalid output format '%v', must be 'html', 'pandoc', 'text' or 'xml2rfc'", format)
+	}
+	if format != "html" && c.Bool("watch") {
+		return fmt.Errorf("watch mode only supports the html format")
+	}
+
+	// Setup the logging system, with the level of detail requested by the user.
+	// By default only warnings and errors are logged.
+	level := zapcore.WarnLevel
+	switch {
+	case quiet:
+		level = zapcore.ErrorLevel
+	case debug || verbosity >= 2:
+		level = zapcore.DebugLevel
+	case verbosity == 1:
+		level = zapcore.InfoLevel
+	}
+
+	config := zap.NewDevelopmentConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
+	if !debug {
+		config.DisableCaller = true
+		config.DisableStacktrace = true
+	}
+
+	z, err := config.Build()
+	if err != nil {
+		return err
 	}
 
 	sugar := z.Sugar()
@@ -1155,53 +2091,109 @@ func process(c *cli.Context) error {
 	if c.Args().Present() {
 		inputFileName = c.Args().First()
 	} else {
-		fmt.Printf("no input file provided, using \"%v\"\n", inputFileName)
+		sugar.Infof("no input file provided, using \"%v\"", inputFileName)
+	}
+
+	// Process all the documents if the input is a directory
+	if info, err := os.Stat(inputFileName); err == nil && info.IsDir() {
+		if c.Bool("watch") {
+			return fmt.Errorf("watch mode is not supported when processing a directory")
+		}
+		if format != "html" {
+			return fmt.Errorf("only the html format is supported when processing a directory")
+		}
+		return processDirectory(inputFileName, c.String("baseurl"), c.String("site-author"), dryrun, sugar)
 	}
 
 	// Generate the output file name
 	if len(outputFileName) == 0 {
-		ext := path.Ext(inputFileName)
-		if len(ext) == 0 {
-			outputFileName = inputFileName + ".html"
-		} else {
-			outputFileName = strings.Replace(inputFileName, ext, ".html", 1)
-		}
+		outputFileName = defaultOutputName(inputFileName, outputExt)
 	}
 
 	// Print a message
 	if !dryrun {
-		fmt.Printf("processing %v and generating %v\n", inputFileName, outputFileName)
+		sugar.Infof("processing %v and generating %v", inputFileName, outputFileName)
 	} else {
-		fmt.Printf("dry run: processing %v without writing output\n", inputFileName)
+		sugar.Infof("dry run: processing %v without writing output", inputFileName)
 	}
 
 	if c.Bool("watch") {
-		processWatch(inputFileName, outputFileName, sugar)
-		return nil
+		return processWatch(inputFileName, outputFileName, sugar)
 	}
 
-	b := NewDocumentFromFile(inputFileName, sugar)
+	// The unrecoverable syntax errors are reported like the other errors of the document
+	var b *Document
+	var html string
+	if aborted := catchFatal(func() {
+		b = NewDocumentFromFile(inputFileName, sugar)
+		b.logPreprocessStats()
+		html = b.ToHTML()
+	}); aborted != nil {
+		b = aborted
+	}
 
-	if debug {
-		b.printPreprocessStats()
+	// Do not write the output if there are errors in the document
+	b.ReportDiagnostics()
+	if len(b.Errors()) > 0 {
+		return fmt.Errorf("errors processing %v", inputFileName)
 	}
 
-	html := b.ToHTML()
+	// Mark the changes from the previous version, for the review of the document
+	if diffBase := c.String("diff-base"); len(diffBase) > 0 {
+		html, err = redlineFile(diffBase, html)
+		if err != nil {
+			return err
+		}
+	}
 
 	if dryrun {
 		return nil
 	}
 
+	// The other formats are converted from the generated HTML
+	switch format {
+	case "pandoc":
+		content, err := b.ToPandoc(html)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(outputFileName, content, 0664)
+	case "text":
+		return os.WriteFile(outputFileName, []byte(b.ToText(html)), 0664)
+	case "xml2rfc":
+		return os.WriteFile(outputFileName, []byte(b.ToRFCXML(html)), 0664)
+	}
+
 	err = os.WriteFile(outputFileName, []byte(html), 0664)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = b.ExportDefinitions(outputFileName)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAssets(outputFileName)
+}
+
+// defaultOutputName returns the name of the output file for the input file, with the extension of the format
+func defaultOutputName(inputFileName string, outputExt string) string {
+	ext := path.Ext(inputFileName)
+	if len(ext) == 0 {
+		return inputFileName + outputExt
+	}
+	return strings.Replace(inputFileName, ext, outputExt, 1)
 }
 
 func main() {
 
+	// The version flag does not have an alias, so -v can be used for verbosity
+	cli.VersionFlag = &cli.BoolFlag{
+		Name:  "version",
+		Usage: "print the version",
+	}
+
 	app := &cli.App{
 		Name:     "rite",
 		Version:  "v1.01",
@@ -1212,15 +2204,24 @@ func main() {
 				Email: "hesus.ruiz@gmail.com",
 			},
 		},
-		Usage:     "process a rite document and produce HTML",
-		UsageText: "rite [options] [INPUT_FILE] (default input file is index.txt)",
+		Usage: "process a rite document and produce HTML",
+		Description: fmt.Sprintf("The exit status is 0 if the document was processed successfully, or %v if there were errors.\n"+
+			"All the errors found in the document are printed, and no output is written.", exitStatusError),
+		UsageText: "rite [options] [INPUT_FILE | DIRECTORY] (default input file is index.txt)",
 		Action:    process,
-		ArgsUsage: "perico perez",
+		// Allow combining short flags, like -vv
+		UseShortOptionHandling: true,
+		ArgsUsage:              "perico perez",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
-				Usage:   "write html to `FILE` (default is input file name with extension .html)",
+				Usage:   "write html to `FILE` (default is input file name with extension .html, ignored for directories)",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "html",
+				Usage: "write the output in `FORMAT`: 'html', 'pandoc' for the JSON of Pandoc, which can convert it to other formats, 'text' for wrapped plain text, or 'xml2rfc' for the RFC XML of the Internet-Drafts",
 			},
 			&cli.BoolFlag{
 				Name:    "dryrun",
@@ -1232,16 +2233,142 @@ func main() {
 				Aliases: []string{"d"},
 				Usage:   "run in debug mode",
 			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Aliases: []string{"v"},
+				Usage:   "log what is being processed (-v), or also debug information (-vv)",
+				Count:   &verbosity,
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "log only errors, without warnings",
+			},
 			&cli.BoolFlag{
 				Name:    "watch",
 				Aliases: []string{"w"},
 				Usage:   "watch the file for changes",
 			},
+			&cli.StringFlag{
+				Name:  "diag-format",
+				Value: "text",
+				Usage: "report errors and warnings as `FORMAT`: 'text' to stderr or 'json' to stdout, one per line",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "treat warnings as errors, so no output is generated if there is any problem in the document",
+			},
+			&cli.BoolFlag{
+				Name:  "sourcelines",
+				Usage: "add to the block elements a 'data-rite-line' attribute with their line number in the source",
+			},
+			&cli.BoolFlag{
+				Name:    "no-network",
+				Aliases: []string{"offline"},
+				Usage:   "do not use the network to download included files, references, definitions or issues, using only the ones in the cache, for reproducible builds",
+			},
+			&cli.DurationFlag{
+				Name:  "http-timeout",
+				Value: httpTimeout,
+				Usage: "maximum `TIME` to download a file from the network",
+			},
+			&cli.IntFlag{
+				Name:  "http-retries",
+				Value: httpRetries,
+				Usage: "number of `TIMES` a download from the network is retried after a temporary failure",
+			},
+			&cli.StringFlag{
+				Name:  "ca-cert",
+				Usage: "trust also the certificate authorities in `FILE` (PEM) for the downloads, like the one of a corporate proxy",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "do not verify the certificates of the servers in the downloads",
+			},
+			&cli.StringSliceFlag{
+				Name:  "profile",
+				Usage: "include the blocks for `PROFILE`, marked with the 'if' attribute (can be repeated or comma separated)",
+			},
+			&cli.BoolFlag{
+				Name:  "copyassets",
+				Usage: "copy the local images and files referenced by the document to '" + builtAssetsDir + "' next to the output file",
+			},
+			&cli.BoolFlag{
+				Name:  "download-images",
+				Usage: "download the remote images of the figures to '" + builtAssetsDir + "/remote' next to the output file",
+			},
+			&cli.BoolFlag{
+				Name:  "fingerprint-assets",
+				Usage: "add a hash of their content to the names of the files copied to '" + builtAssetsDir + "', for sites which cache them for a long time",
+			},
+			&cli.BoolFlag{
+				Name:  "optimize-images",
+				Usage: "compress again the PNG and JPEG images copied to '" + builtAssetsDir + "', keeping the smaller files",
+			},
+			&cli.BoolFlag{
+				Name:  "minify",
+				Usage: "remove the comments and collapse the spaces of the generated HTML, except in <pre> blocks",
+			},
+			&cli.BoolFlag{
+				Name:  "pretty",
+				Usage: "write the generated HTML with one block element per line, indented, for stable and reviewable diffs",
+			},
+			&cli.BoolFlag{
+				Name:  "validate",
+				Usage: "check the structure of the generated HTML, like elements not closed or ids used twice (use with --sourcelines to know the lines)",
+			},
+			&cli.BoolFlag{
+				Name:  "a11y",
+				Usage: "check the accessibility of the generated HTML, like images without alternative text or links without a descriptive text",
+			},
+			&cli.StringFlag{
+				Name:  "diff-base",
+				Usage: "mark the changes from the previous version of the output in `FILE` with <ins> and <del> (ignored for directories)",
+			},
+			&cli.StringFlag{
+				Name:  "baseurl",
+				Usage: "generate sitemap.xml, robots.txt and feed.xml for the site published at `URL` (only for directories)",
+			},
+			&cli.StringFlag{
+				Name:  "site-author",
+				Usage: "the `NAME` of the author of the site in feed.xml, instead of the editors of the documents (only for directories)",
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:   "lsp",
+				Usage:  "run a Language Server Protocol server on stdin and stdout, for editor integration",
+				Action: processLSP,
+			},
+			{
+				Name:      "clean",
+				Usage:     "remove the files in '" + builtAssetsDir + "' which the documents, or the documents in the directories, do not use any more",
+				ArgsUsage: "[INPUT_FILE_OR_DIRECTORY...]",
+				Action:    processClean,
+			},
+			{
+				Name:      "checklinks",
+				Usage:     "check the links to other sites in a document, including the bibliography, and report the broken ones",
+				ArgsUsage: "[INPUT_FILE]",
+				Action:    processCheckLinks,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "allow",
+						Usage: "do not check the links starting with `PREFIX` (can be repeated)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 8,
+						Usage: "check up to `N` links at the same time",
+					},
+				},
+			},
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitStatusError)
 	}
 
 }
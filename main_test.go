@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// newTestDocument returns the document with the source, preprocessed and without logging
+func newTestDocument(src string) *Document {
+	return NewDocument(bufio.NewScanner(strings.NewReader(src)), nil)
+}
+
+// hasDiagnostic returns true if the document reported a diagnostic with the code and severity
+func hasDiagnostic(doc *Document, code string, severity string) bool {
+	for _, d := range doc.diagnostics {
+		if d.Code == code && d.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// assertNoErrors fails the test if the document reported errors
+func assertNoErrors(t *testing.T, doc *Document) {
+	t.Helper()
+	for _, d := range doc.Errors() {
+		t.Errorf("unexpected error in line %v: %v (%v)", d.Line, d.Msg, d.Code)
+	}
+}
+
+// recordingLogger keeps the messages logged, for the tests of the logging
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(template string, args ...any) {
+	l.messages = append(l.messages, template)
+}
+func (l *recordingLogger) Debugw(msg string, keysAndValues ...any) {
+	l.messages = append(l.messages, msg)
+}
+func (l *recordingLogger) Infof(template string, args ...any) {
+	l.messages = append(l.messages, template)
+}
+func (l *recordingLogger) Warnw(msg string, keysAndValues ...any) {
+	l.messages = append(l.messages, msg)
+}
+
+func TestInjectedLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	doc := NewDocument(bufio.NewScanner(strings.NewReader("# Title\n\nSome text.\n")), logger)
+	doc.ToHTML()
+	assertNoErrors(t, doc)
+
+	if !contains(logger.messages, "ProcessBlock") {
+		t.Errorf("messages logged %q, want the processing of the blocks", logger.messages)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// isMarkdown returns true if the file is written in Markdown instead of rite, like 'chapter.md'
+func isMarkdown(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// The block markup of Markdown which is different in rite
+var (
+	reMarkdownFence    = regexp.MustCompile("^(```+|~~~+)\\s*([^`\\s]*)")
+	reMarkdownItem     = regexp.MustCompile(`^([-*+]|[0-9]+[.)])\s+(.*)$`)
+	reMarkdownRule     = regexp.MustCompile(`^([-*_])(\s*([-*_]))*\s*$`)
+	reMarkdownSetext   = regexp.MustCompile(`^(=+|-+)\s*$`)
+	reMarkdownATXClose = regexp.MustCompile(`\s+#+\s*$`)
+)
+
+// The inline markup of Markdown which is different in rite
+var (
+	reMarkdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	reMarkdownStarEm   = regexp.MustCompile(`(^|[^*\w])\*([^*\s]([^*]*[^*\s])?)\*($|[^*\w])`)
+	reMarkdownUnderEm  = regexp.MustCompile(`(^|[^_\w])_([^_\s]([^_]*[^_\s])?)_($|[^_\w])`)
+	reMarkdownStrongU  = regexp.MustCompile(`(^|[^_\w])__([^_\s]([^_]*[^_\s])?)__($|[^_\w])`)
+	reMarkdownStrongUx = regexp.MustCompile(`\x00([^\x00]*)\x00`)
+)
+
+// markdownList is a list being converted, with the indentation of its items in the Markdown file
+type markdownList struct {
+	indentation int
+	tag         string
+}
+
+// markdownToRite converts a Markdown file to rite, so it can be included in a document or processed like a rite
+// file, like in '<x-include @chapter.md>'. The markup which is the same in both, like the headings with '#',
+// **bold**, `code` or [links](url), is kept, and the rest is converted: fenced and indented code blocks, lists
+// with '*', '+' and numbers, block quotes, setext headings, rules, *emphasis*, _emphasis_ and ![images](src).
+// The lists, blocks of code and quotes need a line with their tag, so the lines after them are reported in the
+// diagnostics some lines later than in the Markdown file.
+func markdownToRite(content []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	out := []string{}
+
+	lists := []markdownList{}
+	fence, fenceIndentation := "", 0
+	insideQuote, insideIndentedCode, insideYAML := false, false, false
+
+	// emit writes a line with the indentation, which is the one of the lists where the line is
+	emit := func(indentation int, text string) {
+		out = append(out, strings.Repeat(" ", indentation)+text)
+	}
+
+	// startBlock writes the tag of a block, after a blank line so it is not part of the previous paragraph
+	startBlock := func(indentation int, tag string) {
+		if len(out) > 0 && len(strings.TrimSpace(out[len(out)-1])) > 0 {
+			out = append(out, "")
+		}
+		emit(indentation, tag)
+	}
+
+	// contentIndentation returns the indentation of the content of the innermost list item. The tag of each
+	// list is indented under the item of its parent list, and its items are indented under the tag.
+	contentIndentation := func() int {
+		return 8 * len(lists)
+	}
+
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		trimmed := strings.TrimLeft(line, " ")
+		indentation := len(line) - len(trimmed)
+
+		// The YAML header is the same in rite
+		if i == 0 && strings.HasPrefix(line, "---") {
+			insideYAML = true
+			out = append(out, line)
+			continue
+		}
+		if insideYAML {
+			insideYAML = !strings.HasPrefix(line, "---")
+			out = append(out, line)
+			continue
+		}
+
+		// The content of a fenced code block is written literally, indented under the <pre> tag
+		if len(fence) > 0 {
+			if strings.HasPrefix(trimmed, fence) && len(strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))) == 0 {
+				fence = ""
+				out = append(out, "")
+				continue
+			}
+			if indentation >= fenceIndentation {
+				line = line[fenceIndentation:]
+			} else {
+				line = trimmed
+			}
+			emit(contentIndentation()+4, html.EscapeString(line))
+			continue
+		}
+		if m := reMarkdownFence.FindStringSubmatch(trimmed); m != nil {
+			fence, fenceIndentation = m[1], indentation
+			if len(lists) > 0 && indentation <= lists[len(lists)-1].indentation {
+				lists = nil
+			}
+			tag := "<pre>"
+			if len(m[2]) > 0 {
+				tag = fmt.Sprintf("<pre><code class=\"language-%v\">", m[2])
+			}
+			startBlock(contentIndentation(), tag)
+			continue
+		}
+
+		if len(trimmed) == 0 {
+			out = append(out, "")
+			continue
+		}
+
+		// The lines indented four spaces after a blank line are a block of code, except inside lists
+		previousBlank := len(out) == 0 || len(strings.TrimSpace(out[len(out)-1])) == 0
+		if insideQuote && previousBlank && !strings.HasPrefix(trimmed, ">") {
+			insideQuote = false
+		}
+		if insideIndentedCode && indentation < 4 {
+			insideIndentedCode = false
+		}
+		if insideIndentedCode || (len(lists) == 0 && !insideQuote && indentation >= 4 && previousBlank) {
+			if !insideIndentedCode {
+				startBlock(0, "<pre>")
+				insideIndentedCode = true
+			}
+			emit(4, html.EscapeString(line[4:]))
+			continue
+		}
+
+		// The lines of a block quote are indented under the <blockquote> tag
+		if strings.HasPrefix(trimmed, ">") {
+			if !insideQuote {
+				lists = nil
+				startBlock(0, "<blockquote>")
+				insideQuote = true
+			}
+			text := strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " ")
+			if len(text) == 0 {
+				out = append(out, "")
+			} else {
+				emit(4, markdownInline(text))
+			}
+			continue
+		}
+		if insideQuote {
+			// A lazy continuation of the quote
+			emit(4, markdownInline(trimmed))
+			continue
+		}
+
+		// A line of dashes under a paragraph makes it a heading, and otherwise it is a rule
+		if m := reMarkdownSetext.FindStringSubmatch(trimmed); m != nil && len(lists) == 0 && !previousBlank {
+			previous := strings.TrimSpace(out[len(out)-1])
+			if !strings.HasPrefix(previous, "<") && !strings.HasPrefix(previous, "#") {
+				level := "#"
+				if m[1][0] == '-' {
+					level = "##"
+				}
+				out[len(out)-1] = level + " " + previous
+				out = append(out, "")
+				continue
+			}
+		}
+		if reMarkdownRule.MatchString(trimmed) && len(strings.ReplaceAll(trimmed, " ", "")) >= 3 {
+			lists = nil
+			startBlock(0, "<hr>")
+			continue
+		}
+
+		// The items of the lists are written in a <ul> or <ol> block, nested by their indentation
+		if m := reMarkdownItem.FindStringSubmatch(trimmed); m != nil {
+			tag := "<ul>"
+			if m[1][0] >= '0' && m[1][0] <= '9' {
+				tag = "<ol>"
+			}
+			for len(lists) > 0 && lists[len(lists)-1].indentation > indentation {
+				lists = lists[:len(lists)-1]
+			}
+			if len(lists) > 0 && lists[len(lists)-1].indentation == indentation && lists[len(lists)-1].tag != tag {
+				lists = lists[:len(lists)-1]
+			}
+			if len(lists) == 0 || lists[len(lists)-1].indentation < indentation {
+				if len(lists) == 0 {
+					startBlock(0, tag)
+				} else {
+					emit(contentIndentation(), tag)
+				}
+				lists = append(lists, markdownList{indentation: indentation, tag: tag})
+			}
+			// The content of the previous item ends with a blank line
+			if last := out[len(out)-1]; len(strings.TrimSpace(last)) > 0 && len(last)-len(strings.TrimLeft(last, " ")) > contentIndentation()-4 {
+				out = append(out, "")
+			}
+			emit(contentIndentation()-4, "<li>"+markdownInline(m[2]))
+			continue
+		}
+
+		// The text after a list is part of the last item if it is indented or continues its paragraph.
+		// The lines which continue a paragraph are joined to it, and a blank line keeps the count of lines.
+		if len(lists) > 0 {
+			if !previousBlank {
+				last := len(out) - 1
+				for last > 0 && len(out[last]) == 0 {
+					last--
+				}
+				out[last] = out[last] + " " + markdownInline(trimmed)
+				out = append(out, "")
+				continue
+			}
+			if indentation > lists[len(lists)-1].indentation {
+				emit(contentIndentation(), markdownInline(trimmed))
+				continue
+			}
+			lists = nil
+		}
+
+		// The headings are the same, but the closing sequence of '#' is optional in Markdown
+		if strings.HasPrefix(trimmed, "#") {
+			trimmed = reMarkdownATXClose.ReplaceAllString(trimmed, "")
+		}
+
+		// The HTML is written as it is, keeping its indentation
+		if strings.HasPrefix(trimmed, "<") {
+			out = append(out, line)
+			continue
+		}
+
+		out = append(out, markdownInline(trimmed))
+	}
+
+	return []byte(strings.Join(out, "\n"))
+}
+
+// markdownInline converts the inline markup of Markdown which is different in rite: the images, and the emphasis
+// with '*' or '_', which is '__' in rite. The strong emphasis with '__' is '**' in rite.
+func markdownInline(text string) string {
+	return mapOutsideCode(text, func(s string) string {
+		s = reMarkdownImage.ReplaceAllString(s, `<img src="$2" alt="$1">`)
+		// The expressions are applied twice, because the character between two emphasized words is used by the first one
+		for i := 0; i < 2; i++ {
+			s = reMarkdownStrongU.ReplaceAllString(s, "$1\x00$2\x00$4")
+		}
+		for i := 0; i < 2; i++ {
+			s = reMarkdownUnderEm.ReplaceAllString(s, "${1}__${2}__$4")
+			s = reMarkdownStarEm.ReplaceAllString(s, "${1}__${2}__$4")
+		}
+		return reMarkdownStrongUx.ReplaceAllString(s, "**$1**")
+	})
+}
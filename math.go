@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The math is written in TeX and rendered in the browser by KaTeX, which is included in the document
+// (replacing the '{#math}' placeholder in the template) only if the document has math.
+const katexIncludes = `<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.css">
+<script src="https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.js"></script>
+<script>
+document.querySelectorAll(".math").forEach(function (el) {
+  katex.render(el.textContent, el, {displayMode: el.classList.contains("display"), throwOnError: false});
+});
+</script>
+`
+
+// closingDollar returns the position of the '$' closing the inline math which starts in the given position,
+// or -1 if there is no inline math there
+func closingDollar(line string, start int) int {
+	if start >= len(line) || line[start] == ' ' || line[start] == '$' {
+		return -1
+	}
+
+	for j := start; j < len(line); j++ {
+		switch line[j] {
+		case '\\':
+			// Skip the escaped character
+			j++
+		case '$':
+			if line[j-1] == ' ' || (j+1 < len(line) && line[j+1] >= '0' && line[j+1] <= '9') {
+				return -1
+			}
+			return j
+		}
+	}
+
+	return -1
+}
+
+// The word used in the references to the equations
+const equationLabel = "Equation"
+
+// startsWithMath returns true if the line starts a block of math, which may be a numbered equation
+func (doc *Document) startsWithMath(lineNum int) bool {
+	return strings.HasPrefix(doc.lines[lineNum], "<x-math") || strings.HasPrefix(doc.lines[lineNum], "<x-eq")
+}
+
+// preprocessEquation numbers the equation started by an <x-eq> tag, like '<x-eq #energy>E = mc^2'.
+// The equations are numbered in sequence in the document, or in each top level section if the YAML header
+// has 'equationNumbering: section', and the number is added to the tag as the special attribute "number".
+func (doc *Document) preprocessEquation(lineNum int, tagFields map[string]string) {
+	line := doc.lines[lineNum]
+
+	id := tagFields["id"]
+	number := doc.elementNumber(lineNum, tagFields)
+
+	if doc.config.String("equationNumbering", "document") == "section" {
+		section := "0"
+		for i := len(doc.headings) - 1; i >= 0; i-- {
+			if h := doc.headings[i]; h.level == 1 && len(h.number) > 0 {
+				section = h.number
+				break
+			}
+		}
+		key := tagBucket(tagFields) + " " + section
+		doc.figs[key] = doc.figs[key] + 1
+		number = fmt.Sprintf("%v.%v", section, doc.figs[key])
+	}
+
+	if len(id) > 0 && doc.idLines[id] == lineNum {
+		doc.idNumbers[id] = number
+		doc.refLabels[id] = fmt.Sprintf("%v (%v)", doc.localize(equationLabel), number)
+	}
+
+	doc.lines[lineNum] = line[:len("<x-eq")] + " =" + number + line[len("<x-eq"):]
+}
+
+// processMath writes a block of math, which is the text after the <x-math> tag and the indented lines after it.
+// The lines are not processed, so they can use any TeX syntax.
+func (doc *Document) processMath(startLineNum int) int {
+
+	tagFields := doc.preprocessTagSpec(startLineNum)
+
+	// Equations are written with their number after the math
+	equation := tagFields["tag"] == "x-eq"
+	number := tagFields["number"]
+	delete(tagFields, "number")
+
+	tagFields["tag"] = "div"
+	tagFields["class"] = strings.TrimSpace("math display " + tagFields["class"])
+	_, htmlTag, restLine := doc.buildTagPresentation(startLineNum, tagFields)
+
+	tex := []string{}
+	if len(strings.TrimSpace(restLine)) > 0 {
+		tex = append(tex, strings.TrimSpace(restLine))
+	}
+
+	thisIndentation := doc.Indentation(startLineNum)
+	i := startLineNum + 1
+	for ; !doc.AtEOF(i); i++ {
+		if len(doc.lines[i]) > 0 && doc.Indentation(i) <= thisIndentation {
+			break
+		}
+		tex = append(tex, doc.lines[i])
+	}
+
+	doc.hasMath = true
+	math := fmt.Sprintf("%v%v</div>", htmlTag, html.EscapeString(strings.TrimSpace(strings.Join(tex, "\n"))))
+	if equation {
+		math = fmt.Sprintf("<div class=\"equation\">%v<span class=\"eqno\">(%v)</span></div>", math, number)
+	}
+	doc.sb.WriteString(fmt.Sprintf("\n%v%v\n\n", doc.indentStr(startLineNum), math))
+
+	return i
+}
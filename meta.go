@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Description returns the description of the document in the YAML header, escaped to be used in the HTML
+func (doc *Document) Description() string {
+	return html.EscapeString(doc.config.String("description"))
+}
+
+// authors returns the authors of the document in the YAML header, which can be a list or a single name
+func (doc *Document) authors() []string {
+	if names := doc.config.ListString("authors"); len(names) > 0 {
+		return names
+	}
+	if name := doc.config.String("authors"); len(name) > 0 {
+		return []string{name}
+	}
+	return nil
+}
+
+// editors returns the names of the editors of the document in the YAML header, which can be a list of names
+// or of maps with the name, like 'editors: [{name: Jane Doe, company: ACME}]'
+func (doc *Document) editors() []string {
+	names := []string{}
+	for _, editor := range doc.config.List("editors") {
+		switch e := editor.(type) {
+		case map[string]any:
+			if name, ok := e["name"]; ok && len(fmt.Sprint(name)) > 0 {
+				names = append(names, fmt.Sprint(name))
+			}
+		default:
+			if name := fmt.Sprint(e); len(name) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// metaTags returns the <meta> tags describing the document, written in the template where the '{#meta}'
+// placeholder is. Besides the description and authors, they include the Open Graph and Twitter card tags,
+// so the links to the published document show a preview in chats and social media. The values are
+// the 'title', 'description', 'authors', 'image' and 'url' in the YAML header.
+func (doc *Document) metaTags() string {
+	var sb strings.Builder
+
+	meta := func(attr string, name string, value string) {
+		if len(value) > 0 {
+			sb.WriteString(fmt.Sprintf("<meta %v=\"%v\" content=\"%v\">\n", attr, name, html.EscapeString(value)))
+		}
+	}
+
+	title := doc.Title()
+	description := doc.config.String("description")
+	image := doc.config.String("image")
+
+	meta("name", "description", description)
+	for _, author := range doc.authors() {
+		meta("name", "author", author)
+	}
+
+	meta("property", "og:type", "article")
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:image", image)
+	meta("property", "og:url", doc.config.String("url"))
+
+	// The large card is used only if there is an image to show
+	card := "summary"
+	if len(image) > 0 {
+		card = "summary_large_image"
+	}
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+
+	return sb.String()
+}
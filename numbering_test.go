@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNumberingPerBucket(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"figures, tables and examples are numbered separately",
+			"<x-img @a.png #first>First\n\n<x-table #data>Data\n    <tr><td>1</td></tr>\n\n<x-img @b.png>Second\n\n" +
+				"<x-example #login>Login\n    GET /login\n\n<x-table>More data\n    <tr><td>2</td></tr>\n",
+			[]string{"Figure 1", "Figure 2", "Table 1. Data", "Table 2. More data", "Example 1: Login"},
+		},
+		{
+			"elements in a bucket get a prefix",
+			"<x-img @a.png #first>First\n\n<x-img @b.png #arch :architecture>Architecture\n\n<x-img @c.png #third>Third\n\n" +
+				"<x-table #deploy :architecture>Deployment\n    <tr><td>1</td></tr>\n",
+			[]string{"Figure 1", "Figure A-1", "Figure 2", "Table A-2"},
+		},
+		{
+			"each bucket gets the next letter",
+			"<x-img @a.png :architecture>Architecture\n\n<x-img @b.png :screens>Screens\n\n<x-img @c.png :architecture>More\n",
+			[]string{"Figure A-1", "Figure B-1", "Figure A-2"},
+		},
+		{
+			"prefix in the YAML header",
+			"---\nnumberPrefixes:\n  architecture: Arch\n---\n\n<x-img @a.png #arch :architecture>Architecture\n",
+			[]string{"Figure Arch-1"},
+		},
+		{
+			"references show the label with the number",
+			"See <x-ref \"arch\">, <x-ref \"deploy\"> and <x-ref \"login\">.\n\n" +
+				"<x-img @a.png #first>First\n\n<x-img @b.png #arch :architecture>Architecture\n\n" +
+				"<x-table #deploy>Deployment\n    <tr><td>1</td></tr>\n\n<x-example #login>Login\n    GET /login\n",
+			[]string{
+				`<a href="#arch" class="xref">Figure A-1</a>`,
+				`<a href="#deploy" class="xref">Table 1</a>`,
+				`<a href="#login" class="xref">Example 1</a>`,
+			},
+		},
+		{
+			"references with the number only",
+			"See figure <x-ref \"arch\" num> and table <x-ref \"deploy\" num>.\n\n" +
+				"<x-img @b.png #arch :architecture>Architecture\n\n<x-table #deploy>Deployment\n    <tr><td>1</td></tr>\n",
+			[]string{
+				`<a href="#arch" class="xref">A-1</a>`,
+				`<a href="#deploy" class="xref">1</a>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument(tt.src)
+			html := doc.ToHTML()
+
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("%q not found in:\n%v", want, html)
+				}
+			}
+		})
+	}
+}
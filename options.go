@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The options of rite in the YAML header. Other keys are values defined by the user, which can be
+// referenced in the text, but the keys similar to an option are probably misspelled.
+var knownOptions = []string{
+	"title", "lang", labelsKey, "description", "authors", "image", "url", "template", "commentPrefix", "definitions", "definitionsInVerbatim", "linkify", "smartTypography",
+	"toc", "tocDepth", "tocPlacement", "tocTitle",
+	"listOfFigures", "listOfFiguresTitle", "listOfTables", "listOfTablesTitle", "listOfExamples", "listOfExamplesTitle",
+	"equationNumbering", numberPrefixesKey, abbreviationsKey, "checkUnusedIds",
+	bibliographyKey, "bibliographyAll", "bibliographyTemplate", "citationStyle", "specref",
+	"github", "fetchIssues", "importDefinitions", "rfc2119", admonitionsKey, "codeLineNumbers", "copyCode", "diagramSource", imageWidthsKey,
+	"date", "updated",
+}
+
+// The options which must be true or false
+var boolOptions = []string{
+	"definitionsInVerbatim", "linkify", "smartTypography", "toc", "listOfFigures", "listOfTables", "listOfExamples",
+	"checkUnusedIds", "bibliographyAll", "specref", "fetchIssues", "rfc2119", "codeLineNumbers", "copyCode",
+}
+
+// The options with a fixed set of values
+var enumOptions = map[string][]string{
+	"citationStyle":     {styleIEEE, styleAPA, styleChicago},
+	"equationNumbering": {"section"},
+	"diagramSource":     {"none", "comment", "details"},
+}
+
+// The options which must be dates, like '2024-05-31'
+var dateOptions = []string{"date", "updated"}
+
+// A key at the top level of the YAML header
+var reYAMLKey = regexp.MustCompile(`^([0-9a-zA-Z-_\.]+)\s*:`)
+
+// checkOptions warns about the keys of the YAML header which look like misspelled options,
+// and about the options with invalid values. The YAML header is in the lines before headerEnd.
+func (doc *Document) checkOptions(headerEnd int) {
+	keyLines := map[string]int{}
+	for i := 1; i < headerEnd && i < len(doc.lines); i++ {
+		if doc.indentations[i] > 0 {
+			continue
+		}
+		if m := reYAMLKey.FindStringSubmatch(doc.lines[i]); m != nil {
+			keyLines[m[1]] = i
+		}
+	}
+
+	keys := []string{}
+	for key := range doc.config.Map("") {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keyLines[keys[i]] < keyLines[keys[j]] })
+
+	for _, key := range keys {
+		lineNum := keyLines[key]
+
+		if !contains(knownOptions, key) {
+			if option := similarOption(key); len(option) > 0 {
+				doc.warnf(lineNum, "unknown-option", "'%v' is not an option, did you mean '%v'?", key, option)
+			}
+			continue
+		}
+
+		v, err := doc.config.Get(key)
+		if err != nil {
+			continue
+		}
+		value := fmt.Sprint(v.Data())
+		if contains(boolOptions, key) && value != "true" && value != "false" {
+			doc.warnf(lineNum, "invalid-option", "'%v' must be true or false, not '%v'", key, value)
+		}
+		if values, found := enumOptions[key]; found && !contains(values, strings.ToLower(value)) {
+			doc.warnf(lineNum, "invalid-option", "'%v' must be one of %v, not '%v'", key, strings.Join(values, ", "), value)
+		}
+		if _, err := parseDate(value); contains(dateOptions, key) && err != nil {
+			doc.warnf(lineNum, "invalid-option", "'%v' must be a date like 2024-05-31, not '%v'", key, value)
+		}
+	}
+}
+
+// similarOption returns the option which is most similar to the key, differing in case or in
+// a few characters, or the empty string if there is none
+func similarOption(key string) string {
+	best, bestDistance := "", 0
+	for _, option := range knownOptions {
+		if strings.EqualFold(key, option) {
+			return option
+		}
+
+		// Short keys must be more similar, or any short word would match
+		maxDistance := 2
+		if len(option) <= 5 {
+			maxDistance = 1
+		}
+
+		d := editDistance(strings.ToLower(key), strings.ToLower(option))
+		if d <= maxDistance && (len(best) == 0 || d < bestDistance) {
+			best, bestDistance = option, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of characters which must be inserted, removed or replaced in a string to get the other
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The formats of the output, with the extension of the output file by default
+var outputFormats = map[string]string{
+	"html":    ".html",
+	"pandoc":  ".json",
+	"text":    ".txt",
+	"xml2rfc": ".xml",
+}
+
+// The version of the Pandoc API of the JSON documents, which is the one of Pandoc 3
+var pandocAPIVersion = []int{1, 23, 1}
+
+// htmlNode is an element or a text of the generated HTML, which is converted to the nodes of Pandoc
+type htmlNode struct {
+	name     string // The name of the element, or the empty string for a text
+	attrs    map[string]string
+	text     string // The text, or the HTML of the element when it is kept as it is
+	children []*htmlNode
+}
+
+// An attribute of a start tag, with its value quoted or not
+var reHTMLAttr = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+
+// The elements which are kept as raw HTML in the Pandoc document, because their structure is richer than Pandoc's
+var pandocRawElements = []string{"table", "svg", "iframe", "video", "audio", "object", "form"}
+
+// The elements whose end tag can be omitted, closed by the start tag of each element, like a <li> by the next one
+var impliedEndTags = map[string][]string{
+	"li": {"li", "p"},
+	"dt": {"dt", "dd", "p"},
+	"dd": {"dt", "dd", "p"},
+	"tr": {"tr", "td", "th"},
+	"td": {"td", "th", "p"},
+	"th": {"td", "th", "p"},
+	"p":  {"p"},
+}
+
+// parseHTML returns the tree of the elements of the HTML. The end tags which can be omitted close their element
+// when the next element or the end tag of an enclosing element is found, and the end tags without start tag
+// are ignored.
+func parseHTML(source string) *htmlNode {
+	root := &htmlNode{name: "#root"}
+	stack := []*htmlNode{root}
+
+	for len(source) > 0 {
+		token := reHTMLToken.FindString(source)
+		if len(token) == 0 {
+			break
+		}
+		parent := stack[len(stack)-1]
+
+		m := reTagName.FindStringSubmatch(token)
+		switch {
+		case strings.HasPrefix(token, "<!"):
+			source = source[len(token):]
+
+		case m == nil:
+			parent.children = append(parent.children, &htmlNode{text: html.UnescapeString(token)})
+			source = source[len(token):]
+
+		case strings.HasPrefix(token, "</"):
+			name := strings.ToLower(m[1])
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			source = source[len(token):]
+
+		default:
+			name := strings.ToLower(m[1])
+			for len(stack) > 1 && contains(impliedEndTags[name], stack[len(stack)-1].name) {
+				stack = stack[:len(stack)-1]
+			}
+			parent = stack[len(stack)-1]
+			node := &htmlNode{name: name, attrs: map[string]string{}}
+			for _, a := range reHTMLAttr.FindAllStringSubmatch(token[len(m[0]):], -1) {
+				node.attrs[strings.ToLower(a[1])] = html.UnescapeString(a[2] + a[3] + a[4])
+			}
+			parent.children = append(parent.children, node)
+
+			// The elements written as they are keep their HTML, and their content is parsed for the other formats
+			if contains(pandocRawElements, name) || name == "script" || name == "style" {
+				contentEnd, end := len(source), len(source)
+				closing := "</" + name
+				if i := strings.Index(strings.ToLower(source), closing); i >= 0 {
+					contentEnd, end = i, i+len(closing)
+					if j := strings.IndexByte(source[end:], '>'); j >= 0 {
+						end = end + j + 1
+					}
+				}
+				node.text = source[:end]
+				if name != "script" && name != "style" && contentEnd >= len(token) {
+					node.children = parseHTML(source[len(token):contentEnd]).children
+				}
+				source = source[end:]
+				continue
+			}
+
+			source = source[len(token):]
+			if !contains(voidElements, name) && name != "param" && !strings.HasSuffix(token, "/>") {
+				stack = append(stack, node)
+			}
+		}
+	}
+
+	return root
+}
+
+// textContent returns the text of the node and its descendants
+func (n *htmlNode) textContent() string {
+	if len(n.name) == 0 {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(c.textContent())
+	}
+	return sb.String()
+}
+
+// hasClass returns true if the element has the class
+func (n *htmlNode) hasClass(class string) bool {
+	return contains(strings.Fields(n.attrs["class"]), class)
+}
+
+// pandocAttr returns the attributes of the element in the format of Pandoc: the id, the classes and the rest
+// of attributes, except the ones generated by rite for its own use and the ones excluded, which are part
+// of the node of Pandoc, like the 'href' of a link
+func (n *htmlNode) pandocAttr(excluded ...string) []any {
+	classes := []any{}
+	for _, class := range strings.Fields(n.attrs["class"]) {
+		classes = append(classes, class)
+	}
+
+	names := []string{}
+	for name := range n.attrs {
+		if name != "id" && name != "class" && !strings.HasPrefix(name, "data-rite-") && !contains(excluded, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	pairs := []any{}
+	for _, name := range names {
+		pairs = append(pairs, []any{name, n.attrs[name]})
+	}
+
+	return []any{n.attrs["id"], classes, pairs}
+}
+
+// ToPandoc returns the document as the JSON of a Pandoc document, which can be converted by Pandoc to any of its
+// output formats, like in 'pandoc -f json -t docx'. The document is converted from the generated HTML, so it has
+// the numbers of the sections and the cross references solved. The elements which have no equivalent in Pandoc,
+// like the tables, are written as raw HTML.
+func (doc *Document) ToPandoc(generated string) ([]byte, error) {
+	meta := map[string]any{
+		"title": map[string]any{"t": "MetaInlines", "c": pandocText(doc.Title())},
+		"lang":  map[string]any{"t": "MetaString", "c": doc.Lang()},
+	}
+	if description := doc.Description(); len(description) > 0 {
+		meta["description"] = map[string]any{"t": "MetaInlines", "c": pandocText(description)}
+	}
+	if authors := doc.authors(); len(authors) > 0 {
+		list := []any{}
+		for _, author := range authors {
+			list = append(list, map[string]any{"t": "MetaInlines", "c": pandocText(author)})
+		}
+		meta["author"] = map[string]any{"t": "MetaList", "c": list}
+	}
+
+	return json.Marshal(map[string]any{
+		"pandoc-api-version": pandocAPIVersion,
+		"meta":               meta,
+		"blocks":             pandocBlocks(parseHTML(doc.articleContent(generated)).children),
+	})
+}
+
+// articleContent returns the content of the document in the generated HTML, which is the <article> element
+// of the template, or the <body> element for the templates without it
+func (doc *Document) articleContent(generated string) string {
+	content := generated
+	for _, name := range []string{"article", "body"} {
+		start := strings.Index(content, "<"+name)
+		end := strings.LastIndex(content, "</"+name+">")
+		if start >= 0 && end > start {
+			content = content[start:end]
+			content = content[strings.IndexByte(content, '>')+1:]
+			break
+		}
+	}
+
+	// The navigation between the documents of a directory is not part of the document
+	if len(doc.nav) > 0 {
+		content = strings.ReplaceAll(content, doc.nav, "")
+	}
+	return content
+}
+
+// pandocBlocks converts a list of nodes to blocks of Pandoc. The texts and inline elements between blocks are
+// written in a Plain block.
+func pandocBlocks(nodes []*htmlNode) []any {
+	blocks := []any{}
+	inlines := []*htmlNode{}
+
+	flush := func() {
+		if converted := trimInlines(pandocInlines(inlines)); len(converted) > 0 {
+			blocks = append(blocks, pandocNode("Plain", converted))
+		}
+		inlines = nil
+	}
+
+	for _, n := range nodes {
+		if len(n.name) == 0 || !isPandocBlock(n) {
+			inlines = append(inlines, n)
+			continue
+		}
+		flush()
+		if block := pandocBlock(n); block != nil {
+			blocks = append(blocks, block...)
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// isPandocBlock returns true if the element is converted to a block of Pandoc
+func isPandocBlock(n *htmlNode) bool {
+	if n.name == "div" || n.name == "section" || n.name == "pre" || n.name == "figcaption" || n.name == "script" || n.name == "style" {
+		return true
+	}
+	return contains(blockElements, n.name) || contains(pandocRawElements, n.name)
+}
+
+// pandocBlock converts an element to the blocks of Pandoc, or to none if the element is not part of the content
+func pandocBlock(n *htmlNode) []any {
+	switch {
+	case n.name == "script" || n.name == "style":
+		return nil
+
+	case len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6':
+		level := int(n.name[1] - '0')
+		return []any{pandocNode("Header", level, n.pandocAttr(), trimInlines(pandocInlines(n.children)))}
+
+	case n.name == "p":
+		inlines := trimInlines(pandocInlines(n.children))
+		if len(inlines) == 0 {
+			return nil
+		}
+		return []any{pandocNode("Para", inlines)}
+
+	case n.name == "hr":
+		return []any{map[string]any{"t": "HorizontalRule"}}
+
+	case n.name == "pre":
+		return []any{pandocCodeBlock(n)}
+
+	case n.name == "blockquote":
+		return []any{pandocNode("BlockQuote", pandocBlocks(n.children))}
+
+	case n.name == "ul" || n.name == "ol":
+		items := []any{}
+		for _, c := range n.children {
+			if c.name == "li" {
+				items = append(items, pandocBlocks(c.children))
+			}
+		}
+		if n.name == "ul" {
+			return []any{pandocNode("BulletList", items)}
+		}
+		start, err := strconv.Atoi(n.attrs["start"])
+		if err != nil {
+			start = 1
+		}
+		listAttr := []any{start, map[string]any{"t": "Decimal"}, map[string]any{"t": "Period"}}
+		return []any{pandocNode("OrderedList", listAttr, items)}
+
+	case n.name == "dl":
+		items := []any{}
+		for _, c := range n.children {
+			switch c.name {
+			case "dt":
+				items = append(items, []any{trimInlines(pandocInlines(c.children)), []any{}})
+			case "dd":
+				if len(items) == 0 {
+					items = append(items, []any{[]any{}, []any{}})
+				}
+				item := items[len(items)-1].([]any)
+				item[1] = append(item[1].([]any), pandocBlocks(c.children))
+			}
+		}
+		return []any{pandocNode("DefinitionList", items)}
+
+	case n.name == "figure":
+		caption := []any{}
+		content := []*htmlNode{}
+		for _, c := range n.children {
+			if c.name == "figcaption" {
+				caption = pandocBlocks(c.children)
+			} else {
+				content = append(content, c)
+			}
+		}
+		return []any{pandocNode("Figure", n.pandocAttr(), []any{nil, caption}, pandocBlocks(content))}
+
+	case n.name == "div" && n.hasClass("math"):
+		return []any{pandocNode("Para", []any{pandocNode("Math", map[string]any{"t": "DisplayMath"}, n.textContent())})}
+
+	case contains(pandocRawElements, n.name):
+		return []any{pandocNode("RawBlock", "html", n.text)}
+	}
+
+	// The rest of blocks, like sections, are divisions with their attributes
+	return []any{pandocNode("Div", n.pandocAttr(), pandocBlocks(n.children))}
+}
+
+// pandocCodeBlock converts a <pre> element to a code block, with the language of its <code> element as class
+func pandocCodeBlock(n *htmlNode) any {
+	attr := n.pandocAttr()
+	for _, c := range n.children {
+		if c.name == "code" {
+			attr = c.pandocAttr()
+			if id := n.attrs["id"]; len(id) > 0 {
+				attr[0] = id
+			}
+			break
+		}
+	}
+	return pandocNode("CodeBlock", attr, strings.TrimSuffix(n.textContent(), "\n"))
+}
+
+// pandocInlines converts a list of nodes to inlines of Pandoc
+func pandocInlines(nodes []*htmlNode) []any {
+	inlines := []any{}
+	for _, n := range nodes {
+		inlines = append(inlines, pandocInline(n)...)
+	}
+	return inlines
+}
+
+// pandocInline converts a text or an inline element to inlines of Pandoc
+func pandocInline(n *htmlNode) []any {
+	if len(n.name) == 0 {
+		return pandocText(n.text)
+	}
+
+	children := func() []any { return pandocInlines(n.children) }
+
+	switch n.name {
+	case "em", "i", "dfn", "cite":
+		return []any{pandocNode("Emph", children())}
+	case "strong", "b":
+		return []any{pandocNode("Strong", children())}
+	case "u", "ins":
+		return []any{pandocNode("Underline", children())}
+	case "s", "del", "strike":
+		return []any{pandocNode("Strikeout", children())}
+	case "sup":
+		return []any{pandocNode("Superscript", children())}
+	case "sub":
+		return []any{pandocNode("Subscript", children())}
+	case "code", "kbd", "samp":
+		return []any{pandocNode("Code", n.pandocAttr(), n.textContent())}
+	case "br":
+		return []any{map[string]any{"t": "LineBreak"}}
+	case "img":
+		return []any{pandocNode("Image", n.pandocAttr("src", "alt", "title"), pandocText(n.attrs["alt"]), []any{n.attrs["src"], n.attrs["title"]})}
+	case "a":
+		if _, found := n.attrs["href"]; found {
+			return []any{pandocNode("Link", n.pandocAttr("href", "title"), children(), []any{n.attrs["href"], n.attrs["title"]})}
+		}
+	case "span":
+		// The numbers of the sections are written by Pandoc when requested, like with '--number-sections'
+		if n.hasClass("secno") {
+			return nil
+		}
+		if n.hasClass("math") {
+			return []any{pandocNode("Math", map[string]any{"t": "InlineMath"}, n.textContent())}
+		}
+	case "input", "wbr":
+		return nil
+	}
+
+	if contains(pandocRawElements, n.name) {
+		return []any{pandocNode("RawInline", "html", n.text)}
+	}
+	return []any{pandocNode("Span", n.pandocAttr(), children())}
+}
+
+// pandocText converts a text to the words and spaces of Pandoc, with the line breaks of the source as soft breaks
+func pandocText(text string) []any {
+	inlines := []any{}
+	word := strings.Builder{}
+	space, newLine := false, false
+
+	flushWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		if space {
+			if newLine {
+				inlines = append(inlines, map[string]any{"t": "SoftBreak"})
+			} else {
+				inlines = append(inlines, map[string]any{"t": "Space"})
+			}
+		}
+		inlines = append(inlines, pandocNode("Str", word.String()))
+		word.Reset()
+		space, newLine = false, false
+	}
+
+	for _, r := range text {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			flushWord()
+			space = true
+			newLine = newLine || r == '\n'
+		default:
+			if space && len(inlines) == 0 && word.Len() == 0 {
+				// The spaces at the start are kept, to separate the text from the previous inline
+				inlines = append(inlines, map[string]any{"t": "Space"})
+				space, newLine = false, false
+			}
+			word.WriteRune(r)
+		}
+	}
+	flushWord()
+	if space {
+		inlines = append(inlines, map[string]any{"t": "Space"})
+	}
+
+	return inlines
+}
+
+// trimInlines returns the inlines without the spaces and breaks at the start and the end, and with the
+// consecutive spaces collapsed, which come from the texts between the elements
+func trimInlines(inlines []any) []any {
+	isSpace := func(inline any) bool {
+		m, ok := inline.(map[string]any)
+		return ok && (m["t"] == "Space" || m["t"] == "SoftBreak")
+	}
+
+	result := []any{}
+	for _, inline := range inlines {
+		if isSpace(inline) && (len(result) == 0 || isSpace(result[len(result)-1])) {
+			continue
+		}
+		result = append(result, inline)
+	}
+	for len(result) > 0 && isSpace(result[len(result)-1]) {
+		result = result[:len(result)-1]
+	}
+	return result
+}
+
+// pandocNode returns a node of Pandoc with its type and its content, which is a list if there are several values
+func pandocNode(t string, content ...any) map[string]any {
+	if len(content) == 1 {
+		return map[string]any{"t": t, "c": content[0]}
+	}
+	return map[string]any{"t": t, "c": content}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// profiles are the variants of the document selected by the user, like "public" or "internal".
+// Blocks with the 'if' attribute are included only if one of their profiles is selected.
+var profiles []string
+
+// The 'if' attribute of a tag, like in '<section if="internal">' or '<p if=draft,internal>'
+var reIfAttribute = regexp.MustCompile(`\s+if="?([^"\s>}]+)"?`)
+
+// profileSelected returns true if the condition of an 'if' attribute is met with the profiles selected.
+// The condition is a comma separated list of profiles, and is met if any of them is selected.
+// A profile preceded by '!' is met when the profile is not selected, like in 'if="!internal"'.
+func profileSelected(condition string) bool {
+	for _, p := range strings.Split(condition, ",") {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "!") {
+			if !contains(profiles, p[1:]) {
+				return true
+			}
+		} else if contains(profiles, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// preprocessCondition removes the 'if' attribute from the tag spec at the beginning of the line, and returns
+// false if the block started by the tag must not be included in the document
+func (doc *Document) preprocessCondition(lineNum int) bool {
+	line := doc.lines[lineNum]
+	if !startsWithTag(line) {
+		return true
+	}
+
+	// Look for the attribute only in the tag spec, not in the rest of the line
+	end := strings.IndexRune(line, endTagFor[rune(line[0])])
+	if end < 0 {
+		end = len(line)
+	}
+	tagSpec := line[:end]
+
+	m := reIfAttribute.FindStringSubmatchIndex(tagSpec)
+	if m == nil {
+		return true
+	}
+
+	doc.lines[lineNum] = tagSpec[:m[0]] + tagSpec[m[1]:] + line[end:]
+	return profileSelected(tagSpec[m[2]:m[3]])
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ToRFCXML returns the document in the RFC XML vocabulary version 3 of RFC 7991, which xml2rfc converts to the
+// formats of the Internet-Drafts. The document is converted from the generated HTML, like the other formats:
+// the headings become nested sections, the code blocks become <sourcecode> and the images and diagrams become
+// <artwork>. The bibliography is written as <references> from its entries, with the keys as anchors.
+// The attributes of the draft are given in the YAML header, like 'docName: draft-doe-example-00', 'category: std'
+// and 'ipr: trust200902'.
+func (doc *Document) ToRFCXML(generated string) string {
+	nodes := parseHTML(doc.articleContent(generated)).children
+
+	w := &rfcWriter{doc: doc, anchors: map[string]bool{}}
+	w.collectAnchors(nodes)
+	for _, key := range doc.orderedEntries() {
+		if doc.biblio[key] != nil {
+			w.anchors["bib_"+key] = true
+		}
+	}
+
+	docName := doc.config.String("docName", strings.TrimSuffix(filepath.Base(doc.fileName), filepath.Ext(doc.fileName)))
+	w.printf("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	w.printf("<rfc xmlns:xi=\"http://www.w3.org/2001/XInclude\" version=\"3\" docName=\"%v\" category=\"%v\" ipr=\"%v\" submissionType=\"%v\" xml:lang=\"%v\">\n",
+		xmlEscape(docName), xmlEscape(doc.config.String("category", "info")), xmlEscape(doc.config.String("ipr", "trust200902")),
+		xmlEscape(doc.config.String("submissionType", "IETF")), xmlEscape(doc.Lang()))
+
+	// The front has the metadata of the YAML header and the abstract, which is the section with the 'abstract' id
+	// or otherwise the description
+	w.printf("<front>\n<title>%v</title>\n", xmlEscape(doc.Title()))
+	for _, author := range doc.authors() {
+		w.printf("<author fullname=\"%v\"/>\n", xmlEscape(author))
+	}
+	w.printf("<date/>\n")
+	if abstract := findNode(nodes, func(n *htmlNode) bool { return n.name == "section" && n.attrs["id"] == "abstract" }); abstract != nil {
+		w.printf("<abstract>\n")
+		w.flow(abstract.children)
+		w.printf("</abstract>\n")
+	} else if description := doc.Description(); len(description) > 0 {
+		w.printf("<abstract>\n<t>%v</t>\n</abstract>\n", description)
+	}
+	w.printf("</front>\n")
+
+	w.printf("<middle>\n")
+	w.middle(nodes)
+	w.printf("</middle>\n")
+
+	w.printf("<back>\n")
+	w.references()
+	if footnotes := findNode(nodes, func(n *htmlNode) bool { return n.name == "section" && n.hasClass("footnotes") }); footnotes != nil {
+		w.printf("<section numbered=\"false\">\n<name>%v</name>\n", xmlEscape(doc.localize("Notes")))
+		w.flow(footnotes.children)
+		w.printf("</section>\n")
+	}
+	w.printf("</back>\n")
+	w.printf("</rfc>\n")
+
+	return w.sb.String()
+}
+
+// rfcWriter writes the elements of the RFC XML of a document
+type rfcWriter struct {
+	sb      strings.Builder
+	doc     *Document
+	anchors map[string]bool // The ids of the elements written with an anchor, which can be the target of an <xref>
+}
+
+func (w *rfcWriter) printf(format string, args ...any) {
+	w.sb.WriteString(fmt.Sprintf(format, args...))
+}
+
+// The elements which keep their id as the anchor of the element of RFC XML, which can be referenced
+var rfcAnchorElements = []string{"h1", "h2", "h3", "h4", "h5", "h6", "table", "figure", "li", "dt"}
+
+// An id which can be the anchor of an element, which is an XML name without a prefix
+var reRFCAnchor = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+
+// collectAnchors registers the ids of the elements which are written with an anchor, so the links to the
+// other ids, which can not be the target of an <xref>, are written as their text
+func (w *rfcWriter) collectAnchors(nodes []*htmlNode) {
+	for _, n := range nodes {
+		if id := n.attrs["id"]; reRFCAnchor.MatchString(id) && contains(rfcAnchorElements, n.name) {
+			w.anchors[id] = true
+		}
+		w.collectAnchors(n.children)
+	}
+}
+
+// anchor returns the anchor attribute for the id of the element, if it has one which is valid
+func (w *rfcWriter) anchor(n *htmlNode) string {
+	if id := n.attrs["id"]; reRFCAnchor.MatchString(id) {
+		return fmt.Sprintf(" anchor=\"%v\"", xmlEscape(id))
+	}
+	return ""
+}
+
+// findNode returns the first node in the tree which matches, or nil if none does
+func findNode(nodes []*htmlNode, match func(n *htmlNode) bool) *htmlNode {
+	for _, n := range nodes {
+		if match(n) {
+			return n
+		}
+		if found := findNode(n.children, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isRFCContainer returns true if the element only groups other elements, so its content is written
+// in the sections of the document like if it was not there
+func isRFCContainer(n *htmlNode) bool {
+	switch n.name {
+	case "section", "header", "main", "article":
+		return true
+	case "div":
+		return !n.hasClass("admonition") && !n.hasClass("math") && !n.hasClass("mermaid")
+	}
+	return false
+}
+
+// middle writes the content of the document as nested sections, which are opened by the headings and closed by
+// the next heading of the same or a higher level. The content before the first heading is written in a section
+// without name. The abstract, the bibliography and the footnotes are written in the front and the back.
+func (w *rfcWriter) middle(nodes []*htmlNode) {
+	levels := []int{}
+	var blocks []*htmlNode
+
+	flush := func() {
+		if len(blocks) == 0 {
+			return
+		}
+		if len(levels) == 0 {
+			w.printf("<section>\n")
+			levels = append(levels, 0)
+		}
+		w.flow(blocks)
+		blocks = nil
+	}
+
+	var walk func(nodes []*htmlNode)
+	walk = func(nodes []*htmlNode) {
+		for _, n := range nodes {
+			switch {
+			case n.name == "section" && (n.attrs["id"] == "abstract" || n.hasClass("references") || n.hasClass("footnotes")):
+				continue
+			case n.name == "nav" || n.name == "script" || n.name == "style":
+				continue
+			case isRFCContainer(n):
+				walk(n.children)
+			case len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6':
+				flush()
+				level := int(n.name[1] - '0')
+				for len(levels) > 0 && (levels[len(levels)-1] >= level || levels[len(levels)-1] == 0) {
+					w.printf("</section>\n")
+					levels = levels[:len(levels)-1]
+				}
+				numbered := ""
+				if n.hasClass("no-num") {
+					numbered = " numbered=\"false\""
+				}
+				w.printf("<section%v%v>\n<name>%v</name>\n", w.anchor(n), numbered, strings.TrimSpace(w.inlines(n.children)))
+				levels = append(levels, level)
+			default:
+				blocks = append(blocks, n)
+			}
+		}
+	}
+	walk(nodes)
+	flush()
+
+	for range levels {
+		w.printf("</section>\n")
+	}
+}
+
+// flow writes a list of nodes as blocks. The texts and inline elements between blocks are written as a paragraph.
+func (w *rfcWriter) flow(nodes []*htmlNode) {
+	inlines := []*htmlNode{}
+
+	flush := func() {
+		if text := strings.TrimSpace(w.inlines(inlines)); len(text) > 0 {
+			w.printf("<t>%v</t>\n", text)
+		}
+		inlines = nil
+	}
+
+	for _, n := range nodes {
+		if len(n.name) == 0 || !isPandocBlock(n) {
+			inlines = append(inlines, n)
+			continue
+		}
+		flush()
+		w.block(n)
+	}
+	flush()
+}
+
+// block writes an element as the equivalent blocks of RFC XML
+func (w *rfcWriter) block(n *htmlNode) {
+	switch {
+	case n.name == "script" || n.name == "style" || n.name == "nav" || n.name == "hr":
+		return
+
+	case len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6':
+		// The headings inside other blocks, like in the abstract, are not sections
+		return
+
+	case n.name == "p":
+		w.flow(n.children)
+
+	case n.name == "pre":
+		w.sourcecode(n)
+
+	case n.name == "blockquote":
+		w.printf("<blockquote>\n")
+		w.flow(n.children)
+		w.printf("</blockquote>\n")
+
+	case n.name == "ul" || n.name == "ol":
+		w.printf("<%v%v>\n", n.name, w.anchor(n))
+		for _, c := range n.children {
+			if c.name != "li" {
+				continue
+			}
+			w.printf("<li%v>\n", w.anchor(c))
+			w.flow(c.children)
+			w.printf("</li>\n")
+		}
+		w.printf("</%v>\n", n.name)
+
+	case n.name == "dl":
+		w.printf("<dl%v>\n", w.anchor(n))
+		for _, c := range n.children {
+			switch c.name {
+			case "dt":
+				w.printf("<dt%v>%v</dt>\n", w.anchor(c), strings.TrimSpace(w.inlines(c.children)))
+			case "dd":
+				w.printf("<dd>\n")
+				w.flow(c.children)
+				w.printf("</dd>\n")
+			}
+		}
+		w.printf("</dl>\n")
+
+	case n.name == "table":
+		w.table(n)
+
+	case n.name == "figure":
+		w.figure(n)
+
+	case n.name == "div" && n.hasClass("admonition"):
+		w.printf("<aside%v>\n", w.anchor(n))
+		w.flow(n.children)
+		w.printf("</aside>\n")
+
+	case n.name == "div" && (n.hasClass("math") || n.hasClass("mermaid")):
+		w.printf("<artwork type=\"ascii-art\"><![CDATA[%v]]></artwork>\n", cdata(strings.Trim(n.textContent(), "\n")))
+
+	case n.name == "figcaption":
+		return
+
+	default:
+		w.flow(n.children)
+	}
+}
+
+// A language of a code block in the classes of its <code> element, like 'language-json'
+var reLanguageClass = regexp.MustCompile(`\blanguage-([a-zA-Z0-9_+-]+)`)
+
+// sourcecode writes a code block, with the type of its language
+func (w *rfcWriter) sourcecode(n *htmlNode) {
+	typ := ""
+	if code := findNode(n.children, func(c *htmlNode) bool { return c.name == "code" }); code != nil {
+		if m := reLanguageClass.FindStringSubmatch(code.attrs["class"]); m != nil {
+			typ = fmt.Sprintf(" type=\"%v\"", xmlEscape(m[1]))
+		}
+	}
+	w.printf("<sourcecode%v%v><![CDATA[%v]]></sourcecode>\n", w.anchor(n), typ, cdata(strings.Trim(n.textContent(), "\n")))
+}
+
+// figure writes a figure with its image, code or diagram as the content, and its caption without the label,
+// because xml2rfc numbers the figures itself
+func (w *rfcWriter) figure(n *htmlNode) {
+	w.printf("<figure%v>\n", w.anchor(n))
+	if caption := findNode(n.children, func(c *htmlNode) bool { return c.name == "figcaption" }); caption != nil {
+		w.printf("<name>%v</name>\n", w.caption(caption.children))
+	}
+
+	for _, c := range n.children {
+		switch {
+		case c.name == "img":
+			typ := "binary-art"
+			if strings.HasSuffix(strings.ToLower(c.attrs["src"]), ".svg") {
+				typ = "svg"
+			}
+			w.printf("<artwork type=\"%v\" src=\"%v\" alt=\"%v\"/>\n", typ, xmlEscape(c.attrs["src"]), xmlEscape(c.attrs["alt"]))
+		case c.name == "figcaption" || len(c.name) == 0:
+			continue
+		case c.name == "pre":
+			w.sourcecode(c)
+		default:
+			w.block(c)
+		}
+	}
+	w.printf("</figure>\n")
+}
+
+// table writes a table with the rows of headers at the start in <thead> and the rest in <tbody>
+func (w *rfcWriter) table(n *htmlNode) {
+	w.printf("<table%v>\n", w.anchor(n))
+
+	rows := []*htmlNode{}
+	var collect func(nodes []*htmlNode)
+	collect = func(nodes []*htmlNode) {
+		for _, c := range nodes {
+			switch c.name {
+			case "caption":
+				w.printf("<name>%v</name>\n", w.caption(c.children))
+			case "thead", "tbody", "tfoot":
+				collect(c.children)
+			case "tr":
+				rows = append(rows, c)
+			}
+		}
+	}
+	collect(n.children)
+
+	header := 0
+	for header < len(rows) && findNode(rows[header].children, func(c *htmlNode) bool { return c.name == "td" }) == nil {
+		header++
+	}
+
+	writeRows := func(section string, rows []*htmlNode) {
+		if len(rows) == 0 {
+			return
+		}
+		w.printf("<%v>\n", section)
+		for _, row := range rows {
+			w.printf("<tr>")
+			for _, cell := range row.children {
+				if cell.name != "td" && cell.name != "th" {
+					continue
+				}
+				span := ""
+				for _, attr := range []string{"colspan", "rowspan"} {
+					if value := cell.attrs[attr]; len(value) > 0 {
+						span = span + fmt.Sprintf(" %v=\"%v\"", attr, xmlEscape(value))
+					}
+				}
+				w.printf("<%v%v>%v</%v>", cell.name, span, strings.TrimSpace(w.inlines(cell.children)), cell.name)
+			}
+			w.printf("</tr>\n")
+		}
+		w.printf("</%v>\n", section)
+	}
+	writeRows("thead", rows[:header])
+	writeRows("tbody", rows[header:])
+
+	w.printf("</table>\n")
+}
+
+// caption returns the text of a caption without the label with the number, like "Figure 3. "
+func (w *rfcWriter) caption(nodes []*htmlNode) string {
+	text := strings.TrimSpace(w.inlines(nodes))
+	for _, c := range w.doc.captions {
+		if strings.HasPrefix(text, xmlEscape(c.label)) {
+			return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(text, xmlEscape(c.label)), "."))
+		}
+	}
+	return text
+}
+
+// inlines returns the RFC XML of a list of texts and inline elements
+func (w *rfcWriter) inlines(nodes []*htmlNode) string {
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(w.inline(n))
+	}
+	return sb.String()
+}
+
+// inline returns the RFC XML of a text or an inline element. The links to the elements of the document and to
+// the entries of the bibliography are written as <xref>, and the links to other sites as <eref>.
+func (w *rfcWriter) inline(n *htmlNode) string {
+	if len(n.name) == 0 {
+		return xmlEscape(n.text)
+	}
+
+	content := w.inlines(n.children)
+	switch n.name {
+	case "b", "strong":
+		return "<strong>" + content + "</strong>"
+	case "i", "em", "dfn", "var":
+		if n.hasClass("rfc2119") {
+			return "<bcp14>" + content + "</bcp14>"
+		}
+		return "<em>" + content + "</em>"
+	case "code", "tt", "kbd", "samp":
+		return "<tt>" + content + "</tt>"
+	case "sub", "sup":
+		return "<" + n.name + ">" + content + "</" + n.name + ">"
+	case "br":
+		return "<br/>"
+	case "img":
+		return xmlEscape(n.attrs["alt"])
+	case "input", "wbr", "script", "style":
+		return ""
+	case "span":
+		if n.hasClass("secno") || n.hasClass("admonition-label") || n.hasClass("admonition-icon") {
+			return ""
+		}
+	case "a":
+		href := n.attrs["href"]
+		switch {
+		case n.hasClass("footnote-backref"):
+			return ""
+		case strings.HasPrefix(href, "#bib_") && w.anchors[href[1:]]:
+			return fmt.Sprintf("<xref target=\"%v\"/>", xmlEscape(strings.TrimPrefix(href, "#bib_")))
+		case strings.HasPrefix(href, "#") && w.anchors[href[1:]]:
+			return fmt.Sprintf("<xref target=\"%v\">%v</xref>", xmlEscape(href[1:]), content)
+		case isURL(href) && strings.TrimSpace(n.textContent()) == href:
+			return fmt.Sprintf("<eref target=\"%v\"/>", xmlEscape(href))
+		case isURL(href):
+			return fmt.Sprintf("<eref target=\"%v\">%v</eref>", xmlEscape(href), content)
+		}
+	}
+
+	return content
+}
+
+// references writes the entries of the bibliography cited in the document, with their keys as anchors
+func (w *rfcWriter) references() {
+	keys := []string{}
+	for _, key := range w.doc.orderedEntries() {
+		if w.doc.biblio[key] != nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	w.printf("<references>\n<name>%v</name>\n", xmlEscape(w.doc.localize("References")))
+	for _, key := range keys {
+		entry := w.doc.biblio[key]
+		target := ""
+		if len(entry.href) > 0 {
+			target = fmt.Sprintf(" target=\"%v\"", xmlEscape(entry.href))
+		}
+		w.printf("<reference anchor=\"%v\"%v>\n<front>\n<title>%v</title>\n", xmlEscape(key), target, xmlEscape(entry.title))
+		for _, author := range entry.authors {
+			w.printf("<author fullname=\"%v\"/>\n", xmlEscape(author))
+		}
+		for _, editor := range entry.editors {
+			w.printf("<author fullname=\"%v\" role=\"editor\"/>\n", xmlEscape(editor))
+		}
+		w.printf("%v\n</front>\n", rfcDate(entry.date))
+		if len(entry.doi) > 0 {
+			w.printf("<seriesInfo name=\"DOI\" value=\"%v\"/>\n", xmlEscape(entry.doi))
+		}
+		if content := strings.Join(nonEmpty(entry.status, entry.publisher, entry.version), ", "); len(content) > 0 {
+			w.printf("<refcontent>%v</refcontent>\n", xmlEscape(content))
+		}
+		w.printf("</reference>\n")
+	}
+	w.printf("</references>\n")
+}
+
+// The months in the dates of the bibliography, in English, which xml2rfc expects
+var rfcMonths = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+// A date in the bibliography, like '2022-03-03', '2022-03', 'March 2022' or '2022'
+var (
+	reISODate  = regexp.MustCompile(`^(\d{4})-(\d{2})(?:-(\d{2}))?`)
+	reYearDate = regexp.MustCompile(`\b(\d{4})\b`)
+)
+
+// rfcDate returns the <date> element of a date of the bibliography, with the year and month when they are known
+func rfcDate(date string) string {
+	if m := reISODate.FindStringSubmatch(date); m != nil {
+		month := 0
+		fmt.Sscan(m[2], &month)
+		if month >= 1 && month <= 12 {
+			if len(m[3]) > 0 {
+				return fmt.Sprintf("<date year=\"%v\" month=\"%v\" day=\"%v\"/>", m[1], rfcMonths[month-1], strings.TrimPrefix(m[3], "0"))
+			}
+			return fmt.Sprintf("<date year=\"%v\" month=\"%v\"/>", m[1], rfcMonths[month-1])
+		}
+	}
+
+	m := reYearDate.FindStringSubmatch(date)
+	if m == nil {
+		return "<date/>"
+	}
+	lower := strings.ToLower(date)
+	for _, month := range rfcMonths {
+		if strings.Contains(lower, strings.ToLower(month)) {
+			return fmt.Sprintf("<date year=\"%v\" month=\"%v\"/>", m[1], month)
+		}
+	}
+	return fmt.Sprintf("<date year=\"%v\"/>", m[1])
+}
+
+// nonEmpty returns the strings which are not empty
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// xmlEscape escapes the text for the content or the attributes of an XML element
+func xmlEscape(s string) string {
+	return html.EscapeString(s)
+}
+
+// cdata returns the text for a CDATA section, splitting the end markers of the section which are in the text
+func cdata(s string) string {
+	return strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRFCXML(t *testing.T) {
+	doc := newTestDocumentWithBibliography(t, "---\ntitle: Example Protocol\nauthors: [Jane Doe]\ndescription: An example & more\n"+
+		"bibliography: biblio.yaml\ndocName: draft-doe-example-00\ncategory: std\n---\n\n"+
+		"Before the sections.\n\n# Introduction\n\nIt is **important**, see [[RFC9068]], <x-ref \"values\"> and https://example.com.\n\n"+
+		"<ul>\n    - First item\n    - Second item\n\n"+
+		"<pre><code class=\"language-json\">\n    {\"a\": \"]]>\"}\n\n"+
+		"<x-table #values>Values\n    <tr><th>Name</th><th>Value</th></tr>\n    <tr><td>a</td><td>1</td></tr>\n\n"+
+		"## Details\n\nThe details.\n\n# Security\n\nNone.\n")
+	out := doc.ToRFCXML(doc.ToHTML())
+	assertNoErrors(t, doc)
+
+	// The result is well-formed
+	d := xml.NewDecoder(strings.NewReader(out))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("the result is not well-formed: %v\n%v", err, out)
+		}
+	}
+
+	for _, want := range []string{
+		`<rfc xmlns:xi="http://www.w3.org/2001/XInclude" version="3" docName="draft-doe-example-00" category="std"`,
+		"<title>Example Protocol</title>\n<author fullname=\"Jane Doe\"/>",
+		"<abstract>\n<t>An example &amp; more</t>\n</abstract>",
+		"<middle>\n<section>\n<t>Before the sections.</t>\n</section>\n<section anchor=\"introduction\">\n<name>Introduction</name>",
+		`<strong>important</strong>`,
+		`<xref target="RFC9068"/>`,
+		`<xref target="values">Table 1</xref>`,
+		`<eref target="https://example.com"/>`,
+		"<li>\n<t>First item</t>\n</li>",
+		`<sourcecode type="json"><![CDATA[{"a": "]]]]><![CDATA[>"}]]></sourcecode>`,
+		"<table anchor=\"values\">\n<name>Values</name>\n<thead>\n<tr><th>Name</th><th>Value</th></tr>\n</thead>\n<tbody>\n<tr><td>a</td><td>1</td></tr>\n</tbody>",
+		"<section anchor=\"details\">\n<name>Details</name>\n<t>The details.</t>\n</section>\n</section>\n<section anchor=\"security\">",
+		"<reference anchor=\"RFC9068\">\n<front>\n<title>JWT Profile for OAuth 2.0 Access Tokens</title>\n<author fullname=\"Vittorio Bertocci\"/>\n<date year=\"2021\" month=\"October\"/>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not found in %v", want, out)
+		}
+	}
+}
+
+func TestRFCDate(t *testing.T) {
+	tests := map[string]string{
+		"2022-03-03":   `<date year="2022" month="March" day="3"/>`,
+		"2022-03":      `<date year="2022" month="March"/>`,
+		"October 2021": `<date year="2021" month="October"/>`,
+		"2020":         `<date year="2020"/>`,
+		"":             `<date/>`,
+	}
+	for date, want := range tests {
+		if got := rfcDate(date); got != want {
+			t.Errorf("rfcDate(%q) = %v, want %v", date, got, want)
+		}
+	}
+}
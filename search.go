@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The names of the search index and the search page generated in directory mode
+const searchIndexName = "search.json"
+const searchPageName = "search.html"
+
+// The maximum length of the text excerpts in the search index
+const searchExcerptLength = 200
+
+var reHTMLTag = regexp.MustCompile(`<[^>]*>`)
+
+// SearchEntry is an entry of the search index, one for each section of each document
+type SearchEntry struct {
+	Title   string `json:"title"`   // The title of the section
+	Page    string `json:"page"`    // The title of the document where the section is
+	Href    string `json:"href"`    // The link to the section, relative to the site directory
+	Excerpt string `json:"excerpt"` // The first text in the section
+}
+
+// plainText removes the HTML tags and collapses the blank space in a string
+func plainText(s string) string {
+	return strings.Join(strings.Fields(reHTMLTag.ReplaceAllString(s, " ")), " ")
+}
+
+// excerpt returns the beginning of a text, cut at a word boundary if it is too long
+func excerpt(text string) string {
+	ex := strings.Join(strings.Fields(text), " ")
+	if len(ex) <= searchExcerptLength {
+		return ex
+	}
+
+	// Cut the excerpt at a word boundary
+	ex = ex[:searchExcerptLength]
+	if i := strings.LastIndex(ex, " "); i > 0 {
+		ex = ex[:i]
+	}
+	return ex + "..."
+}
+
+// sectionExcerpts returns the excerpts of the sections of a generated document, which are the text of the first
+// paragraph after their headings, by the id of the heading. The excerpt of the document, with the empty id,
+// is the text of its first paragraph, which may be after a heading when the document starts with one.
+// They are taken from the generated HTML so the references and the rest of placeholders are solved.
+func (doc *Document) sectionExcerpts(generated string) map[string]string {
+	excerpts := map[string]string{}
+
+	// The id of the heading of the section being walked, and true until its first paragraph is found
+	id := ""
+	pending := true
+
+	var walk func(nodes []*htmlNode)
+	walk = func(nodes []*htmlNode) {
+		for _, n := range nodes {
+			switch {
+			case len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6':
+				id = n.attrs["id"]
+				pending = len(id) > 0
+			case n.name == "p":
+				if _, found := excerpts[""]; !found {
+					excerpts[""] = excerpt(n.textContent())
+				}
+				if pending {
+					excerpts[id] = excerpt(n.textContent())
+					pending = false
+				}
+			case n.name != "script" && n.name != "style":
+				walk(n.children)
+			}
+		}
+	}
+	walk(parseHTML(doc.articleContent(generated)).children)
+
+	return excerpts
+}
+
+// searchIndex builds the search index for all the sections of the documents in the site
+func (site *Site) searchIndex() []SearchEntry {
+	entries := []SearchEntry{}
+
+	for _, page := range site.pages {
+		href := filepath.ToSlash(page.outputName)
+		excerpts := page.doc.sectionExcerpts(page.html)
+
+		entries = append(entries, SearchEntry{
+			Title:   page.doc.Title(),
+			Page:    page.doc.Title(),
+			Href:    href,
+			Excerpt: excerpts[""],
+		})
+
+		for _, h := range page.doc.headings {
+			entry := SearchEntry{
+				Title: plainText(h.title),
+				Page:  page.doc.Title(),
+				Href:  href,
+			}
+			if len(h.id) > 0 {
+				entry.Href = href + "#" + h.id
+				entry.Excerpt = excerpts[h.id]
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// The form and the script of the search page, which loads the search index and filters it as the user types.
+// The placeholder of the input is formatted with the text in the language of the site.
+const searchPageScript = `<input type="search" id="rite-search-input" placeholder="%v" autofocus>
+<ul id="rite-search-results"></ul>
+
+<script>
+(function () {
+  var input = document.getElementById("rite-search-input");
+  var results = document.getElementById("rite-search-results");
+  var index = [];
+
+  fetch("%v").then(function (r) { return r.json(); }).then(function (data) { index = data; });
+
+  input.addEventListener("input", function () {
+    var q = input.value.trim().toLowerCase();
+    results.innerHTML = "";
+    if (q.length < 2) {
+      return;
+    }
+    index.filter(function (e) {
+      return (e.title + " " + e.excerpt).toLowerCase().indexOf(q) >= 0;
+    }).slice(0, 50).forEach(function (e) {
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = e.href;
+      a.textContent = e.title;
+      li.appendChild(a);
+      li.appendChild(document.createTextNode(" (" + e.page + ") " + e.excerpt));
+      results.appendChild(li);
+    });
+  });
+})();
+</script>
+`
+
+// searchDocument builds the document with the heading of the search page, in the language of the site
+func (site *Site) searchDocument() *Document {
+	title := site.localize("Search")
+	src := fmt.Sprintf("---\ntitle: %q\nlang: %q\n---\n\n<h1 .no-num>%v\n", title, site.lang(), html.EscapeString(title))
+
+	linescanner := bufio.NewScanner(strings.NewReader(src))
+	return NewDocument(linescanner, site.log)
+}
+
+// generateSearch writes the search index and the search page of the site
+func (site *Site) generateSearch(dryrun bool) error {
+
+	if site.hasPage(searchPageName) {
+		site.log.Warnw("a document generates the search page, not generating it", "name", searchPageName)
+		return nil
+	}
+
+	site.log.Infof("generating search index %v and page %v", searchIndexName, searchPageName)
+
+	index, err := json.MarshalIndent(site.searchIndex(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The page is a document like the index page, so it has the same placeholders of the template
+	doc := site.searchDocument()
+	content, replacePairs := doc.render()
+	content += fmt.Sprintf(searchPageScript, html.EscapeString(site.localize("Search...")), searchIndexName)
+	searchPage := doc.buildPage(content, replacePairs)
+
+	if dryrun {
+		return nil
+	}
+
+	err = os.WriteFile(filepath.Join(site.dir, searchIndexName), index, 0664)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(site.dir, searchPageName), []byte(searchPage), 0664)
+}
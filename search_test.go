@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newTestSite returns the site with the documents, whose names are relative to a new directory
+func newTestSite(t *testing.T, files map[string]string) *Site {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site, err := NewSiteFromDirectory(dir, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return site
+}
+
+// searchExcerpt returns the excerpt of the entry of the search index with the link
+func searchExcerpt(t *testing.T, index []SearchEntry, href string) string {
+	t.Helper()
+	for _, e := range index {
+		if e.Href == href {
+			return e.Excerpt
+		}
+	}
+	t.Fatalf("no entry for %v in the search index: %v", href, index)
+	return ""
+}
+
+func TestSearchExcerpts(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite": "---\ntitle: A\n---\n\nThe first document.\n\n# Alpha\n\nSee <x-ref \"b.rite#data\"> and <x-ref \"b.rite#data\" num>.\n",
+		"b.rite": "---\ntitle: B\n---\n\n# Beta\n\n<x-table #data>Data\n    <tr><td>1</td></tr>\n",
+	})
+	if err := site.Generate(true); err != nil {
+		t.Fatal(err)
+	}
+	index := site.searchIndex()
+
+	if got, want := searchExcerpt(t, index, "a.html"), "The first document."; got != want {
+		t.Errorf("got document excerpt %q, want %q", got, want)
+	}
+	if got, want := searchExcerpt(t, index, "a.html#alpha"), "See Table 1 and 1."; got != want {
+		t.Errorf("got section excerpt %q, want %q", got, want)
+	}
+	for _, e := range index {
+		if strings.Contains(e.Excerpt, "{#") {
+			t.Errorf("placeholder in the excerpt of %v: %q", e.Href, e.Excerpt)
+		}
+	}
+}
+
+func TestSearchExcerptsWithTableReferences(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite": "---\ntitle: A\n---\n\nAs shown in <x-ref \"yearly\">.\n\n# Growth\n\nThe growth is in <x-ref \"yearly\">, row <x-ref \"yearly\" num>.\n\n" +
+			"<x-table #yearly>Growth by year\n    <tr><td>2024</td><td>10%</td></tr>\n",
+	})
+	if err := site.Generate(true); err != nil {
+		t.Fatal(err)
+	}
+	index := site.searchIndex()
+
+	if got, want := searchExcerpt(t, index, "a.html"), "As shown in Table 1."; got != want {
+		t.Errorf("got document excerpt %q, want %q", got, want)
+	}
+	if got, want := searchExcerpt(t, index, "a.html#growth"), "The growth is in Table 1, row 1."; got != want {
+		t.Errorf("got section excerpt %q, want %q", got, want)
+	}
+}
+
+func TestSearchExcerptOfDocumentStartingWithHeading(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite": "---\ntitle: A\n---\n\n# Introduction\n\nThe first paragraph.\n\nThe second paragraph.\n",
+	})
+	if err := site.Generate(true); err != nil {
+		t.Fatal(err)
+	}
+	index := site.searchIndex()
+
+	if got, want := searchExcerpt(t, index, "a.html"), "The first paragraph."; got != want {
+		t.Errorf("got document excerpt %q, want %q", got, want)
+	}
+	if got, want := searchExcerpt(t, index, "a.html#introduction"), "The first paragraph."; got != want {
+		t.Errorf("got section excerpt %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The extension of the source files processed in directory mode
+const riteExtension = ".rite"
+
+// The name of the index page generated in directory mode
+const siteIndexName = "index.html"
+
+// SitePage is one of the documents processed in directory mode
+type SitePage struct {
+	inputName  string // The path of the source file
+	outputName string // The path of the generated HTML file, relative to the site directory
+	doc        *Document
+	html       string // The generated HTML, from which the search index is built
+}
+
+// Site is the set of documents in a directory tree, processed together so they can be browsed as a set
+type Site struct {
+	dir     string
+	baseURL string // The URL where the site is published, used to generate the sitemap and the feed
+	author  string // The author of the site in the feed, instead of the editors of the documents
+	pages   []*SitePage
+	log     Logger
+}
+
+// NewSiteFromDirectory parses all the rite documents in the directory tree, in lexical order.
+// If logger is nil, nothing is logged.
+func NewSiteFromDirectory(dir string, logger Logger) (*Site, error) {
+
+	site := &Site{
+		dir: dir,
+		log: logger,
+	}
+	if site.log == nil {
+		site.log = zap.NewNop().Sugar()
+	}
+
+	err := filepath.WalkDir(dir, func(fileName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories, like .git
+		if d.IsDir() {
+			if fileName != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filepath.Ext(fileName) != riteExtension {
+			return nil
+		}
+
+		relName, err := filepath.Rel(dir, fileName)
+		if err != nil {
+			return err
+		}
+
+		page := &SitePage{
+			inputName:  fileName,
+			outputName: strings.TrimSuffix(relName, riteExtension) + ".html",
+		}
+		if aborted := catchFatal(func() { page.doc = NewDocumentFromFile(fileName, logger) }); aborted != nil {
+			page.doc = aborted
+		}
+		site.pages = append(site.pages, page)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return site, nil
+}
+
+// hasPage returns true if one of the documents generates the page with the given name, like the index page
+func (site *Site) hasPage(outputName string) bool {
+	for _, page := range site.pages {
+		if page.outputName == outputName {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeLink returns the href to go from the page 'from' to the page 'to', both relative to the site directory
+func relativeLink(from string, to string) string {
+	link, err := filepath.Rel(filepath.Dir(from), to)
+	if err != nil {
+		return filepath.ToSlash(to)
+	}
+	return filepath.ToSlash(link)
+}
+
+// siteRoot returns the relative path from the page of the document to the site directory, like '../' for the pages
+// in a subdirectory, or the empty string for the pages in the site directory and when not processing a directory
+func (doc *Document) siteRoot() string {
+	if doc.site == nil {
+		return ""
+	}
+	for _, page := range doc.site.pages {
+		if page.doc == doc {
+			return strings.Repeat("../", strings.Count(filepath.ToSlash(page.outputName), "/"))
+		}
+	}
+	return ""
+}
+
+// navigation builds the prev/next/up links for the page with the given index
+func (site *Site) navigation(i int) string {
+	var sb strings.Builder
+	page := site.pages[i]
+
+	sb.WriteString("<nav class=\"docnav\">\n")
+	if i > 0 {
+		prev := site.pages[i-1]
+		sb.WriteString(fmt.Sprintf("  <a rel=\"prev\" href=\"%v\">&larr; %v</a>\n", relativeLink(page.outputName, prev.outputName), html.EscapeString(prev.doc.Title())))
+	}
+	if page.outputName != siteIndexName {
+		sb.WriteString(fmt.Sprintf("  <a rel=\"up\" href=\"%v\">%v</a>\n", relativeLink(page.outputName, siteIndexName), html.EscapeString(page.doc.localize("Index"))))
+	}
+	if i < len(site.pages)-1 {
+		next := site.pages[i+1]
+		sb.WriteString(fmt.Sprintf("  <a rel=\"next\" href=\"%v\">%v &rarr;</a>\n", relativeLink(page.outputName, next.outputName), html.EscapeString(next.doc.Title())))
+	}
+	sb.WriteString("</nav>")
+
+	return sb.String()
+}
+
+// title returns the title of the site, which is the name of its directory
+func (site *Site) title() string {
+	if abs, err := filepath.Abs(site.dir); err == nil {
+		return filepath.Base(abs)
+	}
+	return filepath.Base(site.dir)
+}
+
+// lang returns the language of the site, which is the one of its first document
+func (site *Site) lang() string {
+	if len(site.pages) == 0 {
+		return "en"
+	}
+	return site.pages[0].doc.Lang()
+}
+
+// localize returns the text generated by rite in the language of the site, with the translations of its first document
+func (site *Site) localize(text string) string {
+	if len(site.pages) == 0 {
+		return text
+	}
+	return site.pages[0].doc.localize(text)
+}
+
+// indexDocument builds a document listing all the pages of the site.
+// The index is written in rite and processed like any other document.
+func (site *Site) indexDocument() *Document {
+	var src strings.Builder
+
+	title := site.title()
+
+	src.WriteString(fmt.Sprintf("---\ntitle: %q\nlang: %q\n---\n\n", title, site.lang()))
+	src.WriteString(fmt.Sprintf("<h1 .no-num>%v\n\n", html.EscapeString(title)))
+	src.WriteString(fmt.Sprintf("<p .site-search><a href=\"%v\">%v</a>\n\n", searchPageName, html.EscapeString(site.localize("Search"))))
+	src.WriteString("<ul .site-index>\n\n")
+	for _, page := range site.pages {
+		src.WriteString(fmt.Sprintf("   - <a href=\"%v\">%v</a>\n\n", filepath.ToSlash(page.outputName), html.EscapeString(page.doc.Title())))
+	}
+
+	linescanner := bufio.NewScanner(strings.NewReader(src.String()))
+	return NewDocument(linescanner, site.log)
+}
+
+// Generate renders all the documents of the site and the index page, if no document provides it
+func (site *Site) Generate(dryrun bool) error {
+
+	// The number of documents with errors, which are not written
+	failed := 0
+
+	for i, page := range site.pages {
+		page.doc.nav = site.navigation(i)
+		page.doc.site = site
+
+		// The documents with unrecoverable syntax errors are not processed any further
+		site.log.Infof("processing %v and generating %v", page.inputName, page.outputName)
+		var content string
+		if !page.doc.aborted {
+			catchFatal(func() { content = page.doc.ToHTML() })
+		}
+		page.html = content
+
+		page.doc.ReportDiagnostics()
+		if len(page.doc.Errors()) > 0 {
+			failed++
+			continue
+		}
+
+		if dryrun {
+			continue
+		}
+
+		outputName := filepath.Join(site.dir, page.outputName)
+		err := os.WriteFile(outputName, []byte(content), 0664)
+		if err != nil {
+			return err
+		}
+
+		err = page.doc.ExportDefinitions(outputName)
+		if err != nil {
+			return err
+		}
+
+		err = page.doc.CopyAssets(outputName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("errors processing %v documents", failed)
+	}
+
+	err := site.generateSearch(dryrun)
+	if err != nil {
+		return err
+	}
+
+	err = site.generateSitemap(dryrun)
+	if err != nil {
+		return err
+	}
+
+	err = site.generateFeed(dryrun)
+	if err != nil {
+		return err
+	}
+
+	if site.hasPage(siteIndexName) {
+		return nil
+	}
+
+	site.log.Infof("generating index page %v", siteIndexName)
+	content := site.indexDocument().ToHTML()
+	if dryrun {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(site.dir, siteIndexName), []byte(content), 0664)
+}
+
+// processDirectory processes all the rite documents in a directory tree.
+// If baseURL is not empty, a sitemap and a feed of the documents with dates are also generated,
+// and author is the author of the feed if not empty.
+func processDirectory(dir string, baseURL string, author string, dryrun bool, sugar *zap.SugaredLogger) error {
+
+	site, err := NewSiteFromDirectory(dir, sugar)
+	if err != nil {
+		return err
+	}
+	site.baseURL = baseURL
+	site.author = author
+
+	if len(site.pages) == 0 {
+		return fmt.Errorf("no %v files found in %v", riteExtension, dir)
+	}
+
+	return site.Generate(dryrun)
+}
+
+// The names of the files generated for search engines in directory mode
+const sitemapName = "sitemap.xml"
+const robotsName = "robots.txt"
+
+// SitemapURL is an entry in the sitemap
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Sitemap is the list of pages of the site, in the format defined in https://www.sitemaps.org/protocol.html
+type Sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// sitemap builds the sitemap with all the pages generated for the site.
+// The last modification time of each page is the one of its source file.
+func (site *Site) sitemap() *Sitemap {
+	baseURL := strings.TrimSuffix(site.baseURL, "/")
+	today := time.Now().Format("2006-01-02")
+
+	sm := &Sitemap{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+
+	for _, page := range site.pages {
+		lastmod := today
+		if info, err := os.Stat(page.inputName); err == nil {
+			lastmod = info.ModTime().Format("2006-01-02")
+		}
+		sm.URLs = append(sm.URLs, SitemapURL{
+			Loc:     baseURL + "/" + filepath.ToSlash(page.outputName),
+			LastMod: lastmod,
+		})
+	}
+
+	// The pages generated by rite change whenever the site is built
+	for _, name := range []string{siteIndexName, searchPageName} {
+		if !site.hasPage(name) {
+			sm.URLs = append(sm.URLs, SitemapURL{Loc: baseURL + "/" + name, LastMod: today})
+		}
+	}
+
+	return sm
+}
+
+// generateSitemap writes the sitemap and a robots.txt file pointing to it, if the base URL of the site is known
+func (site *Site) generateSitemap(dryrun bool) error {
+
+	if len(site.baseURL) == 0 {
+		site.log.Debugw("no base URL specified, not generating the sitemap")
+		return nil
+	}
+
+	site.log.Infof("generating %v and %v", sitemapName, robotsName)
+
+	out, err := xml.MarshalIndent(site.sitemap(), "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+
+	robots := fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %v/%v\n", strings.TrimSuffix(site.baseURL, "/"), sitemapName)
+
+	if dryrun {
+		return nil
+	}
+
+	err = os.WriteFile(filepath.Join(site.dir, sitemapName), out, 0664)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(site.dir, robotsName), []byte(robots), 0664)
+}
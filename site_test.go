@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateAssetsInSubdirectories(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite":         "---\ntitle: A\n---\n\nText with <img src=\"./assets/a.png\" alt=\"a\">.\n",
+		"sub/b.rite":     "---\ntitle: B\n---\n\nText with <img src=\"./assets/b.png\" alt=\"b\">.\n",
+		"sub/sub/c.rite": "---\ntitle: C\n---\n\nText.\n",
+	})
+	if err := site.Generate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page string
+		want []string
+	}{
+		{"a.html", []string{`href="./assets/w3.css"`, `src="./assets/prism.js"`, `src="./assets/a.png"`}},
+		{"sub/b.html", []string{`href="../assets/w3.css"`, `src="../assets/prism.js"`, `src="./assets/b.png"`}},
+		{"sub/sub/c.html", []string{`href="../../assets/w3.css"`, `href="../../assets/prism.css"`}},
+	}
+	for _, tt := range tests {
+		var html string
+		for _, page := range site.pages {
+			if page.outputName == tt.page {
+				html = page.html
+			}
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(html, want) {
+				t.Errorf("%q not found in %v:\n%v", want, tt.page, html)
+			}
+		}
+	}
+}
+
+func TestSiteLanguage(t *testing.T) {
+	site := newTestSite(t, map[string]string{
+		"a.rite": "---\ntitle: A\nlang: es\n---\n\nTexto.\n",
+		"b.rite": "---\ntitle: B\nlang: es\n---\n\nTexto.\n",
+	})
+	if err := site.Generate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if nav := site.navigation(0); !strings.Contains(nav, `>Índice</a>`) {
+		t.Errorf("up link not translated in %q", nav)
+	}
+
+	tests := []struct {
+		page string
+		want []string
+	}{
+		{siteIndexName, []string{`lang="es"`, `>Buscar</a>`}},
+		{searchPageName, []string{`lang="es"`, `<title>Buscar</title>`, `placeholder="Buscar..."`, `fetch("search.json")`}},
+	}
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join(site.dir, tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%q not found in %v:\n%s", want, tt.page, content)
+			}
+		}
+	}
+}
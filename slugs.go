@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// slugify returns a string which can be used as an id derived from the text, in lowercase and with the
+// characters which are not letters or digits replaced by hyphens. Letters of any language are kept.
+func slugify(text string) string {
+	var sb strings.Builder
+
+	hyphen := false
+	for _, r := range strings.ToLower(plainText(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(r)
+			hyphen = false
+		case unicode.IsMark(r):
+			// Combining accents are part of the previous letter
+			if sb.Len() > 0 && !hyphen {
+				sb.WriteRune(r)
+			}
+		case r == '\'' || r == '’':
+			// Apostrophes do not separate words, like in "user's"
+		default:
+			hyphen = true
+		}
+	}
+
+	return sb.String()
+}
+
+// uniqueSlug returns an id derived from the text which is not used by any other element,
+// adding a counter if needed, like "introduction-1"
+func (doc *Document) uniqueSlug(text string) string {
+	slug := slugify(text)
+	if len(slug) == 0 {
+		slug = "section"
+	}
+
+	id := slug
+	for i := 1; doc.ids[id] > 0; i++ {
+		id = fmt.Sprintf("%v-%v", slug, i)
+	}
+
+	return id
+}
+
+// preprocessAutoID gives an id derived from the title to the heading in the line when it has none, so it can
+// be linked from the table of contents and referenced like '<x-ref introduction>'
+func (doc *Document) preprocessAutoID(lineNum int, tagFields map[string]string) {
+	id := doc.uniqueSlug(tagFields["restLine"])
+
+	line := doc.lines[lineNum]
+	tagName := tagFields["tag"]
+	doc.lines[lineNum] = line[:1+len(tagName)] + " #" + id + line[1+len(tagName):]
+
+	tagFields["id"] = id
+	doc.autoIDs[id] = true
+}
+
+// renameAutoID changes the id which was given automatically to a heading, because the user has given
+// the same id explicitly to another element, which has precedence
+func (doc *Document) renameAutoID(id string) {
+	lineNum := doc.idLines[id]
+
+	newID := doc.uniqueSlug(id)
+
+	line := doc.lines[lineNum]
+	line = strings.Replace(line, " #"+id, " #"+newID, 1)
+	line = strings.Replace(line, `id="`+id+`"`, `id="`+newID+`"`, 1)
+	doc.lines[lineNum] = line
+
+	doc.ids[newID] = doc.ids[id]
+	doc.idLines[newID] = lineNum
+	if n, found := doc.idNumbers[id]; found {
+		doc.idNumbers[newID] = n
+		delete(doc.idNumbers, id)
+	}
+	if label, found := doc.refLabels[id]; found {
+		doc.refLabels[newID] = label
+		delete(doc.refLabels, id)
+	}
+	delete(doc.ids, id)
+	delete(doc.idLines, id)
+	delete(doc.autoIDs, id)
+	doc.autoIDs[newID] = true
+
+	for _, h := range doc.headings {
+		if h.id == id {
+			h.id = newID
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// Snippet is a named block defined once with '<x-snippet #name>' and inserted with '<x-use "name">'
+type Snippet struct {
+	name     string
+	lines    []string // The lines of the block, without the indentation of the block
+	fileName string   // The file where the snippet is defined
+	lineNum  int      // The line of the '<x-snippet>' tag in the file, starting at 1
+}
+
+// The use of a snippet, like '<x-use "legal-disclaimer" party="ACME Corp.">'
+var reSnippetUse = regexp.MustCompile(`^<x-use\s+"?([0-9a-zA-Z-_\.]+)"?(.*?)>?$`)
+
+// The parameters of the use of a snippet, like 'party="ACME Corp."' or 'year=2024'
+var reSnippetParam = regexp.MustCompile(`([0-9a-zA-Z-_\.]+)=(?:"([^"]*)"|(\S+))`)
+
+// defineSnippet registers the snippet defined by the <x-snippet> tag in the line.
+// The content of the snippet are the lines indented more than the tag, which are added later with addLine.
+func (doc *Document) defineSnippet(lineNum int) *Snippet {
+	tagFields := doc.preprocessTagSpec(lineNum)
+
+	name := tagFields["id"]
+	if len(name) == 0 {
+		doc.errorf(lineNum, "snippet", "no name for the snippet, use '<x-snippet #name>'")
+		return nil
+	}
+
+	if prev := doc.snippets[name]; prev != nil {
+		doc.errorf(lineNum, "duplicate-snippet", "snippet '%v' already defined in %v:%v", name, prev.fileName, prev.lineNum)
+		return nil
+	}
+
+	origin := doc.origin(lineNum)
+	snippet := &Snippet{name: name, fileName: origin.fileName, lineNum: origin.lineNum}
+	doc.snippets[name] = snippet
+
+	return snippet
+}
+
+// addLine adds a raw line of the document to the content of the snippet
+func (snippet *Snippet) addLine(rawLine string) {
+	snippet.lines = append(snippet.lines, rawLine)
+}
+
+// content returns the text of the snippet, removing the indentation of its first line from all the lines,
+// and replacing the parameters like '{{party}}' with their values
+func (snippet *Snippet) content(params map[string]string) string {
+	lines := snippet.lines
+
+	// Blank lines at the end separate the snippet from what follows, and are not part of it
+	for len(lines) > 0 && len(strings.TrimSpace(lines[len(lines)-1])) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	indentation := -1
+	for _, line := range lines {
+		if trimmed := strings.TrimLeft(line, " "); len(trimmed) > 0 {
+			indentation = len(line) - len(trimmed)
+			break
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range lines {
+		if len(line) >= indentation && len(strings.TrimLeft(line[:indentation], " ")) == 0 {
+			line = line[indentation:]
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	text := sb.String()
+	for key, value := range params {
+		text = strings.ReplaceAll(text, "{{"+key+"}}", value)
+	}
+
+	return text
+}
+
+// preprocessSnippetUse inserts the content of the snippet referenced by the <x-use> tag in the line,
+// with the same indentation as the tag. The parameters of the tag replace their references in the snippet,
+// like '{{party}}', and the references which are not parameters are replaced as definitions in the YAML header.
+func (doc *Document) preprocessSnippetUse(lineNum int) {
+	m := reSnippetUse.FindStringSubmatch(doc.lines[lineNum])
+	if m == nil {
+		doc.errorf(lineNum, "snippet", "no snippet to use, use '<x-use \"name\">'")
+		return
+	}
+	name := m[1]
+
+	snippet := doc.snippets[name]
+	if snippet == nil {
+		doc.errorf(lineNum, "snippet", "snippet '%v' not defined before its use", name)
+		return
+	}
+
+	// A snippet can use other snippets, but not itself
+	for _, src := range doc.sources {
+		if src.snippet == name {
+			doc.errorf(lineNum, "snippet", "snippet '%v' uses itself", name)
+			return
+		}
+	}
+	if len(doc.sources) > maxIncludeDepth {
+		doc.errorf(lineNum, "snippet", "too many nested includes (more than %v) using '%v'", maxIncludeDepth, name)
+		return
+	}
+
+	params := map[string]string{}
+	for _, p := range reSnippetParam.FindAllStringSubmatch(m[2], -1) {
+		params[p[1]] = p[2] + p[3]
+	}
+
+	doc.log.Debugw("using snippet", "name", name, "line", lineNum+1)
+
+	// The lines of the snippet are reported in the file where it is defined
+	doc.pushSource(&lineSource{
+		scanner:     bufio.NewScanner(strings.NewReader(snippet.content(params))),
+		fileName:    snippet.fileName,
+		indentation: strings.Repeat(" ", doc.indentations[lineNum]),
+		included:    true,
+		snippet:     name,
+		lineNum:     snippet.lineNum,
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// The API of the SpecRef database, with the references of W3C, IETF, WHATWG and other specifications
+const specrefAPI = "https://api.specref.org/bibrefs?refs="
+
+// specrefEntry is an entry of the SpecRef database, which may be an alias of another entry
+type specrefEntry struct {
+	Title     string   `json:"title"`
+	Href      string   `json:"href"`
+	Date      string   `json:"date"`
+	Authors   []string `json:"authors"`
+	Publisher string   `json:"publisher"`
+	Status    string   `json:"status"`
+	AliasOf   string   `json:"aliasOf"`
+}
+
+// lookupSpecref returns the entry of the SpecRef database with the key, or nil if it does not exist.
+// The responses are cached like the other resources downloaded from the network.
+func lookupSpecref(key string) (*BiblioEntry, error) {
+	// Follow the aliases, but not forever
+	for i := 0; i < 5; i++ {
+		content, err := fetchURL(specrefAPI + url.QueryEscape(key))
+		if err != nil {
+			return nil, err
+		}
+
+		entries := map[string]*specrefEntry{}
+		if err := json.Unmarshal(content, &entries); err != nil {
+			return nil, fmt.Errorf("invalid response from SpecRef: %w", err)
+		}
+
+		ref := entries[key]
+		if ref == nil {
+			return nil, nil
+		}
+		if len(ref.AliasOf) > 0 {
+			key = ref.AliasOf
+			continue
+		}
+
+		return &BiblioEntry{title: ref.Title, href: ref.Href, date: ref.Date, authors: ref.Authors,
+			publisher: ref.Publisher, status: ref.Status}, nil
+	}
+
+	return nil, fmt.Errorf("too many aliases in SpecRef for '%v'", key)
+}
+
+// specrefEntry returns the entry with the key from the SpecRef database when it is not in the bibliography,
+// if enabled with 'specref: true' in the YAML header
+func (doc *Document) specrefEntry(lineNum int, key string) *BiblioEntry {
+	if !doc.config.Bool("specref") {
+		return nil
+	}
+
+	entry, err := lookupSpecref(key)
+	if err != nil {
+		doc.warnf(lineNum, "specref", "error looking up '%v' in SpecRef: %v", key, err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+
+	entry.key = key
+	doc.biblio[key] = entry
+	return entry
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The elements of an SVG image which are kept when it is sanitized. The rest, like <script>, <foreignObject>
+// or any HTML element, are removed with all their content.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "title": true, "desc": true, "switch": true,
+	"a": true, "view": true, "style": true, "image": true, "marker": true, "pattern": true, "clipPath": true, "mask": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true,
+	"linearGradient": true, "radialGradient": true, "stop": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feConvolveMatrix": true, "feDiffuseLighting": true, "feDisplacementMap": true, "feDistantLight": true,
+	"feDropShadow": true, "feFlood": true, "feFuncA": true, "feFuncB": true, "feFuncG": true, "feFuncR": true,
+	"feGaussianBlur": true, "feImage": true, "feMerge": true, "feMergeNode": true, "feMorphology": true,
+	"feOffset": true, "fePointLight": true, "feSpecularLighting": true, "feSpotLight": true, "feTile": true, "feTurbulence": true,
+	"animate": true, "animateMotion": true, "animateTransform": true, "set": true, "mpath": true,
+}
+
+// The attributes of the elements of an SVG image which are kept when it is sanitized, besides the 'aria-*'
+// and 'data-*' ones. The event handlers, like 'onload', are never kept.
+var svgAttributes = map[string]bool{
+	// Core and structure
+	"id": true, "class": true, "style": true, "lang": true, "tabindex": true, "role": true, "focusable": true,
+	"xmlns": true, "xmlns:xlink": true, "xmlns:svg": true, "xml:space": true, "xml:lang": true, "version": true,
+	"baseProfile": true, "viewBox": true, "preserveAspectRatio": true, "systemLanguage": true,
+	"href": true, "xlink:href": true, "xlink:title": true,
+	// Geometry
+	"x": true, "y": true, "width": true, "height": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "fx": true, "fy": true, "fr": true,
+	"d": true, "points": true, "pathLength": true, "transform": true,
+	// Presentation
+	"fill": true, "fill-opacity": true, "fill-rule": true, "stroke": true, "stroke-width": true, "stroke-opacity": true,
+	"stroke-linecap": true, "stroke-linejoin": true, "stroke-miterlimit": true, "stroke-dasharray": true,
+	"stroke-dashoffset": true, "opacity": true, "color": true, "display": true, "visibility": true, "overflow": true,
+	"clip-path": true, "clip-rule": true, "mask": true, "filter": true, "marker-start": true, "marker-mid": true,
+	"marker-end": true, "font-family": true, "font-size": true, "font-weight": true, "font-style": true,
+	"font-variant": true, "font-stretch": true, "text-anchor": true, "dominant-baseline": true,
+	"alignment-baseline": true, "baseline-shift": true, "letter-spacing": true, "word-spacing": true,
+	"text-decoration": true, "writing-mode": true, "direction": true, "unicode-bidi": true, "stop-color": true,
+	"stop-opacity": true, "flood-color": true, "flood-opacity": true, "lighting-color": true,
+	"color-interpolation": true, "color-interpolation-filters": true, "shape-rendering": true,
+	"text-rendering": true, "image-rendering": true, "vector-effect": true, "paint-order": true,
+	"pointer-events": true, "mix-blend-mode": true, "isolation": true,
+	// Text
+	"dx": true, "dy": true, "rotate": true, "textLength": true, "lengthAdjust": true, "startOffset": true,
+	"method": true, "spacing": true, "side": true,
+	// Gradients, patterns, markers, clipping and masking
+	"gradientUnits": true, "gradientTransform": true, "spreadMethod": true, "offset": true, "patternUnits": true,
+	"patternContentUnits": true, "patternTransform": true, "markerUnits": true, "markerWidth": true,
+	"markerHeight": true, "refX": true, "refY": true, "orient": true, "clipPathUnits": true, "maskUnits": true,
+	"maskContentUnits": true, "filterUnits": true, "primitiveUnits": true,
+	// Filters
+	"in": true, "in2": true, "result": true, "stdDeviation": true, "mode": true, "operator": true,
+	"k1": true, "k2": true, "k3": true, "k4": true, "values": true, "type": true, "tableValues": true,
+	"slope": true, "intercept": true, "amplitude": true, "exponent": true, "edgeMode": true, "kernelMatrix": true,
+	"order": true, "divisor": true, "bias": true, "targetX": true, "targetY": true, "preserveAlpha": true,
+	"scale": true, "xChannelSelector": true, "yChannelSelector": true, "radius": true, "baseFrequency": true,
+	"numOctaves": true, "seed": true, "stitchTiles": true, "surfaceScale": true, "diffuseConstant": true,
+	"specularConstant": true, "specularExponent": true, "kernelUnitLength": true, "azimuth": true,
+	"elevation": true, "z": true, "pointsAtX": true, "pointsAtY": true, "pointsAtZ": true, "limitingConeAngle": true,
+	// Animations
+	"attributeName": true, "attributeType": true, "begin": true, "dur": true, "end": true, "min": true, "max": true,
+	"restart": true, "repeatCount": true, "repeatDur": true, "calcMode": true, "keyTimes": true, "keySplines": true,
+	"from": true, "to": true, "by": true, "additive": true, "accumulate": true, "path": true, "keyPoints": true,
+}
+
+// The references to other sites in the styles of an SVG image, which are replaced so the image does not load them
+var (
+	reSVGURL    = regexp.MustCompile(`(?i)url\(\s*['"]?\s*(https?:|//|javascript:)[^)]*\)`)
+	reSVGImport = regexp.MustCompile(`(?i)@import[^;]*;`)
+)
+
+// isSVG returns true if the resource, named like the path of the URL, is an SVG image
+func isSVG(name string, content []byte) bool {
+	head := content
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return path.Ext(name) == ".svg" || bytes.Contains(head, []byte("<svg"))
+}
+
+// sanitizeSVG rewrites an SVG image with only the elements and attributes which can not run code or load
+// resources from other sites, so the image is safe to host with the document even if it is opened directly.
+// The scripts, the HTML embedded with <foreignObject>, the event handlers, the references to other documents
+// and the animations which set event handlers or references are removed. The references to elements of the
+// image itself, like '#arrow', and to embedded images are kept.
+// The image is parsed as XML, so an image which is not well-formed is rejected.
+func sanitizeSVG(content []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	var out bytes.Buffer
+
+	// The number of elements open inside an element being removed, which are removed with it
+	skipping := 0
+
+	// The names of the open elements, to know when the content is a style sheet
+	open := []string{}
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG image: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skipping > 0 {
+				skipping++
+				continue
+			}
+			name := svgName(t.Name)
+			if !svgElements[name] || unsafeSVGAnimation(name, t.Attr) {
+				skipping = 1
+				continue
+			}
+			open = append(open, name)
+
+			out.WriteString("<" + name)
+			for _, attr := range t.Attr {
+				value, safe := sanitizeSVGAttr(svgName(attr.Name), attr.Value)
+				if !safe {
+					continue
+				}
+				out.WriteString(" " + svgName(attr.Name) + "=\"")
+				xml.EscapeText(&out, []byte(value))
+				out.WriteString("\"")
+			}
+			out.WriteString(">")
+
+		case xml.EndElement:
+			if skipping > 0 {
+				skipping--
+				continue
+			}
+			if len(open) == 0 {
+				return nil, fmt.Errorf("invalid SVG image: unexpected </%v>", svgName(t.Name))
+			}
+			out.WriteString("</" + open[len(open)-1] + ">")
+			open = open[:len(open)-1]
+
+		case xml.CharData:
+			if skipping > 0 {
+				continue
+			}
+			text := []byte(t)
+			if len(open) > 0 && open[len(open)-1] == "style" {
+				text = reSVGURL.ReplaceAll(text, []byte("none"))
+				text = reSVGImport.ReplaceAll(text, nil)
+			}
+			xml.EscapeText(&out, text)
+
+		case xml.ProcInst:
+			// Only the XML declaration is kept, and the comments and the document type are removed,
+			// because the declarations of entities in the document type can be expanded without limit
+			if t.Target == "xml" && out.Len() == 0 {
+				out.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		}
+	}
+
+	// The elements not closed, which the parser accepts in non-strict mode, are closed now
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+
+	return out.Bytes(), nil
+}
+
+// svgName returns the name of an element or attribute as written, with its prefix like in 'xlink:href'
+func svgName(name xml.Name) string {
+	if len(name.Space) > 0 {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// unsafeSVGAnimation returns true if the element is an animation which changes an event handler or a reference
+// to another document, like '<set attributeName="onmouseover" to="alert(1)"/>'
+func unsafeSVGAnimation(name string, attrs []xml.Attr) bool {
+	if name != "set" && !strings.HasPrefix(name, "animate") {
+		return false
+	}
+	for _, attr := range attrs {
+		if svgName(attr.Name) != "attributeName" {
+			continue
+		}
+		target := strings.ToLower(strings.TrimSpace(attr.Value))
+		if strings.HasPrefix(target, "on") || target == "href" || strings.HasSuffix(target, ":href") {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeSVGAttr returns the value of an attribute of an SVG element without the references to other sites,
+// and false if the attribute is not safe and has to be removed
+func sanitizeSVGAttr(name string, value string) (string, bool) {
+	if !svgAttributes[name] && !strings.HasPrefix(name, "aria-") && !strings.HasPrefix(name, "data-") {
+		return "", false
+	}
+
+	// The browsers ignore the blank space and control characters in the scheme, like in 'java\tscript:'
+	compact := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, value))
+	if strings.Contains(compact, "javascript:") || strings.Contains(compact, "vbscript:") {
+		return "", false
+	}
+
+	if name == "href" || strings.HasSuffix(name, ":href") {
+		return value, strings.HasPrefix(compact, "#") || strings.HasPrefix(compact, "data:image/")
+	}
+
+	value = reSVGURL.ReplaceAllString(value, "none")
+	if name == "style" {
+		value = reSVGImport.ReplaceAllString(value, "")
+	}
+	return value, true
+}
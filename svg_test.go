@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		svg     string
+		want    []string
+		removed []string
+	}{
+		{
+			"script",
+			`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script><rect width="10" height="10"/></svg>`,
+			[]string{`<rect width="10" height="10">`},
+			[]string{"script", "alert"},
+		},
+		{
+			"script in CDATA",
+			`<svg><script><![CDATA[alert(1)]]></script><circle r="1"/></svg>`,
+			[]string{`<circle r="1">`},
+			[]string{"script", "alert"},
+		},
+		{
+			"foreignObject",
+			`<svg><foreignObject><iframe src="https://example.com"></iframe><body onload="alert(2)"/></foreignObject></svg>`,
+			nil,
+			[]string{"foreignObject", "iframe", "onload", "alert"},
+		},
+		{
+			"event handlers",
+			`<svg onload="alert(1)"><g ONCLICK="alert(2)"><path d="M0 0" onmouseover='alert(3)'/></g></svg>`,
+			[]string{`<path d="M0 0">`},
+			[]string{"alert", "on"},
+		},
+		{
+			"set of an event handler",
+			`<svg><rect width="1"><set attributeName="onmouseover" to="alert(3)"/></rect></svg>`,
+			[]string{`<rect width="1">`},
+			[]string{"<set", "alert"},
+		},
+		{
+			"animation of a reference",
+			`<svg><a><animate attributeName="href" values="javascript:alert(4)"/><text>Click</text></a></svg>`,
+			[]string{"<text>Click</text>"},
+			[]string{"<animate", "javascript"},
+		},
+		{
+			"animation of an xlink reference",
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a><animate attributeName="xlink:href" to="javascript:alert(5)"/></a></svg>`,
+			nil,
+			[]string{"<animate", "javascript"},
+		},
+		{
+			"harmless animation",
+			`<svg><circle r="1"><animate attributeName="r" from="1" to="5" dur="1s"/></circle></svg>`,
+			[]string{`<animate attributeName="r" from="1" to="5" dur="1s"></animate>`},
+			nil,
+		},
+		{
+			"javascript references",
+			`<svg><a href="javascript:alert(6)"><text>x</text></a><a xlink:href=" java&#9;script:alert(7)"><text>y</text></a></svg>`,
+			[]string{"<text>x</text>", "<text>y</text>"},
+			[]string{"javascript", "alert"},
+		},
+		{
+			"references to other sites",
+			`<svg><use href="https://example.com/sprite.svg#icon"/><image xlink:href="//example.com/a.png"/></svg>`,
+			[]string{"<use>", "<image>"},
+			[]string{"example.com"},
+		},
+		{
+			"references kept",
+			`<svg><use href="#arrow"/><image xlink:href="data:image/png;base64,AAAA"/></svg>`,
+			[]string{`<use href="#arrow">`, `<image xlink:href="data:image/png;base64,AAAA">`},
+			nil,
+		},
+		{
+			"styles loading other sites",
+			`<svg><style>@import url(https://example.com/a.css); rect { fill: url(https://example.com/f.svg#p) }</style><rect style="fill: url('https://example.com/g')"/></svg>`,
+			[]string{"fill: none"},
+			[]string{"example.com", "@import"},
+		},
+		{
+			"HTML elements",
+			`<svg><iframe src="https://example.com"/><embed src="a.swf"/><rect/></svg>`,
+			[]string{"<rect>"},
+			[]string{"iframe", "embed"},
+		},
+		{
+			"document type with entities",
+			`<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY x "alert(8)">]><!-- comment --><svg><text>&amp; text</text></svg>`,
+			[]string{`<?xml version="1.0"?><svg><text>&amp; text</text></svg>`},
+			[]string{"DOCTYPE", "ENTITY", "comment"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := sanitizeSVG([]byte(tt.svg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(out)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("%q not found in %q", want, got)
+				}
+			}
+			for _, removed := range tt.removed {
+				if strings.Contains(strings.ToLower(got), strings.ToLower(removed)) {
+					t.Errorf("%q not removed from %q", removed, got)
+				}
+			}
+
+			// The result is well-formed
+			d := xml.NewDecoder(bytes.NewReader(out))
+			for {
+				_, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("the result %q is not well-formed: %v", got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeInvalidSVG(t *testing.T) {
+	tests := []string{
+		`<svg><rect width="1></svg>`,
+		// A script split by another one, which a sanitizer removing the scripts by pattern joins again
+		`<svg><scr<script>x</script>ipt>alert(1)</script><rect width="1"/></svg>`,
+		`<svg></g></svg>`,
+	}
+	for _, svg := range tests {
+		if out, err := sanitizeSVG([]byte(svg)); err == nil {
+			t.Errorf("no error for the invalid image %q, got %q", svg, out)
+		}
+	}
+}
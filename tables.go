@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The word used in the captions of the tables and in the references to them, translated with localize
+const tableLabel = "Table"
+
+// preprocessTable converts an <x-table> tag into a <table> with a numbered caption,
+// taking the text of the caption from the rest of the line, like in '<x-table #growth>Growth by year'.
+// The rows of the table are in the indented block after the tag.
+func (doc *Document) preprocessTable(lineNum int, tagFields map[string]string) {
+	line := doc.lines[lineNum]
+	restLine := tagFields["restLine"]
+
+	label := fmt.Sprintf("%v %v", doc.localize(tableLabel), doc.elementNumber(lineNum, tagFields))
+	if id := tagFields["id"]; len(id) > 0 && doc.idLines[id] == lineNum {
+		doc.refLabels[id] = label
+	}
+
+	// Replace the name of the tag, keeping its attributes and making sure the tag is closed
+	tagSpec := strings.TrimSuffix(line, restLine)
+	tagSpec = tagSpec[:1] + "table" + strings.TrimPrefix(tagSpec[1:], "x-table")
+	closing := string(endTagFor[rune(tagSpec[0])])
+	if !strings.HasSuffix(tagSpec, closing) {
+		tagSpec = tagSpec + closing
+	}
+
+	caption := label
+	text := strings.TrimSpace(restLine)
+	if len(text) > 0 {
+		caption = fmt.Sprintf("%v. %v", label, text)
+	}
+	doc.addCaption(lineNum, tableLabel, label, text, tagFields)
+
+	doc.lines[lineNum] = fmt.Sprintf("%v<caption>%v</caption>", tagSpec, caption)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableRows(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		rows int
+	}{
+		{"rows in one line", "<x-table #data>Data\n    <tr><td>1</td></tr>\n    <tr><td>2</td></tr>\n", 2},
+		{"rows separated by blank lines", "<x-table #data>Data\n    <tr><th>N</th></tr>\n\n    <tr><td>1</td></tr>\n", 2},
+		{"row with the cells indented", "<x-table #data>Data\n    <tr>\n        <td>1\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument("# Title\n\nSee <x-ref data>.\n\n" + tt.src)
+			html := doc.ToHTML()
+			assertNoErrors(t, doc)
+
+			doc.checkHTML(html)
+			assertNoErrors(t, doc)
+			if got := strings.Count(html, "</tr>"); got != tt.rows {
+				t.Errorf("got %v end tags of rows, want %v in:\n%v", got, tt.rows, html)
+			}
+		})
+	}
+}
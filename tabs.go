@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The script to switch between the tabs, included in the template only if the document has tabs.
+// The tabs can be selected with the mouse or with the arrow keys, as recommended by WAI-ARIA.
+const tabsScript = `<script>
+document.querySelectorAll(".tabs").forEach(function (tabs) {
+  var buttons = Array.from(tabs.querySelectorAll(":scope > [role=tablist] > [role=tab]"));
+  function select(button) {
+    buttons.forEach(function (b) {
+      var selected = b === button;
+      b.setAttribute("aria-selected", selected);
+      b.tabIndex = selected ? 0 : -1;
+      document.getElementById(b.getAttribute("aria-controls")).hidden = !selected;
+    });
+  }
+  buttons.forEach(function (b, i) {
+    b.addEventListener("click", function () { select(b); });
+    b.addEventListener("keydown", function (e) {
+      var next = {ArrowRight: i + 1, ArrowLeft: i - 1, Home: 0, End: buttons.length - 1}[e.key];
+      if (next === undefined) return;
+      next = buttons[(next + buttons.length) % buttons.length];
+      select(next);
+      next.focus();
+      e.preventDefault();
+    });
+  });
+});
+</script>
+`
+
+// TabGroup is a group of tabs, where only one of them is shown at a time, written with <x-tabs>.
+// Each tab is an <x-tab> tag in the indented block, with its name in the rest of the line, like
+//
+//	<x-tabs>
+//	    <x-tab>curl
+//	        <pre>
+//	            curl https://example.com
+//	    <x-tab>Go
+//	        <pre>
+//	            http.Get("https://example.com")
+type TabGroup struct {
+	indentation int
+	buttons     []string // The buttons to select the tabs, written when all the tabs are known
+}
+
+// tabListPlaceholder returns the placeholder of the buttons of a group of tabs, which is replaced when
+// the whole document has been processed
+func tabListPlaceholder(group int) string {
+	return fmt.Sprintf("{#tablist-%v}", group)
+}
+
+// preprocessTabs converts an <x-tabs> tag into a group of tabs, keeping the id, class and other attributes of the tag
+func (doc *Document) preprocessTabs(lineNum int, tagFields map[string]string) {
+	doc.tabGroups = append(doc.tabGroups, &TabGroup{indentation: doc.indentations[lineNum]})
+	doc.hasTabs = true
+
+	class := "tabs"
+	if c := tagFields["class"]; len(c) > 0 {
+		class = class + " " + c
+	}
+	group := fmt.Sprintf("<div class=\"%v\"", class)
+	if id := tagFields["id"]; len(id) > 0 {
+		group = group + " #" + id
+	}
+	if stdFields := tagFields["stdFields"]; len(stdFields) > 0 {
+		group = group + " " + stdFields
+	}
+
+	doc.lines[lineNum] = fmt.Sprintf("%v><div role=\"tablist\">%v</div>", group, tabListPlaceholder(len(doc.tabGroups)-1))
+}
+
+// preprocessTabID gives an id to a tab without one, so the button of the tab can select it
+func (doc *Document) preprocessTabID(lineNum int, tagFields map[string]string) {
+	id := doc.uniqueSlug("tab " + plainText(tagFields["restLine"]))
+
+	line := doc.lines[lineNum]
+	doc.lines[lineNum] = line[:len("<x-tab")] + " #" + id + line[len("<x-tab"):]
+
+	tagFields["id"] = id
+	doc.autoIDs[id] = true
+}
+
+// preprocessTab converts an <x-tab> tag into the panel of the tab in its group, and adds the button to select it.
+// The first tab of the group is the one shown by default.
+func (doc *Document) preprocessTab(lineNum int, tagFields map[string]string) {
+	var group *TabGroup
+	for i := len(doc.tabGroups) - 1; i >= 0; i-- {
+		if doc.tabGroups[i].indentation < doc.indentations[lineNum] {
+			group = doc.tabGroups[i]
+			break
+		}
+	}
+	if group == nil {
+		doc.errorf(lineNum, "tabs", "<x-tab> must be in the indented block of <x-tabs>")
+		return
+	}
+
+	id := tagFields["id"]
+	selected := len(group.buttons) == 0
+	tabIndex := "-1"
+	if selected {
+		tabIndex = "0"
+	}
+	group.buttons = append(group.buttons, fmt.Sprintf("<button role=\"tab\" id=\"%v-tab\" aria-controls=\"%v\" aria-selected=\"%v\" tabindex=\"%v\">%v</button>",
+		id, id, selected, tabIndex, strings.TrimSpace(tagFields["restLine"])))
+
+	panel := fmt.Sprintf("<div #%v role=\"tabpanel\" aria-labelledby=\"%v-tab\"", id, id)
+	if class := tagFields["class"]; len(class) > 0 {
+		panel = panel + " ." + class
+	}
+	if stdFields := tagFields["stdFields"]; len(stdFields) > 0 {
+		panel = panel + " " + stdFields
+	}
+	if !selected {
+		panel = panel + " hidden"
+	}
+	doc.lines[lineNum] = panel + ">"
+}
+
+// tabListPairs returns the pairs of placeholders and buttons of the groups of tabs, to be replaced in the document
+func (doc *Document) tabListPairs() []string {
+	pairs := []string{}
+	for i, group := range doc.tabGroups {
+		pairs = append(pairs, tabListPlaceholder(i), strings.Join(group.buttons, ""))
+	}
+	return pairs
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The width of the lines of the plain text output, which fits in the messages of email-based reviews
+const textWidth = 72
+
+// ToText returns the document as plain text, with the paragraphs wrapped and the numbers of the sections,
+// which can be pasted in an email for a review or compared with 'git diff' between versions. The document is
+// converted from the generated HTML, so it has the numbers of the sections and the cross references solved.
+// The links to other sites are written after their text, like in 'the spec <https://example.com/spec>'.
+func (doc *Document) ToText(generated string) string {
+	lines := []string{doc.Title(), strings.Repeat("=", utf8.RuneCountInString(doc.Title())), ""}
+	lines = append(lines, textBlocks(parseHTML(doc.articleContent(generated)).children, textWidth)...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// textBlocks converts a list of nodes to the lines of text of their blocks, separated by blank lines.
+// The texts and inline elements between blocks are written as a paragraph.
+func textBlocks(nodes []*htmlNode, width int) []string {
+	lines := []string{}
+	inlines := []*htmlNode{}
+
+	add := func(block []string) {
+		if len(block) == 0 {
+			return
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, block...)
+	}
+	flush := func() {
+		add(wrapText(textInlines(inlines), width))
+		inlines = nil
+	}
+
+	for _, n := range nodes {
+		if len(n.name) == 0 || !isPandocBlock(n) {
+			inlines = append(inlines, n)
+			continue
+		}
+		flush()
+		add(textBlock(n, width))
+	}
+	flush()
+
+	return lines
+}
+
+// textBlock converts an element to the lines of text of its blocks
+func textBlock(n *htmlNode, width int) []string {
+	switch {
+	case n.name == "script" || n.name == "style":
+		return nil
+
+	case len(n.name) == 2 && n.name[0] == 'h' && n.name[1] >= '1' && n.name[1] <= '6':
+		lines := wrapText(textInlines(n.children), width)
+		// The headings of the first levels are underlined, like in Markdown and reStructuredText
+		underline := map[string]string{"h1": "=", "h2": "-"}[n.name]
+		if len(underline) > 0 && len(lines) > 0 {
+			longest := 0
+			for _, line := range lines {
+				if l := utf8.RuneCountInString(line); l > longest {
+					longest = l
+				}
+			}
+			lines = append(lines, strings.Repeat(underline, longest))
+		}
+		return lines
+
+	case n.name == "p":
+		return wrapText(textInlines(n.children), width)
+
+	case n.name == "hr":
+		return []string{strings.Repeat("-", width)}
+
+	case n.name == "pre":
+		lines := []string{}
+		for _, line := range strings.Split(strings.TrimRight(n.textContent(), "\n "), "\n") {
+			lines = append(lines, strings.TrimRight("    "+line, " "))
+		}
+		return lines
+
+	case n.name == "blockquote":
+		return prefixLines(textBlocks(n.children, width-2), "> ", "> ")
+
+	case n.name == "ul" || n.name == "ol":
+		lines := []string{}
+		number := 1
+		for _, c := range n.children {
+			if c.name != "li" {
+				continue
+			}
+			marker := "*"
+			if n.name == "ol" {
+				marker = fmt.Sprintf("%v.", number)
+				number++
+			}
+			marker = marker + strings.Repeat(" ", 4-len(marker)%4)
+			item := textBlocks(c.children, width-len(marker))
+			lines = append(lines, prefixLines(item, marker, strings.Repeat(" ", len(marker)))...)
+		}
+		return lines
+
+	case n.name == "dl":
+		lines := []string{}
+		for _, c := range n.children {
+			switch c.name {
+			case "dt":
+				if len(lines) > 0 {
+					lines = append(lines, "")
+				}
+				lines = append(lines, wrapText(textInlines(c.children), width)...)
+			case "dd":
+				lines = append(lines, prefixLines(textBlocks(c.children, width-4), "    ", "    ")...)
+			}
+		}
+		return lines
+
+	case n.name == "table":
+		return textTable(n, width)
+
+	case n.name == "figure":
+		content, caption := []*htmlNode{}, []*htmlNode{}
+		for _, c := range n.children {
+			if c.name == "figcaption" {
+				caption = c.children
+			} else {
+				content = append(content, c)
+			}
+		}
+		lines := textBlocks(content, width)
+		if captionLines := wrapText(textInlines(caption), width); len(captionLines) > 0 {
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, captionLines...)
+		}
+		return lines
+
+	case n.name == "div" && n.hasClass("math"):
+		return prefixLines(strings.Split(strings.TrimSpace(n.textContent()), "\n"), "    ", "    ")
+	}
+
+	// The rest of blocks, like sections, are written as their content
+	return textBlocks(n.children, width)
+}
+
+// textTable converts a table to one line per row with the cells separated by '|', and the header rows underlined
+func textTable(n *htmlNode, width int) []string {
+	lines := []string{}
+
+	var rows func(nodes []*htmlNode)
+	rows = func(nodes []*htmlNode) {
+		for _, c := range nodes {
+			switch c.name {
+			case "thead", "tbody", "tfoot":
+				rows(c.children)
+			case "caption":
+				lines = append(lines, wrapText(textInlines(c.children), width)...)
+			case "tr":
+				cells := []string{}
+				header := true
+				for _, cell := range c.children {
+					if cell.name == "td" || cell.name == "th" {
+						cells = append(cells, strings.Join(wrapText(textInlines(cell.children), width), " "))
+						header = header && cell.name == "th"
+					}
+				}
+				row := strings.Join(cells, " | ")
+				lines = append(lines, row)
+				if header && len(cells) > 0 {
+					lines = append(lines, strings.Repeat("-", utf8.RuneCountInString(row)))
+				}
+			}
+		}
+	}
+	rows(n.children)
+
+	return lines
+}
+
+// textInlines returns the text of a list of nodes, with the line breaks of <br> elements as new lines
+func textInlines(nodes []*htmlNode) string {
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(textInline(n))
+	}
+	return sb.String()
+}
+
+// textInline returns the text of a text or an inline element
+func textInline(n *htmlNode) string {
+	if len(n.name) == 0 {
+		return n.text
+	}
+
+	switch n.name {
+	case "br":
+		return "\n"
+	case "img":
+		if alt := strings.TrimSpace(n.attrs["alt"]); len(alt) > 0 {
+			return "[" + alt + "]"
+		}
+		return ""
+	case "input", "wbr", "script", "style":
+		return ""
+	case "a":
+		text := textInlines(n.children)
+		href := n.attrs["href"]
+		if isURL(href) && strings.TrimSpace(text) != href {
+			return text + " <" + href + ">"
+		}
+		return text
+	case "span":
+		// The numbers of the sections are separated from the title
+		if n.hasClass("secno") {
+			return textInlines(n.children) + " "
+		}
+	}
+
+	return textInlines(n.children)
+}
+
+// wrapText returns the lines of the text wrapped to the width, keeping the new lines of the <br> elements
+func wrapText(text string, width int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			switch {
+			case len(line) == 0:
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width:
+				lines = append(lines, line)
+				line = word
+			default:
+				line = line + " " + word
+			}
+		}
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// prefixLines returns the lines with the first prefix in the first line and the other prefix in the rest,
+// except in the blank lines
+func prefixLines(lines []string, first string, other string) []string {
+	result := []string{}
+	for i, line := range lines {
+		prefix := other
+		if i == 0 {
+			prefix = first
+		}
+		if len(line) == 0 {
+			result = append(result, strings.TrimRight(prefix, " "))
+			continue
+		}
+		result = append(result, prefix+line)
+	}
+	return result
+}
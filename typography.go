@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The elements whose text is not changed by the smart typography, like code and math
+var noTypographyElements = []string{"pre", "code", "kbd", "samp", "script", "style", "textarea"}
+
+// smartTypography converts in the text of the HTML straight quotes to curly quotes, '--' and '---' to
+// en and em dashes, and '...' to an ellipsis.
+// The tags and attributes are not changed, and neither the text inside code, verbatim or math elements.
+func smartTypography(htmlText string) string {
+	var sb strings.Builder
+
+	// The element we are inside and whose text must not be changed, and how many of them are nested
+	skipTag := ""
+	skipDepth := 0
+
+	// The character before the current one in the text, to decide if a quote opens or closes
+	var previous rune = ' '
+
+	for len(htmlText) > 0 {
+
+		// Copy the tags as they are, checking if they start or end an element which must not be changed
+		if htmlText[0] == '<' {
+			end := strings.IndexByte(htmlText, '>')
+			if end < 0 {
+				end = len(htmlText) - 1
+			}
+			tag := htmlText[:end+1]
+			htmlText = htmlText[end+1:]
+			sb.WriteString(tag)
+
+			name, closing := htmlTagName(tag)
+			switch {
+			case skipDepth == 0 && !closing && (contains(noTypographyElements, name) || strings.Contains(tag, `class="math`)):
+				skipTag = name
+				skipDepth = 1
+			case skipDepth > 0 && name == skipTag && !closing:
+				skipDepth++
+			case skipDepth > 0 && name == skipTag && closing:
+				skipDepth--
+			}
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(htmlText)
+
+		if skipDepth > 0 {
+			sb.WriteString(htmlText[:size])
+			htmlText = htmlText[size:]
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(htmlText, "---"):
+			sb.WriteString("—")
+			htmlText = htmlText[3:]
+			previous = '-'
+			continue
+		case strings.HasPrefix(htmlText, "--"):
+			sb.WriteString("–")
+			htmlText = htmlText[2:]
+			previous = '-'
+			continue
+		case strings.HasPrefix(htmlText, "..."):
+			sb.WriteString("…")
+			htmlText = htmlText[3:]
+			previous = '.'
+			continue
+		case r == '"':
+			if opensQuote(previous) {
+				sb.WriteString("“")
+			} else {
+				sb.WriteString("”")
+			}
+		case r == '\'':
+			if opensQuote(previous) {
+				sb.WriteString("‘")
+			} else {
+				// A closing quote or an apostrophe
+				sb.WriteString("’")
+			}
+		default:
+			sb.WriteString(htmlText[:size])
+		}
+
+		previous = r
+		htmlText = htmlText[size:]
+	}
+
+	return sb.String()
+}
+
+// opensQuote returns true if a quote after the given character is an opening quote
+func opensQuote(previous rune) bool {
+	return unicode.IsSpace(previous) || strings.ContainsRune("([{-–—", previous)
+}
+
+// htmlTagName returns the name of the element of an HTML tag, in lowercase, and if it is an end tag
+func htmlTagName(tag string) (name string, closing bool) {
+	tag = strings.TrimPrefix(tag, "<")
+	if strings.HasPrefix(tag, "/") {
+		closing = true
+		tag = tag[1:]
+	}
+	end := strings.IndexFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '>' || r == '/'
+	})
+	if end < 0 {
+		end = len(tag)
+	}
+	return strings.ToLower(tag[:end]), closing
+}
+
+// mapText replaces the text of the HTML, in the order it appears, with the result of the function.
+// The tags are not changed, and neither the text inside the skipped elements or math.
+func mapText(htmlText string, skipElements []string, mapping func(text string) string) string {
+	var sb strings.Builder
+
+	// The element we are inside and whose text must not be changed, and how many of them are nested
+	skipTag := ""
+	skipDepth := 0
+
+	for len(htmlText) > 0 {
+
+		// Copy the tags as they are, checking if they start or end an element which must not be changed
+		if htmlText[0] == '<' {
+			end := strings.IndexByte(htmlText, '>')
+			if end < 0 {
+				end = len(htmlText) - 1
+			}
+			tag := htmlText[:end+1]
+			htmlText = htmlText[end+1:]
+			sb.WriteString(tag)
+
+			name, closing := htmlTagName(tag)
+			switch {
+			case skipDepth == 0 && !closing && (contains(skipElements, name) || strings.Contains(tag, `class="math`)):
+				skipTag = name
+				skipDepth = 1
+			case skipDepth > 0 && name == skipTag && !closing:
+				skipDepth++
+			case skipDepth > 0 && name == skipTag && closing:
+				skipDepth--
+			}
+			continue
+		}
+
+		end := strings.IndexByte(htmlText, '<')
+		if end < 0 {
+			end = len(htmlText)
+		}
+		text := htmlText[:end]
+		htmlText = htmlText[end:]
+
+		if skipDepth > 0 {
+			sb.WriteString(text)
+		} else {
+			sb.WriteString(mapping(text))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validateHTML is true when the structure of the generated HTML is checked, reporting the problems
+// in the lines of the source when the elements have the 'data-rite-line' attribute
+var validateHTML bool
+
+// The elements whose end tag can be omitted
+var optionalEndElements = []string{
+	"html", "head", "body", "p", "li", "dt", "dd", "rt", "rp", "optgroup", "option",
+	"colgroup", "caption", "thead", "tbody", "tfoot", "tr", "td", "th",
+}
+
+// The attributes of a start tag checked by the validation
+var (
+	reIDAttr   = regexp.MustCompile(`\sid\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	reLineAttr = regexp.MustCompile(`\sdata-rite-line="([0-9]+)"`)
+)
+
+// openElement is an element whose end tag has not been found yet, with the line of the source which generated it
+type openElement struct {
+	name    string
+	lineNum int
+}
+
+// checkHTML checks the structure of the generated HTML: the elements which are not closed, the end tags
+// without start tag, the list items outside a list and the ids used more than once. The problems are reported
+// in the line of the source of the element, or of the nearest enclosing element, when it is known.
+func (doc *Document) checkHTML(html string) {
+	stack := []openElement{}
+	ids := map[string]bool{}
+
+	// The line of the last element with a line of the source, for the elements outside of those
+	lastLine := -1
+
+	// currentLine returns the line of the innermost open element which has one,
+	// or otherwise the last line of the source found, which is -1 before the first one
+	currentLine := func() int {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].lineNum >= 0 {
+				return stack[i].lineNum
+			}
+		}
+		return lastLine
+	}
+
+	for len(html) > 0 {
+		token := reHTMLToken.FindString(html)
+		html = html[len(token):]
+
+		m := reTagName.FindStringSubmatch(token)
+		if m == nil || strings.HasPrefix(token, "<!") {
+			continue
+		}
+		name := strings.ToLower(m[1])
+
+		// End tags close the elements opened after the element
+		if strings.HasPrefix(token, "</") {
+			found := -1
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == name {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				if !contains(optionalEndElements, name) {
+					doc.warnf(currentLine(), "html", "end tag </%v> without start tag", name)
+				}
+				continue
+			}
+			for _, e := range stack[found+1:] {
+				if !contains(optionalEndElements, e.name) {
+					doc.warnf(e.lineNum, "html", "<%v> is not closed before </%v>", e.name, name)
+				}
+			}
+			stack = stack[:found]
+			continue
+		}
+
+		lineNum := currentLine()
+		if lm := reLineAttr.FindStringSubmatch(token); lm != nil {
+			riteLine, _ := strconv.Atoi(lm[1])
+			lineNum = doc.sourceLineNum(riteLine)
+			lastLine = lineNum
+		}
+
+		if im := reIDAttr.FindStringSubmatch(token); im != nil {
+			id := im[1] + im[2] + im[3]
+			if ids[id] {
+				doc.warnf(lineNum, "duplicate-id", "id '%v' used more than once in the generated HTML", id)
+			}
+			ids[id] = true
+		}
+
+		if name == "li" && !hasOpenList(stack) {
+			doc.warnf(lineNum, "html", "<li> outside of a list")
+		}
+
+		// The content of scripts and styles is not HTML
+		if name == "script" || name == "style" {
+			if end := strings.Index(strings.ToLower(html), "</"+name); end >= 0 {
+				html = html[end:]
+			}
+		}
+
+		if !contains(voidElements, name) && name != "param" && !strings.HasSuffix(token, "/>") {
+			stack = append(stack, openElement{name: name, lineNum: lineNum})
+		}
+	}
+
+	for _, e := range stack {
+		if !contains(optionalEndElements, e.name) {
+			doc.warnf(e.lineNum, "html", "<%v> is not closed", e.name)
+		}
+	}
+}
+
+// hasOpenList returns true if there is a list among the open elements
+func hasOpenList(stack []openElement) bool {
+	for _, e := range stack {
+		if e.name == "ul" || e.name == "ol" || e.name == "menu" {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceLineNum returns the number of the line in the document (starting at 0) of a line of the source,
+// as written in the 'data-rite-line' attribute, preferring the lines of the main file to the included ones
+func (doc *Document) sourceLineNum(riteLine int) int {
+	found := -1
+	for i, origin := range doc.origins {
+		if origin.lineNum == riteLine {
+			if origin.fileName == doc.fileName {
+				return i
+			}
+			if found < 0 {
+				found = i
+			}
+		}
+	}
+	if found < 0 && len(doc.origins) == 0 {
+		return riteLine - 1
+	}
+	return found
+}
+
+// The links to fragments of the document, and the attributes which define the targets of the links
+var (
+	reFragmentLink = regexp.MustCompile(`\shref\s*=\s*"#([^"]+)"`)
+	reNameAttr     = regexp.MustCompile(`\sname\s*=\s*"([^"]*)"`)
+)
+
+// checkFragments warns about the links to fragments of the document, like '<a href="#intro">', whose target
+// is not in the generated HTML, including the elements written by the template. The problems are reported
+// in the line of the source of the link when it is known, or otherwise in the first line which mentions the fragment.
+func (doc *Document) checkFragments(html string) {
+	targets := map[string]bool{}
+	type link struct {
+		fragment string
+		lineNum  int
+	}
+	links := []link{}
+
+	lineNum := -1
+	for _, token := range reHTMLToken.FindAllString(html, -1) {
+		if !strings.HasPrefix(token, "<") || strings.HasPrefix(token, "</") || strings.HasPrefix(token, "<!") {
+			continue
+		}
+		if lm := reLineAttr.FindStringSubmatch(token); lm != nil {
+			riteLine, _ := strconv.Atoi(lm[1])
+			lineNum = doc.sourceLineNum(riteLine)
+		}
+		if im := reIDAttr.FindStringSubmatch(token); im != nil {
+			targets[im[1]+im[2]+im[3]] = true
+		}
+		if nm := reNameAttr.FindStringSubmatch(token); nm != nil {
+			targets[nm[1]] = true
+		}
+		if fm := reFragmentLink.FindStringSubmatch(token); fm != nil {
+			links = append(links, link{fragment: fm[1], lineNum: lineNum})
+		}
+	}
+
+	// The references with <x-ref> are checked already by checkXrefs
+	xrefs := map[string]bool{}
+	for _, ref := range doc.xrefs {
+		xrefs[ref.id] = true
+	}
+
+	for _, l := range links {
+		fragment, err := url.PathUnescape(l.fragment)
+		if err != nil {
+			fragment = l.fragment
+		}
+		if targets[fragment] || targets[l.fragment] || xrefs[fragment] {
+			continue
+		}
+
+		lineNum := l.lineNum
+		if lineNum < 0 {
+			lineNum = doc.findLine("href=\"#"+fragment, "-#"+fragment, "#"+fragment)
+		}
+		doc.warnf(lineNum, "broken-link", "link to '#%v', which is not in the document", fragment)
+	}
+}
+
+// findLine returns the first line of the document which contains the first of the texts found, or -1
+func (doc *Document) findLine(texts ...string) int {
+	for _, text := range texts {
+		for i, line := range doc.lines {
+			if strings.Contains(line, text) {
+				return i
+			}
+		}
+	}
+	return -1
+}
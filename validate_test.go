@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestCheckHTMLLines(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		line int
+		want string
+	}{
+		{"before any line of the source", `</span><p data-rite-line="2">Two</p>`, 0, "end tag </span> without start tag"},
+		{"after a line of the source", `<p data-rite-line="2">Two</p></span>`, 2, "line 2: end tag </span> without start tag"},
+		{"inside an element", `<div data-rite-line="3"><p>Three</span></p></div>`, 3, "line 3: end tag </span> without start tag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newTestDocument("One\n\nThree\n")
+			doc.checkHTML(tt.html)
+
+			if len(doc.diagnostics) != 1 {
+				t.Fatalf("got diagnostics %v, want one", doc.diagnostics)
+			}
+			d := doc.diagnostics[0]
+			if d.Line != tt.line || d.Error() != tt.want {
+				t.Errorf("got line %v and %q, want line %v and %q", d.Line, d.Error(), tt.line, tt.want)
+			}
+		})
+	}
+}